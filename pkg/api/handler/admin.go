@@ -3,27 +3,38 @@ package handler
 import (
 	"net/http"
 	"strconv"
-	"time"
 
-	"ahava/pkg/helper"
 	services "ahava/pkg/service"
 	models "ahava/pkg/utils/models"
 
 	response "ahava/pkg/utils/response"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/go-playground/validator/v10"
 )
 
 type AdminHandler interface {
 	Login(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
 	BlockUser(ctx *gin.Context)
 	UnBlockUser(ctx *gin.Context)
 	ListAllUsers(ctx *gin.Context)
+	ListLoginLockouts(ctx *gin.Context)
+	UnlockLogin(ctx *gin.Context)
+	ListReferrals(ctx *gin.Context)
 
-	// NewPaymentMethod(ctx *gin.Context)
-	// ListPaymentMethods(ctx *gin.Context)
-	// DeletePaymentMethod(ctx *gin.Context)
+	ListStaff(ctx *gin.Context)
+	GetStaff(ctx *gin.Context)
+	CreateStaff(ctx *gin.Context)
+	UpdateStaff(ctx *gin.Context)
+	DeleteStaff(ctx *gin.Context)
+	ResetStaffPassword(ctx *gin.Context)
+
+	NewPaymentMethod(ctx *gin.Context)
+	ListPaymentMethods(ctx *gin.Context)
+	UpdatePaymentMethod(ctx *gin.Context)
+	DeletePaymentMethod(ctx *gin.Context)
 	ValidateRefreshTokenAndCreateNewAccess(ctx *gin.Context)
 }
 
@@ -46,10 +57,10 @@ func (ad *adminHandler) Login(ctx *gin.Context) {
 		return
 	}
 	// Perform login operation
-	admin, err := ad.adminService.Login(adminDetails)
+	admin, err := ad.adminService.Login(adminDetails, deviceInfo(ctx))
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Không thể đăng nhập admin", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -59,6 +70,49 @@ func (ad *adminHandler) Login(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
+func (ad *adminHandler) Logout(ctx *gin.Context) {
+	// Get the admin id and the session from the context
+	admin_id := ctx.MustGet("id").(int)
+	session_id := ctx.MustGet("session_id").(string)
+	// Perform logout operation
+	if err := ad.adminService.Logout(uint(admin_id), session_id); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đăng xuất", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đăng xuất thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (ad *adminHandler) ChangePassword(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Bind the request body to the model
+	var model models.AdminChangePassword
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform change password operation, the other sessions are logged out
+	tokens, err := ad.adminService.ChangePassword(uint(admin_id), model, deviceInfo(ctx))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đổi mật khẩu", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đổi mật khẩu thành công", tokens, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
 func (ad *adminHandler) BlockUser(ctx *gin.Context) {
 	// Get the user id from the context
 	user_id, err := strconv.Atoi(ctx.Param("user_id"))
@@ -127,87 +181,337 @@ func (ad *adminHandler) ListAllUsers(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
-// func (i *adminHandler) NewPaymentMethod(ctx *gin.Context) {
-
-// 	var method models.NewPaymentMethod
-// 	if err := ctx.BindJSON(&method); err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Fields provided are in wrong format", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	err := i.adminService.NewPaymentMethod(method.PaymentMethod)
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Could not add the payment method", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	successRes := response.ClientResponse(http.StatusOK, "Successfully added Payment Method", nil, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
-// }
-
-// func (a *adminHandler) ListPaymentMethods(ctx *gin.Context) {
+func (ad *adminHandler) ListLoginLockouts(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the optional filters from the query
+	role := ctx.Query("role")
+	scope := ctx.Query("scope")
+	// Perform list lockouts operation
+	lockouts, err := ad.adminService.ListLoginLockouts(role, scope, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách tài khoản bị khóa", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách tài khoản bị khóa thành công", lockouts, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// 	categories, err := a.adminService.ListPaymentMethods()
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusInternalServerError, "Fields provided are in wrong format", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
+func (ad *adminHandler) UnlockLogin(ctx *gin.Context) {
+	// Get the lockout id from the params
+	lockout_id, err := strconv.Atoi(ctx.Param("lockout_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform unlock operation
+	if err := ad.adminService.UnlockLogin(uint(lockout_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể mở khóa đăng nhập", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Mở khóa đăng nhập thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// 	successRes := response.ClientResponse(http.StatusOK, "Successfully got all payment methods", categories, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
+func (ad *adminHandler) ListReferrals(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the optional status from the query
+	status := ctx.Query("status")
+	// Perform list referrals operation
+	referrals, err := ad.adminService.ListReferrals(status, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách giới thiệu", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách giới thiệu thành công", referrals, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// }
+func (ad *adminHandler) ListStaff(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform list staff operation
+	staff, err := ad.adminService.ListStaff(limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách nhân viên thành công", staff, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// func (a *adminHandler) DeletePaymentMethod(ctx *gin.Context) {
+func (ad *adminHandler) GetStaff(ctx *gin.Context) {
+	// Get the admin id from the params
+	admin_id, err := strconv.Atoi(ctx.Param("admin_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get staff operation
+	staff, err := ad.adminService.GetStaff(uint(admin_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin nhân viên thành công", staff, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// 	id, err := strconv.Atoi(ctx.Query("id"))
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Fields provided are in wrong format", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
+func (ad *adminHandler) CreateStaff(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.CreateStaff
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform create staff operation
+	staff, err := ad.adminService.CreateStaff(model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể tạo tài khoản nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Tạo tài khoản nhân viên thành công", staff, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
 
-// 	err = a.adminService.DeletePaymentMethod(uint(id))
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusInternalServerError, "error in deleting data", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
+func (ad *adminHandler) UpdateStaff(ctx *gin.Context) {
+	// Get the caller id from the context
+	caller_id := ctx.MustGet("id").(int)
+	// Get the admin id from the params
+	admin_id, err := strconv.Atoi(ctx.Param("admin_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdateStaff
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform update staff operation
+	staff, err := ad.adminService.UpdateStaff(uint(caller_id), uint(admin_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật nhân viên thành công", staff, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// 	successRes := response.ClientResponse(http.StatusOK, "Successfully deleted the Category", nil, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
-// }
+func (ad *adminHandler) DeleteStaff(ctx *gin.Context) {
+	// Get the caller id from the context
+	caller_id := ctx.MustGet("id").(int)
+	// Get the admin id from the params
+	admin_id, err := strconv.Atoi(ctx.Param("admin_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform delete staff operation
+	if err := ad.adminService.DeleteStaff(uint(caller_id), uint(admin_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xoá nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xoá nhân viên thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-func (a *adminHandler) ValidateRefreshTokenAndCreateNewAccess(ctx *gin.Context) {
+func (ad *adminHandler) ResetStaffPassword(ctx *gin.Context) {
+	// Get the admin id from the params
+	admin_id, err := strconv.Atoi(ctx.Param("admin_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.ResetStaffPassword
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform reset password operation
+	if err := ad.adminService.ResetStaffPassword(uint(admin_id), model.Password); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đặt lại mật khẩu nhân viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đặt lại mật khẩu nhân viên thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-	refreshToken := ctx.Request.Header.Get("RefreshToken")
+func (a *adminHandler) NewPaymentMethod(ctx *gin.Context) {
+	// Bind the request body to the model
+	var method models.PaymentMethod
+	if err := ctx.BindJSON(&method); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(method); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform add payment method operation
+	result, err := a.adminService.NewPaymentMethod(method)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thêm phương thức thanh toán", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Thêm phương thức thanh toán thành công", result, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
 
-	// Check if the refresh token is valid.
-	_, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte("refreshsecret"), nil
-	})
+func (a *adminHandler) ListPaymentMethods(ctx *gin.Context) {
+	// Perform list payment methods operation
+	methods, err := a.adminService.ListPaymentMethods()
 	if err != nil {
-		// The refresh token is invalid.
-		ctx.AbortWithError(401, models.ErrInvalidToken)
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách phương thức thanh toán", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
 		return
 	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách phương thức thanh toán thành công", methods, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-	claims := &helper.AuthCustomClaims{
-		Role: "admin",
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
+func (a *adminHandler) UpdatePaymentMethod(ctx *gin.Context) {
+	// Get the payment method id from the params
+	id, err := strconv.Atoi(ctx.Param("method_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdatePaymentMethod
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
 	}
+	// Perform update payment method operation
+	result, err := a.adminService.UpdatePaymentMethod(uint(id), model.Enable)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật phương thức thanh toán", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật phương thức thanh toán thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	newAccessToken, err := token.SignedString([]byte("accesssecret"))
+func (a *adminHandler) DeletePaymentMethod(ctx *gin.Context) {
+	// Get the payment method id from the params
+	id, err := strconv.Atoi(ctx.Param("method_id"))
 	if err != nil {
-		ctx.AbortWithError(500, models.ErrCreateToken)
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
 	}
+	// Perform delete payment method operation
+	if err := a.adminService.DeletePaymentMethod(uint(id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xoá phương thức thanh toán", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xoá phương thức thanh toán thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-	ctx.JSON(200, newAccessToken)
+func (a *adminHandler) ValidateRefreshTokenAndCreateNewAccess(ctx *gin.Context) {
+	// Get the refresh token from the header
+	refreshToken := ctx.Request.Header.Get("RefreshToken")
+	// Perform refresh token operation, the refresh token is replaced on every use
+	tokens, err := a.adminService.RefreshTokens(refreshToken, deviceInfo(ctx))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể làm mới token", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the new tokens
+	ctx.JSON(http.StatusOK, tokens)
 }
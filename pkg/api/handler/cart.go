@@ -16,6 +16,7 @@ type CartHandler interface {
 	GetCart(ctx *gin.Context)
 	RemoveFromCart(ctx *gin.Context)
 	UpdateQuantity(ctx *gin.Context)
+	CheckOut(ctx *gin.Context)
 }
 
 type cartHandler struct {
@@ -49,7 +50,7 @@ func (i *cartHandler) AddToCart(ctx *gin.Context) {
 	result, err := i.service.AddToCart(uint(user_id), model)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Không thể thêm sản phẩm vào giỏ hàng", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -114,7 +115,7 @@ func (i *cartHandler) UpdateQuantity(ctx *gin.Context) {
 	result, err := i.service.UpdateQuantity(uint(user_id), uint(cart_id), model.Quantity)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Không thể cập nhật số lượng", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -122,3 +123,24 @@ func (i *cartHandler) UpdateQuantity(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
+func (i *cartHandler) CheckOut(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Bind the request body to the model
+	var model models.CartCheckout
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform checkout operation
+	result, err := i.service.CheckOut(uint(user_id), model.CartIDs, model.Coupon)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thanh toán giỏ hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Thanh toán giỏ hàng thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type CategoryHandler interface {
+	GetCategoryTree(ctx *gin.Context)
+	ListCategories(ctx *gin.Context)
+	GetCategory(ctx *gin.Context)
+	AddCategory(ctx *gin.Context)
+	UpdateCategory(ctx *gin.Context)
+	DeleteCategory(ctx *gin.Context)
+}
+
+type categoryHandler struct {
+	categoryService services.CategoryService
+}
+
+func NewCategoryHandler(service services.CategoryService) CategoryHandler {
+	return &categoryHandler{
+		categoryService: service,
+	}
+}
+
+func (h *categoryHandler) GetCategoryTree(ctx *gin.Context) {
+	// Perform get category tree operation, without the hidden categories
+	tree, err := h.categoryService.GetCategoryTree(false)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách danh mục thành công", tree, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *categoryHandler) ListCategories(ctx *gin.Context) {
+	// Perform get category tree operation, with the hidden categories
+	tree, err := h.categoryService.GetCategoryTree(true)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách danh mục thành công", tree, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *categoryHandler) GetCategory(ctx *gin.Context) {
+	// Get the category id from the params
+	category_id, err := strconv.Atoi(ctx.Param("category_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get category operation
+	category, err := h.categoryService.GetCategory(uint(category_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin danh mục thành công", category, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *categoryHandler) AddCategory(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.Category
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform add category operation
+	category, err := h.categoryService.AddCategory(model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thêm danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Thêm danh mục thành công", category, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
+
+func (h *categoryHandler) UpdateCategory(ctx *gin.Context) {
+	// Get the category id from the params
+	category_id, err := strconv.Atoi(ctx.Param("category_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdateCategory
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform update category operation
+	category, err := h.categoryService.UpdateCategory(uint(category_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật danh mục thành công", category, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *categoryHandler) DeleteCategory(ctx *gin.Context) {
+	// Get the category id from the params
+	category_id, err := strconv.Atoi(ctx.Param("category_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform delete category operation
+	if err := h.categoryService.DeleteCategory(uint(category_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xoá danh mục", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xoá danh mục thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
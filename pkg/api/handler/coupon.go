@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type CouponHandler interface {
+	GetAllCoupons(ctx *gin.Context)
+	GetCoupon(ctx *gin.Context)
+	CreateNewCoupon(ctx *gin.Context)
+	UpdateCoupon(ctx *gin.Context)
+	MakeCouponInvalid(ctx *gin.Context)
+	ReActivateCoupon(ctx *gin.Context)
+	GetAvailableCoupons(ctx *gin.Context)
+}
+
+type couponHandler struct {
+	couponService services.CouponService
+}
+
+func NewCouponHandler(service services.CouponService) CouponHandler {
+	return &couponHandler{
+		couponService: service,
+	}
+}
+
+func (h *couponHandler) GetAllCoupons(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform list coupons operation
+	coupons, err := h.couponService.ListAllCoupons(limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách mã giảm giá", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách mã giảm giá thành công", coupons, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *couponHandler) GetCoupon(ctx *gin.Context) {
+	// Get the coupon id from the params
+	coupon_id, err := strconv.Atoi(ctx.Param("coupon_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get coupon operation
+	coupon, err := h.couponService.GetCoupon(uint(coupon_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin mã giảm giá", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin mã giảm giá thành công", coupon, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *couponHandler) CreateNewCoupon(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.Coupon
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform create coupon operation
+	coupon, err := h.couponService.AddCoupon(model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thêm mã giảm giá", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Thêm mã giảm giá thành công", coupon, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
+
+func (h *couponHandler) UpdateCoupon(ctx *gin.Context) {
+	// Get the coupon id from the params
+	coupon_id, err := strconv.Atoi(ctx.Param("coupon_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.Coupon
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform update coupon operation
+	coupon, err := h.couponService.UpdateCoupon(uint(coupon_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật mã giảm giá", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật mã giảm giá thành công", coupon, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *couponHandler) MakeCouponInvalid(ctx *gin.Context) {
+	// Get the coupon id from the params
+	coupon_id, err := strconv.Atoi(ctx.Param("coupon_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform make coupon invalid operation
+	if err := h.couponService.MakeCouponInvalid(uint(coupon_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể vô hiệu hoá mã giảm giá", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Vô hiệu hoá mã giảm giá thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *couponHandler) ReActivateCoupon(ctx *gin.Context) {
+	// Get the coupon id from the params
+	coupon_id, err := strconv.Atoi(ctx.Param("coupon_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform reactivate coupon operation
+	if err := h.couponService.ReActivateCoupon(uint(coupon_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể kích hoạt lại mã giảm giá", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Kích hoạt lại mã giảm giá thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *couponHandler) GetAvailableCoupons(ctx *gin.Context) {
+	// Perform list available coupons operation
+	coupons, err := h.couponService.ListAvailableCoupons()
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách mã giảm giá", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách mã giảm giá thành công", coupons, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
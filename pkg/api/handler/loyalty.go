@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type LoyaltyHandler interface {
+	GetLoyalty(ctx *gin.Context)
+	RedeemPoints(ctx *gin.Context)
+}
+
+type loyaltyHandler struct {
+	loyaltyService services.LoyaltyService
+}
+
+func NewLoyaltyHandler(service services.LoyaltyService) LoyaltyHandler {
+	return &loyaltyHandler{
+		loyaltyService: service,
+	}
+}
+
+func (h *loyaltyHandler) GetLoyalty(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get loyalty operation
+	loyalty, err := h.loyaltyService.GetLoyalty(uint(user_id), limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin thành viên", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin thành viên thành công", loyalty, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *loyaltyHandler) RedeemPoints(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Bind the request body to the model
+	var model models.RedeemPoints
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform redeem points operation
+	result, err := h.loyaltyService.RedeemPoints(uint(user_id), model.Points)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đổi điểm tích lũy", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Đổi điểm tích lũy thành công", result, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
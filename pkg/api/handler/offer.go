@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type OfferHandler interface {
+	GetAllOffers(ctx *gin.Context)
+	GetOffer(ctx *gin.Context)
+	AddOffer(ctx *gin.Context)
+	UpdateOffer(ctx *gin.Context)
+	DeleteOffer(ctx *gin.Context)
+	GetActiveOffers(ctx *gin.Context)
+}
+
+type offerHandler struct {
+	offerService services.OfferService
+}
+
+func NewOfferHandler(service services.OfferService) OfferHandler {
+	return &offerHandler{
+		offerService: service,
+	}
+}
+
+func (h *offerHandler) GetAllOffers(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform list offers operation
+	offers, err := h.offerService.ListAllOffers(limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách khuyến mãi", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách khuyến mãi thành công", offers, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *offerHandler) GetOffer(ctx *gin.Context) {
+	// Get the offer id from the params
+	offer_id, err := strconv.Atoi(ctx.Param("offer_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get offer operation
+	offer, err := h.offerService.GetOffer(uint(offer_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin khuyến mãi", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin khuyến mãi thành công", offer, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *offerHandler) AddOffer(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.Offer
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform add offer operation
+	offer, err := h.offerService.AddOffer(model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thêm khuyến mãi", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Thêm khuyến mãi thành công", offer, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
+
+func (h *offerHandler) UpdateOffer(ctx *gin.Context) {
+	// Get the offer id from the params
+	offer_id, err := strconv.Atoi(ctx.Param("offer_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.Offer
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform update offer operation
+	offer, err := h.offerService.UpdateOffer(uint(offer_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật khuyến mãi", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật khuyến mãi thành công", offer, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *offerHandler) DeleteOffer(ctx *gin.Context) {
+	// Get the offer id from the params
+	offer_id, err := strconv.Atoi(ctx.Param("offer_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform delete offer operation
+	if err := h.offerService.DeleteOffer(uint(offer_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xoá khuyến mãi", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xoá khuyến mãi thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *offerHandler) GetActiveOffers(ctx *gin.Context) {
+	// Perform list active offers operation
+	offers, err := h.offerService.ListActiveOffers()
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách khuyến mãi", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách khuyến mãi thành công", offers, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
@@ -9,12 +9,23 @@ import (
 	response "ahava/pkg/utils/response"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 )
 
 type OrderHandler interface {
 	PlaceOrder(ctx *gin.Context)
 	GetOrderDetails(ctx *gin.Context)
+	GetOrder(ctx *gin.Context)
 	ListAllOrders(ctx *gin.Context)
+	UpdateOrderStatus(ctx *gin.Context)
+	GetOrderStatusHistory(ctx *gin.Context)
+
+	CancelOrder(ctx *gin.Context)
+	RequestReturn(ctx *gin.Context)
+	GetReturnRequests(ctx *gin.Context)
+	ListReturnRequests(ctx *gin.Context)
+	ApproveReturnRequest(ctx *gin.Context)
+	RejectReturnRequest(ctx *gin.Context)
 }
 
 type orderHandler struct {
@@ -42,7 +53,7 @@ func (h *orderHandler) PlaceOrder(ctx *gin.Context) {
 	order, err := h.orderService.PlaceOrder(orderDetails)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Đặt hàng thất bại", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -72,6 +83,26 @@ func (h *orderHandler) GetOrderDetails(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
+func (h *orderHandler) GetOrder(ctx *gin.Context) {
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get order operation
+	order, err := h.orderService.GetOrder(uint(order_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin đơn hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin đơn hàng thành công", order, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
 func (h *orderHandler) ListAllOrders(ctx *gin.Context) {
 	// Get the limit and offset from the query
 	limit, err := strconv.Atoi(ctx.Query("limit"))
@@ -93,3 +124,219 @@ func (h *orderHandler) ListAllOrders(ctx *gin.Context) {
 	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách đơn hàng thành công", orders, nil)
 	ctx.JSON(http.StatusOK, successRes)
 }
+
+func (h *orderHandler) UpdateOrderStatus(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdateOrderStatus
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform update order status operation
+	order, err := h.orderService.UpdateOrderStatus(uint(order_id), uint(admin_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật trạng thái đơn hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật trạng thái đơn hàng thành công", order, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) GetOrderStatusHistory(ctx *gin.Context) {
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get order status history operation
+	history, err := h.orderService.GetOrderStatusHistory(uint(order_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy lịch sử trạng thái đơn hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy lịch sử trạng thái đơn hàng thành công", history, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) CancelOrder(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform cancel order operation
+	order, err := h.orderService.CancelOrder(uint(user_id), uint(order_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể huỷ đơn hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Huỷ đơn hàng thành công", order, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) RequestReturn(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.RequestReturn
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform request return operation
+	result, err := h.orderService.RequestReturn(uint(user_id), uint(order_id), model.Reason)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể gửi yêu cầu trả hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Gửi yêu cầu trả hàng thành công", result, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
+
+func (h *orderHandler) GetReturnRequests(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get return requests operation
+	result, err := h.orderService.GetReturnRequests(uint(user_id), uint(order_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy yêu cầu trả hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy yêu cầu trả hàng thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) ListReturnRequests(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset"))
+	if err != nil {
+		offset = 0
+	}
+	// Get the status filter from the query
+	status := ctx.Query("status")
+	// Perform list return requests operation
+	result, err := h.orderService.ListReturnRequests(status, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách yêu cầu trả hàng", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách yêu cầu trả hàng thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) ApproveReturnRequest(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the return request id from the params
+	return_id, err := strconv.Atoi(ctx.Param("return_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.ReviewReturnRequest
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform approve return request operation
+	result, err := h.orderService.ApproveReturnRequest(uint(return_id), uint(admin_id), model.Note)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể duyệt yêu cầu trả hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Duyệt yêu cầu trả hàng thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *orderHandler) RejectReturnRequest(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the return request id from the params
+	return_id, err := strconv.Atoi(ctx.Param("return_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.ReviewReturnRequest
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform reject return request operation
+	result, err := h.orderService.RejectReturnRequest(uint(return_id), uint(admin_id), model.Note)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể từ chối yêu cầu trả hàng", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Từ chối yêu cầu trả hàng thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
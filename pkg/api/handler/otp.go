@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type OtpHandler interface {
+	SendOTP(ctx *gin.Context)
+	VerifyOTP(ctx *gin.Context)
+}
+
+type otpHandler struct {
+	otpService services.OtpService
+}
+
+func NewOtpHandler(service services.OtpService) OtpHandler {
+	return &otpHandler{
+		otpService: service,
+	}
+}
+
+func (h *otpHandler) SendOTP(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.OtpContact
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform send otp operation
+	if err := h.otpService.SendOTP(models.OtpPurposeLogin, model); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể gửi mã xác thực", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Mã xác thực đã được gửi nếu tài khoản tồn tại", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *otpHandler) VerifyOTP(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.VerifyOTP
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform login with otp operation
+	result, err := h.otpService.LoginWithOTP(model, deviceInfo(ctx))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đăng nhập", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đăng nhập thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	services "ahava/pkg/service"
 	models "ahava/pkg/utils/models"
@@ -12,8 +13,11 @@ import (
 )
 
 type PaymentHandler interface {
-	CreateQR(ctx *gin.Context)
+	CreatePaymentIntent(ctx *gin.Context)
+	ListPaymentMethods(ctx *gin.Context)
 	Webhook(ctx *gin.Context)
+	Callback(ctx *gin.Context)
+	QueryPaymentStatus(ctx *gin.Context)
 }
 
 type paymentHandler struct {
@@ -26,11 +30,11 @@ func NewPaymentHandler(service services.PaymentService) PaymentHandler {
 	}
 }
 
-func (h *paymentHandler) CreateQR(c *gin.Context) {
+func (h *paymentHandler) CreatePaymentIntent(c *gin.Context) {
 	// Get the user id from the context
 	user_id := c.MustGet("id").(int)
 	// Bind the request body to the model
-	var model models.CreateQR
+	var model models.PaymentIntent
 	err := c.BindJSON(&model)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
@@ -44,35 +48,100 @@ func (h *paymentHandler) CreateQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, errRes)
 		return
 	}
-	// Perform create QR operation
-	result, err := h.paymentService.CreateSePayQR(uint(user_id), model.OrderID, model.Amount)
+	// Perform create payment intent operation
+	result, err := h.paymentService.CreatePaymentIntent(uint(user_id), model.OrderID)
 	if err != nil {
-		errorRes := response.ClientErrorResponse("Không thể tạo QR", nil, err)
-		c.JSON(http.StatusBadRequest, errorRes)
+		errorRes := response.ClientErrorResponse("Không thể tạo thanh toán", nil, err)
+		c.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
-	successRes := response.ClientResponse(http.StatusCreated, "Tạo QR thành công", result, nil)
+	successRes := response.ClientResponse(http.StatusCreated, "Tạo thanh toán thành công", result, nil)
 	c.JSON(http.StatusCreated, successRes)
 }
 
+func (h *paymentHandler) ListPaymentMethods(c *gin.Context) {
+	// Perform list payment methods operation
+	methods, err := h.paymentService.ListPaymentMethods()
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách phương thức thanh toán", nil, err)
+		c.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách phương thức thanh toán thành công", methods, nil)
+	c.JSON(http.StatusOK, successRes)
+}
+
 func (h *paymentHandler) Webhook(c *gin.Context) {
-	// Bind the request body to the model
-	var model models.Transaction
-	err := c.BindJSON(&model)
+	// Read the raw request body, the signature is computed over it
+	payload, err := c.GetRawData()
 	if err != nil {
-		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		errorRes := response.ClientWebhookResponse(false)
 		c.JSON(http.StatusBadRequest, errorRes)
 		return
 	}
 	// Perform webhook operation
-	err = h.paymentService.Webhook(model)
+	err = h.paymentService.HandleCallback(models.PaymentMethodSePay, models.WebhookRequest{
+		Authorization: c.GetHeader("Authorization"),
+		Signature:     c.GetHeader("X-Sepay-Signature"),
+		ClientIP:      c.ClientIP(),
+		Payload:       payload,
+	})
 	if err != nil {
 		errorRes := response.ClientWebhookResponse(false)
-		c.JSON(http.StatusBadRequest, errorRes)
+		c.JSON(response.ClientErrorResponse("", nil, err).StatusCode, errorRes)
 		return
 	}
 	// Return the response
 	successRes := response.ClientWebhookResponse(true)
 	c.JSON(http.StatusCreated, successRes)
 }
+
+func (h *paymentHandler) Callback(c *gin.Context) {
+	// Gateways send the signed parameters in the query string or as a form body
+	payload := []byte(c.Request.URL.RawQuery)
+	if len(payload) == 0 {
+		body, err := c.GetRawData()
+		if err != nil {
+			errorRes := response.ClientWebhookResponse(false)
+			c.JSON(http.StatusBadRequest, errorRes)
+			return
+		}
+		payload = body
+	}
+	// Perform callback operation
+	err := h.paymentService.HandleCallback(c.Param("provider"), models.WebhookRequest{
+		Authorization: c.GetHeader("Authorization"),
+		ClientIP:      c.ClientIP(),
+		Payload:       payload,
+	})
+	if err != nil {
+		errorRes := response.ClientWebhookResponse(false)
+		c.JSON(response.ClientErrorResponse("", nil, err).StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientWebhookResponse(true)
+	c.JSON(http.StatusOK, successRes)
+}
+
+func (h *paymentHandler) QueryPaymentStatus(c *gin.Context) {
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		c.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform query payment status operation
+	status, err := h.paymentService.QueryPaymentStatus(uint(order_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể kiểm tra trạng thái thanh toán", nil, err)
+		c.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Kiểm tra trạng thái thanh toán thành công", status, nil)
+	c.JSON(http.StatusOK, successRes)
+}
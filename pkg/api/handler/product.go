@@ -20,6 +20,14 @@ type ProductHandler interface {
 	ListFeaturedProducts(ctx *gin.Context)
 	ListAllProducts(ctx *gin.Context)
 	SearchProducts(ctx *gin.Context)
+	QueryProducts(ctx *gin.Context)
+	GetSearchHistory(ctx *gin.Context)
+	DeleteSearchHistory(ctx *gin.Context)
+	ClearSearchHistory(ctx *gin.Context)
+	ListTrendingSearches(ctx *gin.Context)
+	SuggestSearch(ctx *gin.Context)
+	AdjustStock(ctx *gin.Context)
+	ListStockMovements(ctx *gin.Context)
 }
 
 type productHandler struct {
@@ -94,13 +102,13 @@ func (h *productHandler) GetProductDetails(ctx *gin.Context) {
 }
 
 func (h *productHandler) ListCategoryProducts(ctx *gin.Context) {
-	// Get the category from the query
+	// Get the category slug or name from the query, the products of its subcategories are listed too
 	category := ctx.Query("category")
 	// Perform list category products operation
 	products, err := h.ProductService.ListCategoryProducts(category)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Không thể lấy danh sách sản phẩm", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -122,6 +130,19 @@ func (h *productHandler) ListFeaturedProducts(ctx *gin.Context) {
 }
 
 func (h *productHandler) SearchProducts(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
 	// Bind the request body to the model
 	var searchkey models.Search
 	if err := ctx.BindJSON(&searchkey); err != nil {
@@ -129,11 +150,19 @@ func (h *productHandler) SearchProducts(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorRes)
 		return
 	}
+	// Validate the model
+	if err := validator.New().Struct(searchkey); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the user id from the context, searches without a login have none
+	user_id := ctx.GetInt("id")
 	// Perform search products operation
-	results, err := h.ProductService.SearchProducts(searchkey.Key)
+	results, err := h.ProductService.SearchProducts(uint(user_id), searchkey.Key, limit, offset)
 	if err != nil {
 		errorRes := response.ClientErrorResponse("Không thể lấy danh sách sản phẩm", nil, err)
-		ctx.JSON(http.StatusBadRequest, errorRes)
+		ctx.JSON(errorRes.StatusCode, errorRes)
 		return
 	}
 	// Return the response
@@ -141,6 +170,143 @@ func (h *productHandler) SearchProducts(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
+func (h *productHandler) GetSearchHistory(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the limit from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get search history operation
+	history, err := h.ProductService.GetSearchHistory(uint(user_id), limit)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy lịch sử tìm kiếm", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy lịch sử tìm kiếm thành công", history, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) DeleteSearchHistory(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the history id from the params
+	history_id, err := strconv.Atoi(ctx.Param("history_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform delete search history operation
+	if err := h.ProductService.DeleteSearchHistory(uint(user_id), uint(history_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xóa lịch sử tìm kiếm", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xóa lịch sử tìm kiếm thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) ClearSearchHistory(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Perform clear search history operation
+	if err := h.ProductService.ClearSearchHistory(uint(user_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xóa lịch sử tìm kiếm", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xóa lịch sử tìm kiếm thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) ListTrendingSearches(ctx *gin.Context) {
+	// Get the limit from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform list trending searches operation
+	searches, err := h.ProductService.ListTrendingSearches(limit)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách tìm kiếm phổ biến", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách tìm kiếm phổ biến thành công", searches, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) SuggestSearch(ctx *gin.Context) {
+	// Get the key and limit from the query
+	key := ctx.Query("q")
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "8"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform suggest search operation
+	suggestions, err := h.ProductService.SuggestSearch(key, limit)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy gợi ý tìm kiếm", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy gợi ý tìm kiếm thành công", suggestions, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) QueryProducts(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the filters of the query to the model
+	var query models.ProductQuery
+	if err := ctx.BindQuery(&query); err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(query); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform query products operation
+	catalog, err := h.ProductService.QueryProducts(query, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách sản phẩm", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách sản phẩm thành công", catalog, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
 func (h *productHandler) UpdateProduct(ctx *gin.Context) {
 	// Get the product id from the context
 	product_id, err := strconv.Atoi(ctx.Param("product_id"))
@@ -202,3 +368,77 @@ func (h *productHandler) ListAllProducts(ctx *gin.Context) {
 	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách sản phẩm thành công", products, nil)
 	ctx.JSON(http.StatusOK, successRes)
 }
+
+func (h *productHandler) AdjustStock(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the product id and price id from the params
+	product_id, err := strconv.Atoi(ctx.Param("product_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	price_id, err := strconv.Atoi(ctx.Param("price_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.AdjustStock
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform adjust stock operation
+	result, err := h.ProductService.AdjustStock(uint(product_id), uint(price_id), uint(admin_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật tồn kho", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật tồn kho thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *productHandler) ListStockMovements(ctx *gin.Context) {
+	// Get the product id from the params
+	product_id, err := strconv.Atoi(ctx.Param("product_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform list stock movements operation
+	result, err := h.ProductService.ListStockMovements(uint(product_id), limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy lịch sử tồn kho", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy lịch sử tồn kho thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
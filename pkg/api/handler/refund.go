@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type RefundHandler interface {
+	CreateRefund(ctx *gin.Context)
+	ListRefunds(ctx *gin.Context)
+	GetRefund(ctx *gin.Context)
+	RetryRefund(ctx *gin.Context)
+	CompleteRefund(ctx *gin.Context)
+	FailRefund(ctx *gin.Context)
+}
+
+type refundHandler struct {
+	refundService services.RefundService
+}
+
+func NewRefundHandler(service services.RefundService) RefundHandler {
+	return &refundHandler{
+		refundService: service,
+	}
+}
+
+func (h *refundHandler) CreateRefund(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the order id from the params
+	order_id, err := strconv.Atoi(ctx.Param("order_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.CreateRefund
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	// Perform create refund operation
+	result, err := h.refundService.CreateRefund(uint(order_id), uint(admin_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể hoàn tiền", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Tạo hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
+
+func (h *refundHandler) ListRefunds(ctx *gin.Context) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the order and status filters from the query
+	order_id, err := strconv.Atoi(ctx.DefaultQuery("order_id", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	status := ctx.Query("status")
+	// Perform list refunds operation
+	result, err := h.refundService.ListRefunds(uint(order_id), status, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy danh sách hoàn tiền", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy danh sách hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *refundHandler) GetRefund(ctx *gin.Context) {
+	// Get the refund id from the params
+	refund_id, err := strconv.Atoi(ctx.Param("refund_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get refund operation
+	result, err := h.refundService.GetRefund(uint(refund_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin hoàn tiền", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *refundHandler) RetryRefund(ctx *gin.Context) {
+	// Get the refund id from the params
+	refund_id, err := strconv.Atoi(ctx.Param("refund_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform retry refund operation
+	result, err := h.refundService.RetryRefund(uint(refund_id))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể thử lại hoàn tiền", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Thử lại hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *refundHandler) CompleteRefund(ctx *gin.Context) {
+	// Get the refund id from the params
+	refund_id, err := strconv.Atoi(ctx.Param("refund_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdateRefund
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform complete refund operation
+	result, err := h.refundService.CompleteRefund(uint(refund_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xác nhận hoàn tiền", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xác nhận hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *refundHandler) FailRefund(ctx *gin.Context) {
+	// Get the refund id from the params
+	refund_id, err := strconv.Atoi(ctx.Param("refund_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.UpdateRefund
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform fail refund operation
+	result, err := h.refundService.FailRefund(uint(refund_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể cập nhật hoàn tiền", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Cập nhật hoàn tiền thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
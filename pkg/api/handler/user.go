@@ -15,16 +15,19 @@ import (
 type UserHandler interface {
 	Register(ctx *gin.Context)
 	Login(ctx *gin.Context)
+	RefreshToken(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	LogoutAll(ctx *gin.Context)
 	AddAddress(ctx *gin.Context)
 	UpdateAddress(ctx *gin.Context)
 	DeleteAddress(ctx *gin.Context)
 	GetAddresses(ctx *gin.Context)
 	GetUserDetails(ctx *gin.Context)
 	ChangePassword(ctx *gin.Context)
-	// ForgotPasswordSend(ctx *gin.Context)
-	// ForgotPasswordVerifyAndChange(ctx *gin.Context)
+	ForgotPasswordSend(ctx *gin.Context)
+	ForgotPasswordVerifyAndChange(ctx *gin.Context)
 	EditProfile(ctx *gin.Context)
-	// GetMyReferenceLink(ctx *gin.Context)
+	GetReferralDashboard(ctx *gin.Context)
 }
 
 type userHandler struct {
@@ -55,7 +58,7 @@ func (h *userHandler) Register(ctx *gin.Context) {
 	// Get the reference from the query
 	ref := ctx.Query("reference")
 	// Perform register operation
-	result, err := h.userService.Register(user, ref)
+	result, err := h.userService.Register(user, ref, deviceInfo(ctx))
 	if err != nil {
 		errRes := response.ClientErrorResponse("Không thể đăng ký tài khoản", nil, err)
 		ctx.JSON(http.StatusBadRequest, errRes)
@@ -82,7 +85,7 @@ func (h *userHandler) Login(ctx *gin.Context) {
 		return
 	}
 	// Perform login operation
-	result, err := h.userService.Login(user)
+	result, err := h.userService.Login(user, deviceInfo(ctx))
 	if err != nil {
 		errRes := response.ClientErrorResponse("Không thể đăng nhập", nil, err)
 		ctx.JSON(errRes.StatusCode, errRes)
@@ -93,6 +96,69 @@ func (h *userHandler) Login(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
+func (h *userHandler) RefreshToken(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.RefreshTokenRequest
+	if err := ctx.BindJSON(&model); err != nil {
+		errRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(errRes.StatusCode, errRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(errRes.StatusCode, errRes)
+		return
+	}
+	// Perform refresh token operation, the refresh token is replaced on every use
+	result, err := h.userService.RefreshTokens(model.RefreshToken, deviceInfo(ctx))
+	if err != nil {
+		errRes := response.ClientErrorResponse("Không thể làm mới token", nil, err)
+		ctx.JSON(errRes.StatusCode, errRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Làm mới token thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *userHandler) Logout(ctx *gin.Context) {
+	// Get the user id and the session from the context
+	user_id := ctx.MustGet("id").(int)
+	session_id := ctx.MustGet("session_id").(string)
+	// Perform logout operation
+	if err := h.userService.Logout(uint(user_id), session_id); err != nil {
+		errRes := response.ClientErrorResponse("Không thể đăng xuất", nil, err)
+		ctx.JSON(errRes.StatusCode, errRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đăng xuất thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *userHandler) LogoutAll(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Perform logout operation on every device
+	if err := h.userService.LogoutAll(uint(user_id)); err != nil {
+		errRes := response.ClientErrorResponse("Không thể đăng xuất khỏi tất cả thiết bị", nil, err)
+		ctx.JSON(errRes.StatusCode, errRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đăng xuất khỏi tất cả thiết bị thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+// deviceInfo returns the device a login session is started from.
+func deviceInfo(ctx *gin.Context) models.DeviceInfo {
+	return models.DeviceInfo{
+		UserAgent: ctx.Request.UserAgent(),
+		ClientIP:  ctx.ClientIP(),
+	}
+}
+
 func (i *userHandler) AddAddress(ctx *gin.Context) {
 	// Get the user id from the context
 	user_id := ctx.MustGet("id").(int)
@@ -223,46 +289,55 @@ func (i *userHandler) ChangePassword(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
-// func (i *userHandler) ForgotPasswordSend(ctx *gin.Context) {
-
-// 	var model models.ForgotPasswordSend
-// 	if err := ctx.BindJSON(&model); err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Fields provided are in wrong format", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-// 	err := i.userService.ForgotPasswordSend(model.Phone)
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Could not send OTP", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	successRes := response.ClientResponse(http.StatusOK, "OTP sent successfully", nil, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
-
-// }
-
-// func (i *userHandler) ForgotPasswordVerifyAndChange(ctx *gin.Context) {
-
-// 	var model models.ForgotVerify
-// 	if err := ctx.BindJSON(&model); err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Fields provided are in wrong format", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	err := i.userService.ForgotPasswordVerifyAndChange(model)
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "Could not verify OTP", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	successRes := response.ClientResponse(http.StatusOK, "Successfully Changed the password", nil, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
+func (i *userHandler) ForgotPasswordSend(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.OtpContact
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform send otp operation
+	if err := i.userService.ForgotPasswordSend(model); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể gửi mã xác thực", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Mã xác thực đã được gửi nếu tài khoản tồn tại", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
-// }
+func (i *userHandler) ForgotPasswordVerifyAndChange(ctx *gin.Context) {
+	// Bind the request body to the model
+	var model models.ForgotVerify
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform reset password operation
+	if err := i.userService.ForgotPasswordVerifyAndChange(model); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể đặt lại mật khẩu", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Đặt lại mật khẩu thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
 
 func (i *userHandler) EditProfile(ctx *gin.Context) {
 	// Get the user id from the context
@@ -286,20 +361,30 @@ func (i *userHandler) EditProfile(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, successRes)
 }
 
-// func (i *userHandler) GetMyReferenceLink(ctx *gin.Context) {
-// 	id, err := strconv.Atoi(ctx.Query("id"))
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "check parameters properly", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-
-// 	link, err := i.userService.GetMyReferenceLink(id)
-// 	if err != nil {
-// 		errorRes := response.ClientResponse(http.StatusBadRequest, "could not retrieve referral link", nil, err.Error())
-// 		ctx.JSON(http.StatusBadRequest, errorRes)
-// 		return
-// 	}
-// 	successRes := response.ClientResponse(http.StatusOK, "Successfully got all products in cart", link, nil)
-// 	ctx.JSON(http.StatusOK, successRes)
-// }
+func (h *userHandler) GetReferralDashboard(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get referral dashboard operation
+	result, err := h.userService.GetReferralDashboard(uint(user_id), limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin giới thiệu", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin giới thiệu thành công", result, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
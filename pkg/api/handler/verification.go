@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type VerificationHandler interface {
+	SendVerification(ctx *gin.Context)
+	VerifyEmail(ctx *gin.Context)
+	VerifyEmailLink(ctx *gin.Context)
+}
+
+type verificationHandler struct {
+	verificationService services.VerificationService
+}
+
+func NewVerificationHandler(service services.VerificationService) VerificationHandler {
+	return &verificationHandler{
+		verificationService: service,
+	}
+}
+
+func (h *verificationHandler) SendVerification(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Perform send verification operation
+	if err := h.verificationService.SendVerification(uint(user_id)); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể gửi email xác thực", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Gửi email xác thực thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *verificationHandler) VerifyEmail(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Bind the request body to the model
+	var model models.VerifyEmail
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform verify email operation
+	if err := h.verificationService.VerifyEmail(uint(user_id), model.Otp); err != nil {
+		errorRes := response.ClientErrorResponse("Không thể xác thực email", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xác thực email thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *verificationHandler) VerifyEmailLink(ctx *gin.Context) {
+	// Get the token from the query
+	token := ctx.Query("token")
+	if token == "" {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, models.ErrBadRequest)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform verify email operation
+	if err := h.verificationService.VerifyEmailLink(token); err != nil {
+		errorRes := response.ClientErrorResponse("Liên kết xác thực không hợp lệ hoặc đã hết hạn", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Xác thực email thành công", nil, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
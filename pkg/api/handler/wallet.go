@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	services "ahava/pkg/service"
+	models "ahava/pkg/utils/models"
+	response "ahava/pkg/utils/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type WalletHandler interface {
+	GetWallet(ctx *gin.Context)
+	GetUserWallet(ctx *gin.Context)
+	AdjustWallet(ctx *gin.Context)
+}
+
+type walletHandler struct {
+	walletService services.WalletService
+}
+
+func NewWalletHandler(service services.WalletService) WalletHandler {
+	return &walletHandler{
+		walletService: service,
+	}
+}
+
+func (h *walletHandler) GetWallet(ctx *gin.Context) {
+	// Get the user id from the context
+	user_id := ctx.MustGet("id").(int)
+	// Get the wallet of the user
+	h.getWallet(ctx, uint(user_id))
+}
+
+func (h *walletHandler) GetUserWallet(ctx *gin.Context) {
+	// Get the user id from the params
+	user_id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Get the wallet of the user
+	h.getWallet(ctx, uint(user_id))
+}
+
+func (h *walletHandler) getWallet(ctx *gin.Context, user_id uint) {
+	// Get the limit and offset from the query
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request query problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform get wallet operation
+	wallet, err := h.walletService.GetWallet(user_id, limit, offset)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể lấy thông tin ví", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusOK, "Lấy thông tin ví thành công", wallet, nil)
+	ctx.JSON(http.StatusOK, successRes)
+}
+
+func (h *walletHandler) AdjustWallet(ctx *gin.Context) {
+	// Get the admin id from the context
+	admin_id := ctx.MustGet("id").(int)
+	// Get the user id from the params
+	user_id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Request parameter problem", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Bind the request body to the model
+	var model models.WalletAdjustment
+	if err := ctx.BindJSON(&model); err != nil {
+		errorRes := response.ClientErrorResponse("Fields provided are in wrong format", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Validate the model
+	if err := validator.New().Struct(model); err != nil {
+		errorRes := response.ClientErrorResponse("Constraints are not satisfied", nil, err)
+		ctx.JSON(http.StatusBadRequest, errorRes)
+		return
+	}
+	// Perform adjust wallet operation
+	result, err := h.walletService.AdjustWallet(uint(user_id), uint(admin_id), model)
+	if err != nil {
+		errorRes := response.ClientErrorResponse("Không thể điều chỉnh số dư ví", nil, err)
+		ctx.JSON(errorRes.StatusCode, errorRes)
+		return
+	}
+	// Return the response
+	successRes := response.ClientResponse(http.StatusCreated, "Điều chỉnh số dư ví thành công", result, nil)
+	ctx.JSON(http.StatusCreated, successRes)
+}
@@ -1,34 +1,65 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
+	"ahava/pkg/helper"
+	"ahava/pkg/utils/models"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
-func AdminAuthMiddleware(ctx *gin.Context) {
-
-	accessToken := ctx.Request.Header.Get("Authorization")
+// SessionChecker tells whether the login session of an access token is still active.
+type SessionChecker interface {
+	CheckSession(role string, subject_id uint, session_id string) (bool, error)
+}
 
-	accessToken = strings.TrimPrefix(accessToken, "Bearer ")
+// AdminAuthMiddleware lets through requests with a valid admin access token and sets the
+// id, email, role and session of the admin in the context.
+func AdminAuthMiddleware(h helper.Helper, sessions SessionChecker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authenticate(ctx, h, sessions, models.RoleAdmin)
+	}
+}
 
-	_, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte("accesssecret"), nil
-	})
-	if err != nil {
-		// The access token is invalid.
-		fmt.Println("error catches here")
-		ctx.AbortWithStatus(401)
-		return
+// UserAuthMiddleware lets through requests with a valid customer access token and sets
+// the id, email, role and session of the customer in the context.
+func UserAuthMiddleware(h helper.Helper, sessions SessionChecker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authenticate(ctx, h, sessions, models.RoleClient)
 	}
+}
 
-	ctx.Next()
+// OptionalUserAuthMiddleware lets every request through, setting the id, email, role and
+// session of the customer in the context when a valid customer access token is given.
+// Requests with a missing, invalid or revoked token go on as anonymous ones.
+func OptionalUserAuthMiddleware(h helper.Helper, sessions SessionChecker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenString := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			ctx.Next()
+			return
+		}
+		claims, err := h.ValidateToken(tokenString, models.RoleClient, models.TokenTypeAccess)
+		if err != nil {
+			ctx.Next()
+			return
+		}
+		active, err := sessions.CheckSession(models.RoleClient, claims.ID, claims.SessionID)
+		if err != nil || !active {
+			ctx.Next()
+			return
+		}
+		ctx.Set("id", int(claims.ID))
+		ctx.Set("email", claims.Email)
+		ctx.Set("role", claims.Role)
+		ctx.Set("session_id", claims.SessionID)
+		ctx.Next()
+	}
 }
 
-func UserAuthMiddleware(ctx *gin.Context) {
+func authenticate(ctx *gin.Context, h helper.Helper, sessions SessionChecker, role string) {
 	tokenString := ctx.GetHeader("Authorization")
 	if tokenString == "" {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization token"})
@@ -37,42 +68,65 @@ func UserAuthMiddleware(ctx *gin.Context) {
 	}
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-
-		return []byte("ahava"), nil
-	})
-
-	if err != nil || !token.Valid {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
+	claims, err := h.ValidateToken(tokenString, role, models.TokenTypeAccess)
+	if err == models.ErrForbidden {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
 		ctx.Abort()
 		return
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	if err != nil {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
 		ctx.Abort()
 		return
 	}
 
-	fmt.Println("claims", claims)
-
-	role, ok := claims["role"].(string)
-	if !ok || role != "client" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+	// Tokens of sessions that were logged out or revoked are rejected
+	active, err := sessions.CheckSession(role, claims.ID, claims.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check the session"})
 		ctx.Abort()
 		return
 	}
-
-	id, ok := claims["id"].(float64)
-	if !ok || id == 0 {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "error in retrieving id"})
+	if !active {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
 		ctx.Abort()
 		return
 	}
 
-	ctx.Set("role", role)
-	ctx.Set("id", int(id))
+	ctx.Set("id", int(claims.ID))
+	ctx.Set("email", claims.Email)
+	ctx.Set("role", claims.Role)
+	ctx.Set("session_id", claims.SessionID)
+	if role == models.RoleAdmin {
+		ctx.Set("staff_role", claims.StaffRole)
+		ctx.Set("must_change_password", claims.MustChangePassword)
+	}
 
 	ctx.Next()
 }
+
+// RequirePasswordChanged stops admins who have to change their password from doing
+// anything else. It runs after AdminAuthMiddleware.
+func RequirePasswordChanged() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetBool("must_change_password") {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Password must be changed"})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequirePermission lets through admins whose staff role has the permission. It runs
+// after AdminAuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !models.HasPermission(ctx.GetString("staff_role"), permission) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -2,13 +2,16 @@ package http
 
 import (
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	handler "ahava/pkg/api/handler"
 	"ahava/pkg/api/middleware"
+	"ahava/pkg/helper"
 	"ahava/pkg/routes"
+	services "ahava/pkg/service"
 )
 
 type ServerHTTP struct {
@@ -19,15 +22,23 @@ func NewServerHTTP(
 	userHandler handler.UserHandler,
 	adminHandler handler.AdminHandler,
 	productHandler handler.ProductHandler,
-	// otpHandler handler.OtpHandler,
+	otpHandler handler.OtpHandler,
+	verificationHandler handler.VerificationHandler,
 	orderHandler handler.OrderHandler,
 	cartHandler handler.CartHandler,
-	// couponHandler handler.CouponHandler,
 	paymentHandler handler.PaymentHandler,
-	// offerhandler handler.OfferHandler,
 	wishlistHandler handler.WishlistHandler,
 	newsHandler handler.NewsHandler,
 	uploadHandler handler.UploadHandler,
+	couponHandler handler.CouponHandler,
+	offerHandler handler.OfferHandler,
+	refundHandler handler.RefundHandler,
+	walletHandler handler.WalletHandler,
+	loyaltyHandler handler.LoyaltyHandler,
+	categoryHandler handler.CategoryHandler,
+	h helper.Helper,
+	tokenService services.TokenService,
+	loyaltyService services.LoyaltyService,
 	db *gorm.DB,
 ) *ServerHTTP {
 
@@ -37,29 +48,42 @@ func NewServerHTTP(
 	engine.Use(middleware.DefaultStructuredLogger())
 	// engine.Use(gin.Logger())
 	go middleware.SaveRequestTransaction(db)
+	go services.ExpireLoyaltyPoints(loyaltyService, time.Hour)
 
 	engine.GET("/validate-token", adminHandler.ValidateRefreshTokenAndCreateNewAccess)
 
 	routes.UserRoutes(engine.Group("/api"),
+		middleware.UserAuthMiddleware(h, tokenService),
+		middleware.OptionalUserAuthMiddleware(h, tokenService),
 		userHandler,
-		// otpHandler,
+		otpHandler,
+		verificationHandler,
 		productHandler,
 		orderHandler,
 		cartHandler,
 		paymentHandler,
 		wishlistHandler,
 		newsHandler,
-		// couponHandler,
+		couponHandler,
+		offerHandler,
+		walletHandler,
+		loyaltyHandler,
+		categoryHandler,
 	)
 	routes.AdminRoutes(engine.Group("/admin"),
+		middleware.AdminAuthMiddleware(h, tokenService),
 		adminHandler,
 		productHandler,
 		userHandler,
 		uploadHandler,
 		orderHandler,
 		newsHandler,
-		// couponHandler,
-		// offerhandler,
+		couponHandler,
+		offerHandler,
+		paymentHandler,
+		refundHandler,
+		walletHandler,
+		categoryHandler,
 	)
 
 	return &ServerHTTP{engine: engine}
@@ -1,25 +1,49 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DBHost     string `mapstructure:"DB_HOST"`
-	DBName     string `mapstructure:"DB_NAME"`
-	DBUser     string `mapstructure:"DB_USER"`
-	DBPort     string `mapstructure:"DB_PORT"`
-	DBPassword string `mapstructure:"DB_PASSWORD"`
-	// AUTHTOKEN               string `mapstructure:"DB_AUTHTOKEN"`
-	// ACCOUNTSID              string `mapstructure:"DB_ACCOUNTSID"`
-	// SERVICESID              string `mapstructure:"DB_SERVICESID"`
-	MINIO_ENDPOINT          string `mapstructure:"MINIO_ENDPOINT"`
-	MINIO_ENDPOINT_PUBLIC   string `mapstructure:"MINIO_ENDPOINT_PUBLIC"`
-	MINIO_ACCESS_KEY_ID     string `mapstructure:"MINIO_ACCESS_KEY_ID"`
-	MINIO_SECRET_ACCESS_KEY string `mapstructure:"MINIO_SECRET_ACCESS_KEY"`
+	DBHost                     string `mapstructure:"DB_HOST"`
+	DBName                     string `mapstructure:"DB_NAME"`
+	DBUser                     string `mapstructure:"DB_USER"`
+	DBPort                     string `mapstructure:"DB_PORT"`
+	DBPassword                 string `mapstructure:"DB_PASSWORD"`
+	MINIO_ENDPOINT             string `mapstructure:"MINIO_ENDPOINT"`
+	MINIO_ENDPOINT_PUBLIC      string `mapstructure:"MINIO_ENDPOINT_PUBLIC"`
+	MINIO_ACCESS_KEY_ID        string `mapstructure:"MINIO_ACCESS_KEY_ID"`
+	MINIO_SECRET_ACCESS_KEY    string `mapstructure:"MINIO_SECRET_ACCESS_KEY"`
+	SEPAY_ACCOUNT_NUMBER       string `mapstructure:"SEPAY_ACCOUNT_NUMBER"`
+	SEPAY_BANK_NAME            string `mapstructure:"SEPAY_BANK_NAME"`
+	SEPAY_WEBHOOK_API_KEY      string `mapstructure:"SEPAY_WEBHOOK_API_KEY"`
+	SEPAY_WEBHOOK_SECRET       string `mapstructure:"SEPAY_WEBHOOK_SECRET"`
+	PAYMENT_GATEWAY_NAME       string `mapstructure:"PAYMENT_GATEWAY_NAME"`
+	PAYMENT_GATEWAY_URL        string `mapstructure:"PAYMENT_GATEWAY_URL"`
+	PAYMENT_GATEWAY_MERCHANT   string `mapstructure:"PAYMENT_GATEWAY_MERCHANT"`
+	PAYMENT_GATEWAY_SECRET     string `mapstructure:"PAYMENT_GATEWAY_SECRET"`
+	PAYMENT_GATEWAY_RETURN_URL string `mapstructure:"PAYMENT_GATEWAY_RETURN_URL"`
+	JWT_KEYS                   string `mapstructure:"JWT_KEYS"`
+	JWT_ACTIVE_KID             string `mapstructure:"JWT_ACTIVE_KID"`
+	SMTP_HOST                  string `mapstructure:"SMTP_HOST"`
+	SMTP_PORT                  string `mapstructure:"SMTP_PORT"`
+	SMTP_USERNAME              string `mapstructure:"SMTP_USERNAME"`
+	SMTP_PASSWORD              string `mapstructure:"SMTP_PASSWORD"`
+	SMTP_FROM                  string `mapstructure:"SMTP_FROM"`
+	TWILIO_ACCOUNT_SID         string `mapstructure:"TWILIO_ACCOUNT_SID"`
+	TWILIO_AUTH_TOKEN          string `mapstructure:"TWILIO_AUTH_TOKEN"`
+	TWILIO_FROM_NUMBER         string `mapstructure:"TWILIO_FROM_NUMBER"`
+	NOTIFY_LOG_FILE            string `mapstructure:"NOTIFY_LOG_FILE"`
+	API_BASE_URL               string `mapstructure:"API_BASE_URL"`
+	WEB_BASE_URL               string `mapstructure:"WEB_BASE_URL"`
+	ADMIN_NAME                 string `mapstructure:"ADMIN_NAME"`
+	ADMIN_EMAIL                string `mapstructure:"ADMIN_EMAIL"`
+	ADMIN_PASSWORD             string `mapstructure:"ADMIN_PASSWORD"`
 }
 
 var envs = []string{
@@ -28,13 +52,35 @@ var envs = []string{
 	"DB_USER",
 	"DB_PORT",
 	"DB_PASSWORD",
-	// "DB_AUTHTOKEN",
-	// "DB_ACCOUNTSID",
-	// "DB_SERVICESID",
 	"MINIO_ENDPOINT",
 	"MINIO_ENDPOINT_PUBLIC",
 	"MINIO_ACCESS_KEY_ID",
 	"MINIO_SECRET_ACCESS_KEY",
+	"SEPAY_ACCOUNT_NUMBER",
+	"SEPAY_BANK_NAME",
+	"SEPAY_WEBHOOK_API_KEY",
+	"SEPAY_WEBHOOK_SECRET",
+	"PAYMENT_GATEWAY_NAME",
+	"PAYMENT_GATEWAY_URL",
+	"PAYMENT_GATEWAY_MERCHANT",
+	"PAYMENT_GATEWAY_SECRET",
+	"PAYMENT_GATEWAY_RETURN_URL",
+	"JWT_KEYS",
+	"JWT_ACTIVE_KID",
+	"SMTP_HOST",
+	"SMTP_PORT",
+	"SMTP_USERNAME",
+	"SMTP_PASSWORD",
+	"SMTP_FROM",
+	"TWILIO_ACCOUNT_SID",
+	"TWILIO_AUTH_TOKEN",
+	"TWILIO_FROM_NUMBER",
+	"NOTIFY_LOG_FILE",
+	"API_BASE_URL",
+	"WEB_BASE_URL",
+	"ADMIN_NAME",
+	"ADMIN_EMAIL",
+	"ADMIN_PASSWORD",
 }
 
 func LoadConfig() (Config, error) {
@@ -56,7 +102,45 @@ func LoadConfig() (Config, error) {
 		return config, err
 	}
 
-	fmt.Println(config)
+	if _, _, err := config.JWTKeys(); err != nil {
+		return config, err
+	}
 
 	return config, nil
 }
+
+// minJWTSecretLength is the shortest secret accepted to sign tokens.
+const minJWTSecretLength = 32
+
+// JWTKeys parses JWT_KEYS, a comma separated list of kid:secret pairs, and returns the
+// secrets by kid with the kid to sign new tokens with: JWT_ACTIVE_KID, or the first key.
+// Tokens signed with any of the keys are accepted, so a key is rotated by adding a new
+// one, making it active and removing the old one once its tokens have expired.
+func (c Config) JWTKeys() (map[string][]byte, string, error) {
+	keys := make(map[string][]byte)
+	active := c.JWT_ACTIVE_KID
+	for idx, pair := range strings.Split(c.JWT_KEYS, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, found := strings.Cut(pair, ":")
+		if !found || kid == "" {
+			return nil, "", fmt.Errorf("JWT_KEYS: entry %d is not a kid:secret pair", idx+1)
+		}
+		if len(secret) < minJWTSecretLength {
+			return nil, "", fmt.Errorf("JWT_KEYS: the secret of %q must be at least %d characters", kid, minJWTSecretLength)
+		}
+		keys[kid] = []byte(secret)
+		if active == "" {
+			active = kid
+		}
+	}
+	if len(keys) == 0 {
+		return nil, "", errors.New("JWT_KEYS: no key configured")
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, "", fmt.Errorf("JWT_ACTIVE_KID: no key %q in JWT_KEYS", active)
+	}
+	return keys, active, nil
+}
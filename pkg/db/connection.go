@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"log"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
@@ -9,6 +10,7 @@ import (
 
 	config "ahava/pkg/config"
 	domain "ahava/pkg/domain"
+	models "ahava/pkg/utils/models"
 )
 
 func ConnectDatabase(cfg config.Config) (*gorm.DB, error) {
@@ -17,16 +19,43 @@ func ConnectDatabase(cfg config.Config) (*gorm.DB, error) {
 
 	db = db.Debug()
 
-	if err := db.AutoMigrate(domain.Product{}); err != nil {
+	if err := db.AutoMigrate(domain.Category{}); err != nil {
 		return db, err
 	}
-	if err := db.AutoMigrate(domain.Price{}); err != nil {
+	if err := migrateProductCategories(db); err != nil {
 		return db, err
 	}
-	if err := db.AutoMigrate(domain.User{}); err != nil {
+	if err := migrateProductSearch(db); err != nil {
 		return db, err
 	}
-	if err := db.AutoMigrate(domain.Admin{}); err != nil {
+	if err := migratePriceStock(db); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.StockMovement{}); err != nil {
+		return db, err
+	}
+	if err := migrateOfferCategories(db); err != nil {
+		return db, err
+	}
+	if err := migrateUsers(db); err != nil {
+		return db, err
+	}
+	if err := migrateAdmins(db); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.RefreshToken{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.LoginAttempt{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.Otp{}); err != nil {
+		return db, err
+	}
+	if err := refreshCheckConstraint(db, &domain.Otp{}, "chk_otps_purpose"); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.Referral{}); err != nil {
 		return db, err
 	}
 	if err := db.AutoMigrate(domain.CartItem{}); err != nil {
@@ -35,7 +64,7 @@ func ConnectDatabase(cfg config.Config) (*gorm.DB, error) {
 	if err := db.AutoMigrate(domain.Address{}); err != nil {
 		return db, err
 	}
-	if err := db.AutoMigrate(domain.Order{}); err != nil {
+	if err := migrateOrderPayments(db); err != nil {
 		return db, err
 	}
 	if err := db.AutoMigrate(domain.PaymentMethod{}); err != nil {
@@ -44,45 +73,351 @@ func ConnectDatabase(cfg config.Config) (*gorm.DB, error) {
 	if err := db.AutoMigrate(domain.OrderItem{}); err != nil {
 		return db, err
 	}
-	if err := db.AutoMigrate(domain.Transaction{}); err != nil {
+	if err := db.AutoMigrate(domain.OrderStatusHistory{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.ReturnRequest{}); err != nil {
+		return db, err
+	}
+	if err := migrateTransactions(db); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.WebhookEvent{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.Refund{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.RefundItem{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.Coupons{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.CouponUsage{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.Wallet{}); err != nil {
+		return db, err
+	}
+	// A referral is credited again if its reward is taken back and earned once more
+	if err := dropUniqueIndex(db, "idx_wallet_entries_referral_id"); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.WalletEntry{}); err != nil {
+		return db, err
+	}
+	if err := refreshCheckConstraint(db, &domain.WalletEntry{}, "chk_wallet_entries_type"); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.LoyaltyAccount{}); err != nil {
+		return db, err
+	}
+	if err := db.AutoMigrate(domain.LoyaltyEntry{}); err != nil {
 		return db, err
 	}
-	// if err := db.AutoMigrate(domain.Coupons{}); err != nil {
-	// 	return db, err
-	// }
-	// if err := db.AutoMigrate(domain.Wallet{}); err != nil {
-	// 	return db, err
-	// }
 	if err := db.AutoMigrate(domain.Wishlist{}); err != nil {
 		return db, err
 	}
 	if err := db.AutoMigrate(domain.News{}); err != nil {
 		return db, err
 	}
+	if err := db.AutoMigrate(domain.SearchHistory{}); err != nil {
+		return db, err
+	}
 	if err := db.AutoMigrate(domain.RequestTransaction{}); err != nil {
 		return db, err
 	}
-	CheckAndCreateAdmin(db)
+	CheckAndCreateAdmin(db, cfg)
+	CheckAndCreatePaymentMethods(db)
 
 	return db, dbErr
 }
 
-func CheckAndCreateAdmin(db *gorm.DB) {
-	var count int64
-	db.Model(&domain.Admin{}).Count(&count)
-	if count == 0 {
-		password := "Admin@123qaz"
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		if err != nil {
-			return
+// migratePriceStock migrates the prices table and, when the stock column is new,
+// copies the old per-product stock into every size of the product.
+func migratePriceStock(db *gorm.DB) error {
+	hasStock := db.Migrator().HasColumn(&domain.Price{}, "stock")
+	if err := db.AutoMigrate(domain.Price{}); err != nil {
+		return err
+	}
+	if hasStock || !db.Migrator().HasColumn(&domain.Product{}, "stock") {
+		return nil
+	}
+	return db.Exec(`UPDATE prices SET stock = products.stock FROM products WHERE prices.product_id = products.id`).Error
+}
+
+// migrateProductCategories migrates the products table and links the products still
+// without a category to the category of the same name, creating it when needed.
+func migrateProductCategories(db *gorm.DB) error {
+	if err := db.AutoMigrate(domain.Product{}); err != nil {
+		return err
+	}
+	var names []string
+	if err := db.Model(&domain.Product{}).
+		Distinct("category").
+		Where("category_id IS NULL AND category <> ''").
+		Pluck("category", &names).Error; err != nil {
+		return err
+	}
+	for _, name := range names {
+		var category domain.Category
+		if err := db.Where("name = ?", name).Order("id ASC").Limit(1).Find(&category).Error; err != nil {
+			return err
+		}
+		if category.ID == 0 {
+			slug, err := uniqueCategorySlug(db, models.Slugify(name))
+			if err != nil {
+				return err
+			}
+			category = domain.Category{Name: name, Slug: slug}
+			if err := db.Create(&category).Error; err != nil {
+				return err
+			}
 		}
+		if err := db.Model(&domain.Product{}).
+			Where("category_id IS NULL AND category = ?", name).
+			Update("category_id", category.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		admin := domain.Admin{
-			ID:       1,
-			Name:     "AHAVA Admin",
-			Email:    "admin@ahava.com.vn",
-			Password: string(hashedPassword),
+// migrateOfferCategories migrates the offers table and links the category offers still
+// without a category to the category of the same slug or else of the same name. Offers
+// whose name matches several categories or none are left unlinked and do not run.
+func migrateOfferCategories(db *gorm.DB) error {
+	if err := db.AutoMigrate(domain.Offer{}); err != nil {
+		return err
+	}
+	var keys []string
+	if err := db.Model(&domain.Offer{}).
+		Distinct("category").
+		Where("scope = ? AND category_id IS NULL AND category <> ''", models.OfferScopeCategory).
+		Pluck("category", &keys).Error; err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var categories []domain.Category
+		if err := db.Where("slug = ?", key).Limit(1).Find(&categories).Error; err != nil {
+			return err
+		}
+		if len(categories) == 0 {
+			if err := db.Where("name = ?", key).Limit(2).Find(&categories).Error; err != nil {
+				return err
+			}
+		}
+		if len(categories) != 1 {
+			continue
 		}
-		db.Create(&admin)
+		if err := db.Model(&domain.Offer{}).
+			Where("scope = ? AND category_id IS NULL AND category = ?", models.OfferScopeCategory, key).
+			Updates(map[string]interface{}{
+				"category_id": categories[0].ID,
+				"category":    categories[0].Name,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueCategorySlug numbers the slug when another category has it.
+func uniqueCategorySlug(db *gorm.DB, slug string) (string, error) {
+	if slug == "" {
+		slug = "danh-muc"
+	}
+	candidate := slug
+	for i := 2; ; i++ {
+		var count int64
+		if err := db.Model(&domain.Category{}).Where("slug = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+}
+
+// migrateProductSearch sets up the full text search of products. The ahava_search
+// configuration folds the diacritics, so "sua rua mat" finds "sữa rửa mặt", and the
+// search_vector and name_vector columns are generated by the database, they are not
+// part of domain.Product so GORM never writes them.
+func migrateProductSearch(db *gorm.DB) error {
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS unaccent`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'ahava_search') THEN
+			CREATE TEXT SEARCH CONFIGURATION ahava_search (COPY = simple);
+			ALTER TEXT SEARCH CONFIGURATION ahava_search
+				ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+		END IF;
+	END $$`).Error; err != nil {
+		return err
+	}
+	// The name and code weigh the most, then the tag and the descriptions
+	if err := db.Exec(`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('ahava_search', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('ahava_search', coalesce(code, '')), 'A') ||
+			setweight(to_tsvector('ahava_search', coalesce(tag, '')), 'B') ||
+			setweight(to_tsvector('ahava_search', coalesce(short_description, '')), 'C') ||
+			setweight(to_tsvector('ahava_search', coalesce(description, '')), 'D')
+		) STORED`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`).Error; err != nil {
+		return err
+	}
+	// The suggestions only look at the name and category
+	if err := db.Exec(`ALTER TABLE products ADD COLUMN IF NOT EXISTS name_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('ahava_search', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('ahava_search', coalesce(category, '')), 'B')
+		) STORED`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE INDEX IF NOT EXISTS idx_products_name_vector ON products USING GIN (name_vector)`).Error
+}
+
+// migrateUsers migrates the users table. Customers who signed up before emails were
+// verified keep checking out, their emails are marked verified when the column is new.
+func migrateUsers(db *gorm.DB) error {
+	hasTable := db.Migrator().HasTable(&domain.User{})
+	hasEmailVerified := db.Migrator().HasColumn(&domain.User{}, "email_verified")
+	if err := db.AutoMigrate(domain.User{}); err != nil {
+		return err
+	}
+	if !hasTable || hasEmailVerified {
+		return nil
+	}
+	return db.Exec(`UPDATE users SET email_verified = true, email_verified_at = created_at`).Error
+}
+
+// migrateAdmins migrates the admins table. Admins created before staff roles existed
+// become owners and, as they may still use the old default password, have to change
+// their password.
+func migrateAdmins(db *gorm.DB) error {
+	hasTable := db.Migrator().HasTable(&domain.Admin{})
+	hasMustChange := db.Migrator().HasColumn(&domain.Admin{}, "must_change_password")
+	if err := db.AutoMigrate(domain.Admin{}); err != nil {
+		return err
+	}
+	if !hasTable || hasMustChange {
+		return nil
+	}
+	return db.Exec(`UPDATE admins SET must_change_password = true`).Error
+}
+
+// migrateOrderPayments migrates the orders table, refreshes the payment status check
+// for the new OVERPAID value and, when the paid amount column is new, fills it from
+// the transfers already received.
+func migrateOrderPayments(db *gorm.DB) error {
+	hasPaidAmount := db.Migrator().HasColumn(&domain.Order{}, "paid_amount")
+	if err := db.AutoMigrate(domain.Order{}); err != nil {
+		return err
+	}
+	if err := refreshCheckConstraint(db, &domain.Order{}, "chk_orders_payment_status"); err != nil {
+		return err
+	}
+	if hasPaidAmount || !db.Migrator().HasTable(&domain.Transaction{}) {
+		return nil
+	}
+	return db.Exec(`UPDATE orders SET paid_amount = t.amount
+		FROM (SELECT order_id, SUM(transfer_amount) AS amount FROM transactions WHERE reference_code <> '' GROUP BY order_id) t
+		WHERE orders.id = t.order_id`).Error
+}
+
+// migrateTransactions drops the old one-transaction-per-order constraint, whatever
+// name it was created with, before migrating the transactions table, and marks the
+// existing transactions as SePay ones when the provider column is new.
+func migrateTransactions(db *gorm.DB) error {
+	hasTable := db.Migrator().HasTable(&domain.Transaction{})
+	if hasTable {
+		for _, constraint := range []string{"transactions_order_id_key", "uni_transactions_order_id"} {
+			if err := db.Exec("ALTER TABLE transactions DROP CONSTRAINT IF EXISTS " + constraint).Error; err != nil {
+				return err
+			}
+		}
+	}
+	hasProvider := db.Migrator().HasColumn(&domain.Transaction{}, "provider")
+	if err := db.AutoMigrate(domain.Transaction{}); err != nil {
+		return err
+	}
+	// Transactions recorded before payment providers existed all came from SePay
+	if !hasTable || hasProvider {
+		return nil
+	}
+	return db.Exec(`UPDATE transactions SET provider = 'SEPAY' WHERE provider IS NULL OR provider = ''`).Error
+}
+
+// refreshCheckConstraint recreates a check constraint so changes to its allowed values
+// reach existing databases.
+func refreshCheckConstraint(db *gorm.DB, model interface{}, name string) error {
+	if db.Migrator().HasConstraint(model, name) {
+		if err := db.Migrator().DropConstraint(model, name); err != nil {
+			return err
+		}
+	}
+	return db.Migrator().CreateConstraint(model, name)
+}
+
+// dropUniqueIndex drops the index if it is unique, so AutoMigrate creates it again as
+// declared by the model.
+func dropUniqueIndex(db *gorm.DB, name string) error {
+	var count int64
+	if err := db.Raw(`SELECT COUNT(*) FROM pg_indexes
+		WHERE schemaname = current_schema() AND indexname = ? AND indexdef LIKE 'CREATE UNIQUE INDEX%'`, name).
+		Scan(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return db.Exec("DROP INDEX " + name).Error
+}
+
+// CheckAndCreateAdmin creates the first owner of a new database from ADMIN_EMAIL and
+// ADMIN_PASSWORD. The owner has to change the password on first login and can then
+// create the other staff accounts.
+func CheckAndCreateAdmin(db *gorm.DB, cfg config.Config) {
+	var count int64
+	db.Model(&domain.Admin{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	if cfg.ADMIN_EMAIL == "" || cfg.ADMIN_PASSWORD == "" {
+		log.Println("No admin account exists. Set ADMIN_EMAIL and ADMIN_PASSWORD to create the first owner.")
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.ADMIN_PASSWORD), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	name := cfg.ADMIN_NAME
+	if name == "" {
+		name = "AHAVA Admin"
+	}
+	db.Create(&domain.Admin{
+		Name:               name,
+		Email:              cfg.ADMIN_EMAIL,
+		Password:           string(hashedPassword),
+		Role:               models.AdminRoleOwner,
+		MustChangePassword: true,
+	})
+}
+
+// CheckAndCreatePaymentMethods enables the built-in payment providers on a new database.
+func CheckAndCreatePaymentMethods(db *gorm.DB) {
+	var count int64
+	db.Model(&domain.PaymentMethod{}).Count(&count)
+	if count == 0 {
+		db.Create(&[]domain.PaymentMethod{
+			{PaymentName: models.PaymentMethodSePay, Enable: true},
+			{PaymentName: models.PaymentMethodCOD, Enable: true},
+		})
 	}
 }
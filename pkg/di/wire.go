@@ -22,34 +22,62 @@ func InitializeAPI(cfg config.Config) (*http.ServerHTTP, error) {
 		repository.NewUserRepository,
 		repository.NewAdminRepository,
 		repository.NewProductRepository,
-		// repository.NewOfferRepository,
+		repository.NewOfferRepository,
 		repository.NewWishlistRepository,
 		repository.NewCartRepository,
 		repository.NewOrderRepository,
 		repository.NewPaymentRepository,
 		repository.NewNewsRepository,
+		repository.NewCouponRepository,
+		repository.NewRefundRepository,
+		repository.NewTokenRepository,
+		repository.NewOtpRepository,
+		repository.NewLoginAttemptRepository,
+		repository.NewReferralRepository,
+		repository.NewWalletRepository,
+		repository.NewLoyaltyRepository,
+		repository.NewSearchRepository,
+		repository.NewCategoryRepository,
 
 		service.NewUserService,
 		service.NewAdminService,
 		service.NewProductService,
-		// service.NewOfferService,
+		service.NewOfferService,
 		service.NewWishlistService,
 		service.NewCartService,
 		service.NewOrderService,
 		service.NewPaymentService,
 		service.NewUploadService,
 		service.NewNewsService,
+		service.NewCouponService,
+		service.NewRefundService,
+		service.NewTokenService,
+		service.NewOtpService,
+		service.NewNotifier,
+		service.NewVerificationService,
+		service.NewLoginAttemptService,
+		service.NewReferralService,
+		service.NewWalletService,
+		service.NewLoyaltyService,
+		service.NewCategoryService,
 
 		handler.NewUserHandler,
 		handler.NewAdminHandler,
 		handler.NewProductHandler,
-		// handler.NewOfferHandler,
+		handler.NewOfferHandler,
 		handler.NewWishlistHandler,
 		handler.NewCartHandler,
 		handler.NewOrderHandler,
 		handler.NewPaymentHandler,
 		handler.NewUploadHandler,
 		handler.NewNewsHandler,
+		handler.NewCouponHandler,
+		handler.NewRefundHandler,
+		handler.NewOtpHandler,
+		handler.NewVerificationHandler,
+		handler.NewWalletHandler,
+		handler.NewLoyaltyHandler,
+		handler.NewCategoryHandler,
 
 		helper.NewHelper,
 
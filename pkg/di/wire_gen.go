@@ -26,22 +26,39 @@ func InitializeAPI(cfg config.Config) (*http.ServerHTTP, error) {
 	}
 	userRepository := repository.NewUserRepository(gormDB)
 	helperHelper := helper.NewHelper(cfg)
-	userService := service.NewUserService(userRepository, cfg, helperHelper)
+	tokenRepository := repository.NewTokenRepository(gormDB)
+	tokenService := service.NewTokenService(tokenRepository, helperHelper)
+	otpRepository := repository.NewOtpRepository(gormDB)
+	notifier := service.NewNotifier(cfg)
+	otpService := service.NewOtpService(otpRepository, notifier, helperHelper, tokenService)
+	verificationService := service.NewVerificationService(userRepository, otpRepository, notifier, helperHelper, cfg)
+	loginAttemptRepository := repository.NewLoginAttemptRepository(gormDB)
+	loginAttemptService := service.NewLoginAttemptService(loginAttemptRepository)
+	referralRepository := repository.NewReferralRepository(gormDB)
+	referralService := service.NewReferralService(referralRepository, helperHelper, cfg)
+	userService := service.NewUserService(userRepository, cfg, helperHelper, tokenService, otpService, verificationService, loginAttemptService, referralService)
 	userHandler := handler.NewUserHandler(userService)
+	otpHandler := handler.NewOtpHandler(otpService)
+	verificationHandler := handler.NewVerificationHandler(verificationService)
 	adminRepository := repository.NewAdminRepository(gormDB)
-	adminService := service.NewAdminService(adminRepository, helperHelper)
+	adminService := service.NewAdminService(adminRepository, helperHelper, tokenService, loginAttemptService, referralService)
 	adminHandler := handler.NewAdminHandler(adminService)
 	productRepository := repository.NewProductRepository(gormDB)
-	productService := service.NewProductService(productRepository, helperHelper)
+	searchRepository := repository.NewSearchRepository(gormDB)
+	productService := service.NewProductService(productRepository, searchRepository, helperHelper)
 	productHandler := handler.NewProductHandler(productService)
 	orderRepository := repository.NewOrderRepository(gormDB)
 	cartRepository := repository.NewCartRepository(gormDB)
-	cartService := service.NewCartService(cartRepository, userRepository)
-	orderService := service.NewOrderService(orderRepository, cartService)
+	couponRepository := repository.NewCouponRepository(gormDB)
+	couponService := service.NewCouponService(couponRepository)
+	loyaltyRepository := repository.NewLoyaltyRepository(gormDB)
+	loyaltyService := service.NewLoyaltyService(loyaltyRepository)
+	cartService := service.NewCartService(cartRepository, userRepository, couponService, loyaltyService)
+	paymentRepository := repository.NewPaymentRepository(gormDB)
+	paymentService := service.NewPaymentService(paymentRepository, orderRepository, cfg)
+	orderService := service.NewOrderService(orderRepository, cartService, paymentService)
 	orderHandler := handler.NewOrderHandler(orderService)
 	cartHandler := handler.NewCartHandler(cartService)
-	paymentRepository := repository.NewPaymentRepository(gormDB)
-	paymentService := service.NewPaymentService(paymentRepository, orderRepository)
 	paymentHandler := handler.NewPaymentHandler(paymentService)
 	wishlistRepository := repository.NewWishlistRepository(gormDB)
 	wishlistService := service.NewWishlistService(wishlistRepository, productRepository)
@@ -51,6 +68,20 @@ func InitializeAPI(cfg config.Config) (*http.ServerHTTP, error) {
 	newsHandler := handler.NewNewsHandler(newsService)
 	uploadService := service.NewUploadService(helperHelper)
 	uploadHandler := handler.NewUploadHandler(uploadService)
-	serverHTTP := http.NewServerHTTP(userHandler, adminHandler, productHandler, orderHandler, cartHandler, paymentHandler, wishlistHandler, newsHandler, uploadHandler, gormDB)
+	couponHandler := handler.NewCouponHandler(couponService)
+	offerRepository := repository.NewOfferRepository(gormDB)
+	offerService := service.NewOfferService(offerRepository, productRepository)
+	offerHandler := handler.NewOfferHandler(offerService)
+	refundRepository := repository.NewRefundRepository(gormDB)
+	refundService := service.NewRefundService(refundRepository, orderRepository, paymentService)
+	refundHandler := handler.NewRefundHandler(refundService)
+	walletRepository := repository.NewWalletRepository(gormDB)
+	walletService := service.NewWalletService(walletRepository)
+	walletHandler := handler.NewWalletHandler(walletService)
+	loyaltyHandler := handler.NewLoyaltyHandler(loyaltyService)
+	categoryRepository := repository.NewCategoryRepository(gormDB)
+	categoryService := service.NewCategoryService(categoryRepository)
+	categoryHandler := handler.NewCategoryHandler(categoryService)
+	serverHTTP := http.NewServerHTTP(userHandler, adminHandler, productHandler, otpHandler, verificationHandler, orderHandler, cartHandler, paymentHandler, wishlistHandler, newsHandler, uploadHandler, couponHandler, offerHandler, refundHandler, walletHandler, loyaltyHandler, categoryHandler, helperHelper, tokenService, loyaltyService, gormDB)
 	return serverHTTP, nil
 }
@@ -14,6 +14,9 @@ type Admin struct {
 	Name     string `json:"name" gorm:"validate:required"`
 	Email    string `json:"email" gorm:"validate:required"`
 	Password string `json:"password" gorm:"validate:required"`
+	Role     string `json:"role" gorm:"not null;default:'OWNER';check:role IN ('OWNER', 'CATALOG_EDITOR', 'ORDER_OPERATOR', 'CONTENT_WRITER', 'FINANCE')"`
+	// MustChangePassword is set for accounts whose password was chosen by someone else
+	MustChangePassword bool `json:"must_change_password" gorm:"not null;default:false"`
 }
 
 type TokenAdmin struct {
@@ -35,9 +38,29 @@ type CartItem struct {
 
 type Coupons struct {
 	gorm.Model
-	Coupon       string `json:"coupon" gorm:"unique;not null"`
-	DiscountRate int    `json:"discount_rate" gorm:"not null"`
-	Valid        bool   `json:"valid" gorm:"default:true"`
+	Coupon            string    `json:"coupon" gorm:"unique;not null"`
+	Type              string    `json:"type" gorm:"default:'PERCENTAGE';check:type IN ('PERCENTAGE', 'FIXED')"`
+	DiscountRate      int       `json:"discount_rate" gorm:"not null"`
+	DiscountAmount    uint64    `json:"discount_amount"`
+	MaxDiscount       uint64    `json:"max_discount"`
+	MinOrderValue     uint64    `json:"min_order_value"`
+	StartAt           time.Time `json:"start_at"`
+	ExpireAt          time.Time `json:"expire_at"`
+	UsageLimit        uint      `json:"usage_limit"`
+	UsageLimitPerUser uint      `json:"usage_limit_per_user"`
+	UsedCount         uint      `json:"used_count" gorm:"default:0"`
+	Valid             bool      `json:"valid" gorm:"default:true"`
+}
+
+type CouponUsage struct {
+	gorm.Model
+	CouponID uint    `json:"coupon_id" gorm:"not null;index"`
+	Coupon   Coupons `json:"-" gorm:"foreignkey:CouponID"`
+	UserID   uint    `json:"user_id" gorm:"not null;index"`
+	User     User    `json:"-" gorm:"foreignkey:UserID"`
+	OrderID  uint    `json:"order_id" gorm:"unique;not null"`
+	Order    Order   `json:"-" gorm:"foreignkey:OrderID;constraint:OnDelete:CASCADE"`
+	Discount uint64  `json:"discount" gorm:"not null"`
 }
 
 type PaymentMethod struct {
@@ -48,16 +71,20 @@ type PaymentMethod struct {
 
 type Order struct {
 	gorm.Model
-	UserID        uint   `json:"user_id" gorm:"not null"`
-	User          User   `json:"-" gorm:"foreignkey:UserID"`
-	Name          string `json:"name" gorm:"not null"`
-	Phone         string `json:"phone" gorm:"not null"`
-	Address       string `json:"address" gorm:"not null"`
-	PaymentMethod string `json:"payment_method"`
-	Coupon        string `json:"coupon" gorm:"default:null"`
-	FinalPrice    uint64 `json:"price" gorm:"not null"`
-	OrderStatus   string `json:"order_status" gorm:"order_status:10;default:'UNCONFIRMED';check:order_status IN ('UNCONFIRMED', 'PREPARING','SHIPPING','DELIVERED','CANCELED','RETURNED')"`
-	PaymentStatus string `json:"payment_status" gorm:"payment_status:2;default:'NOT PAID';check:payment_status IN ('PAID', 'NOT PAID', 'INCOMPLETE')"`
+	UserID         uint   `json:"user_id" gorm:"not null"`
+	User           User   `json:"-" gorm:"foreignkey:UserID"`
+	Name           string `json:"name" gorm:"not null"`
+	Phone          string `json:"phone" gorm:"not null"`
+	Address        string `json:"address" gorm:"not null"`
+	PaymentMethod  string `json:"payment_method"`
+	Coupon         string `json:"coupon" gorm:"default:null"`
+	CouponDiscount uint64 `json:"coupon_discount" gorm:"default:0"`
+	TierDiscount   uint64 `json:"tier_discount" gorm:"default:0"`
+	FinalPrice     uint64 `json:"price" gorm:"not null"`
+	PaidAmount     uint64 `json:"paid_amount" gorm:"default:0"`
+	RefundedAmount uint64 `json:"refunded_amount" gorm:"default:0"`
+	OrderStatus    string `json:"order_status" gorm:"order_status:10;default:'UNCONFIRMED';check:order_status IN ('UNCONFIRMED', 'PREPARING','SHIPPING','DELIVERED','CANCELED','RETURNED')"`
+	PaymentStatus  string `json:"payment_status" gorm:"payment_status:2;default:'NOT PAID';check:payment_status IN ('PAID', 'NOT PAID', 'INCOMPLETE', 'OVERPAID', 'REFUNDED')"`
 }
 
 type OrderItem struct {
@@ -74,6 +101,30 @@ type OrderItem struct {
 	ItemDiscountPrice uint64  `json:"item_discount_price" gorm:"not null"`
 }
 
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID       uint   `json:"order_id" gorm:"not null;index"`
+	Order         Order  `json:"-" gorm:"foreignkey:OrderID;constraint:OnDelete:CASCADE"`
+	FromStatus    string `json:"from_status" gorm:"not null"`
+	ToStatus      string `json:"to_status" gorm:"not null"`
+	ChangedBy     uint   `json:"changed_by"`
+	ChangedByRole string `json:"changed_by_role" gorm:"default:'ADMIN';check:changed_by_role IN ('ADMIN', 'USER', 'SYSTEM')"`
+	Note          string `json:"note"`
+}
+
+type ReturnRequest struct {
+	gorm.Model
+	OrderID    uint       `json:"order_id" gorm:"not null;index"`
+	Order      Order      `json:"-" gorm:"foreignkey:OrderID;constraint:OnDelete:CASCADE"`
+	UserID     uint       `json:"user_id" gorm:"not null"`
+	User       User       `json:"-" gorm:"foreignkey:UserID"`
+	Reason     string     `json:"reason" gorm:"not null"`
+	Status     string     `json:"status" gorm:"default:'PENDING';check:status IN ('PENDING', 'APPROVED', 'REJECTED')"`
+	AdminNote  string     `json:"admin_note"`
+	ReviewedBy uint       `json:"reviewed_by"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+}
+
 type OrderDetails struct {
 	gorm.Model
 	Username      string `json:"name"`
@@ -90,16 +141,109 @@ type Price struct {
 	Image         string  `json:"image" gorm:"default:'https://minio.ahava.com.vn/ahava/default_product_image.png'"`
 	OriginalPrice uint64  `json:"original_price" gorm:"default:1"`
 	DiscountPrice uint64  `json:"discount_price"`
+	Stock         uint    `json:"stock" gorm:"default:0"`
+}
+
+type StockMovement struct {
+	gorm.Model
+	PriceID    uint   `json:"price_id" gorm:"not null;index"`
+	ProductID  uint   `json:"product_id" gorm:"not null;index"`
+	Size       string `json:"size" gorm:"not null"`
+	Change     int    `json:"change" gorm:"not null"`
+	StockAfter uint   `json:"stock_after" gorm:"not null"`
+	Type       string `json:"type" gorm:"not null;check:type IN ('INITIAL', 'ADJUSTMENT', 'ORDER', 'CANCEL', 'RETURN')"`
+	OrderID    uint   `json:"order_id"`
+	AdminID    uint   `json:"admin_id"`
+	Note       string `json:"note"`
+}
+
+// Wallet is the store credit of a customer. The balance only changes together with a
+// WalletEntry added to the ledger, entries are never changed afterwards.
+type Wallet struct {
+	gorm.Model
+	UserID  uint   `json:"user_id" gorm:"not null;uniqueIndex"`
+	User    User   `json:"-" gorm:"foreignkey:UserID"`
+	Balance uint64 `json:"balance" gorm:"not null;default:0"`
+}
+
+type WalletEntry struct {
+	gorm.Model
+	WalletID     uint   `json:"wallet_id" gorm:"not null;index"`
+	Wallet       Wallet `json:"-" gorm:"foreignkey:WalletID"`
+	Type         string `json:"type" gorm:"not null;check:type IN ('REFUND', 'REFERRAL', 'ORDER_PAYMENT', 'ADJUSTMENT', 'LOYALTY')"`
+	Amount       int64  `json:"amount" gorm:"not null;check:amount <> 0"`
+	BalanceAfter uint64 `json:"balance_after" gorm:"not null"`
+	OrderID      *uint  `json:"order_id" gorm:"index"`
+	RefundID     *uint  `json:"refund_id" gorm:"uniqueIndex"`
+	ReferralID   *uint  `json:"referral_id" gorm:"index"`
+	AdminID      *uint  `json:"admin_id"`
+	Reason       string `json:"reason"`
+}
+
+// LoyaltyAccount holds the loyalty points of a customer. Like the wallet, the points
+// only change together with a LoyaltyEntry added to the ledger.
+type LoyaltyAccount struct {
+	gorm.Model
+	UserID uint   `json:"user_id" gorm:"not null;uniqueIndex"`
+	User   User   `json:"-" gorm:"foreignkey:UserID"`
+	Points uint64 `json:"points" gorm:"not null;default:0"`
+}
+
+// LoyaltyEntry is a change to the points of a customer. Earned points are spent and
+// expire oldest first, Remaining is what is left of them.
+type LoyaltyEntry struct {
+	gorm.Model
+	AccountID   uint           `json:"account_id" gorm:"not null;index"`
+	Account     LoyaltyAccount `json:"-" gorm:"foreignkey:AccountID"`
+	Type        string         `json:"type" gorm:"not null;check:type IN ('EARN', 'REDEEM', 'EXPIRE', 'REVOKE')"`
+	Points      int64          `json:"points" gorm:"not null;check:points <> 0"`
+	PointsAfter uint64         `json:"points_after" gorm:"not null"`
+	Remaining   uint64         `json:"remaining" gorm:"not null;default:0"`
+	OrderID     *uint          `json:"order_id" gorm:"index"`
+	ExpiresAt   *time.Time     `json:"expires_at" gorm:"index"`
+	Note        string         `json:"note"`
+}
+
+type Offer struct {
+	gorm.Model
+	Name       string    `json:"name" gorm:"not null"`
+	Scope      string    `json:"scope" gorm:"not null;check:scope IN ('PRODUCT', 'CATEGORY', 'SIZE')"`
+	ProductID  uint      `json:"product_id" gorm:"index"`
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Category   string    `json:"category"`
+	Size       string    `json:"size"`
+	OfferRate  uint      `json:"offer_rate" gorm:"not null;check:offer_rate > 0 AND offer_rate <= 100"`
+	StartAt    time.Time `json:"start_at" gorm:"not null"`
+	ExpireAt   time.Time `json:"expire_at" gorm:"not null"`
+	Valid      bool      `json:"valid" gorm:"default:true"`
+}
+
+// Category groups products, categories nest below their parent. The slug is unique
+// among the categories not deleted.
+type Category struct {
+	gorm.Model
+	ParentID        *uint     `json:"parent_id" gorm:"index"`
+	Parent          *Category `json:"-" gorm:"foreignkey:ParentID"`
+	Name            string    `json:"name" gorm:"not null"`
+	Slug            string    `json:"slug" gorm:"not null;uniqueIndex:idx_categories_slug,where:deleted_at IS NULL"`
+	Description     string    `json:"description"`
+	Image           string    `json:"image"`
+	DisplayOrder    int       `json:"display_order" gorm:"not null;default:0"`
+	IsHidden        bool      `json:"is_hidden" gorm:"not null;default:false"`
+	MetaTitle       string    `json:"meta_title"`
+	MetaDescription string    `json:"meta_description"`
+	MetaKeywords    string    `json:"meta_keywords"`
 }
 
 type Product struct {
 	gorm.Model
+	CategoryID *uint `json:"category_id" gorm:"index"`
+	// Category is the name of the category, kept for the offers and the search.
 	Category         string         `json:"category" gorm:"not null"`
 	Name             string         `json:"name" gorm:"default:Ahava Product"`
 	Code             string         `json:"code" gorm:"default:AVAHA"`
 	DefaultImage     string         `json:"default_image" gorm:"default:'https://minio.ahava.com.vn/ahava/default_product_image.png'"`
 	Images           pq.StringArray `json:"images" gorm:"type:varchar[]"`
-	Stock            uint           `json:"stock" gorm:"default:100"`
 	Type             string         `json:"type"`
 	Tag              string         `json:"tag"`
 	ShortDescription string         `json:"short_description"`
@@ -121,6 +265,63 @@ type User struct {
 	IsBlocked    bool      `json:"is_blocked" gorm:"default:false"`
 	IsAdmin      bool      `json:"is_admin" gorm:"default:false"`
 	ReferralCode string    `json:"referral_code"`
+	// EmailVerified is set once the customer proves the email is theirs, checkout
+	// needs it.
+	EmailVerified   bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// Referral links a customer to the customer who referred them. The referrer is
+// rewarded once, when the first order of the referred customer is paid.
+type Referral struct {
+	gorm.Model
+	ReferrerID   uint       `json:"referrer_id" gorm:"not null;index"`
+	Referrer     User       `json:"-" gorm:"foreignkey:ReferrerID"`
+	RefereeID    uint       `json:"referee_id" gorm:"not null;uniqueIndex"`
+	Referee      User       `json:"-" gorm:"foreignkey:RefereeID"`
+	Status       string     `json:"status" gorm:"not null;default:'PENDING';check:status IN ('PENDING', 'REWARDED', 'REJECTED')"`
+	RewardAmount uint64     `json:"reward_amount" gorm:"not null;default:0"`
+	OrderID      *uint      `json:"order_id"`
+	RewardedAt   *time.Time `json:"rewarded_at"`
+	Note         string     `json:"note"`
+}
+
+// RefreshToken is one refresh token of a login session. Refresh tokens are stored hashed
+// and used once: refreshing marks the token used and adds the next one to the session.
+type RefreshToken struct {
+	gorm.Model
+	SubjectID  uint       `json:"subject_id" gorm:"not null;index"`
+	Role       string     `json:"role" gorm:"not null;check:role IN ('admin', 'client')"`
+	SessionID  string     `json:"session_id" gorm:"not null;index"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	DeviceInfo string     `json:"device_info"`
+	ClientIP   string     `json:"client_ip"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt     *time.Time `json:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type Otp struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Purpose    string     `json:"purpose" gorm:"not null;check:purpose IN ('LOGIN', 'PASSWORD_RESET', 'VERIFY_EMAIL')"`
+	Channel    string     `json:"channel" gorm:"not null;check:channel IN ('EMAIL', 'SMS')"`
+	Target     string     `json:"target" gorm:"not null"`
+	CodeHash   string     `json:"-" gorm:"not null"`
+	Attempts   uint       `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+}
+
+// LoginAttempt counts the recent failed logins of an account or a client address.
+type LoginAttempt struct {
+	gorm.Model
+	Role          string     `json:"role" gorm:"not null;uniqueIndex:idx_login_attempt_key;check:role IN ('admin', 'client')"`
+	Scope         string     `json:"scope" gorm:"not null;uniqueIndex:idx_login_attempt_key;check:scope IN ('ACCOUNT', 'IP')"`
+	Identifier    string     `json:"identifier" gorm:"not null;uniqueIndex:idx_login_attempt_key"`
+	Failures      uint       `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"not null"`
+	LockedUntil   *time.Time `json:"locked_until" gorm:"index"`
 }
 
 type Address struct {
@@ -167,20 +368,73 @@ type Wishlist struct {
 
 type Transaction struct {
 	gorm.Model
-	UserID          uint   `json:"user_id" gorm:"not null"`
-	User            User   `json:"-" gorm:"foreignkey:UserID"`
-	OrderID         uint   `json:"order_id" gorm:"unique;not null"`
-	Order           Order  `json:"-" gorm:"foreignkey:OrderID"`
-	Gateway         string `json:"gateway"`
-	TransactionDate string `json:"transaction_date"`
-	AccountNumber   string `json:"account_number"`
-	Code            string `json:"code"`
-	Content         string `json:"content"`
-	TransferType    string `json:"transfer_type"`
-	TransferAmount  uint64 `json:"transfer_amount"`
-	Accumulated     uint64 `json:"accumulated"`
-	ReferenceCode   string `json:"reference_code"`
-	Description     string `json:"description"`
+	UserID          uint      `json:"user_id" gorm:"not null"`
+	User            User      `json:"-" gorm:"foreignkey:UserID"`
+	OrderID         uint      `json:"order_id" gorm:"not null;index"`
+	Order           Order     `json:"-" gorm:"foreignkey:OrderID"`
+	Provider        string    `json:"provider"`
+	Gateway         string    `json:"gateway"`
+	TransactionDate string    `json:"transaction_date"`
+	AccountNumber   string    `json:"account_number"`
+	Code            string    `json:"code" gorm:"index"`
+	Amount          uint64    `json:"amount"`
+	ExpireAt        time.Time `json:"expire_at"`
+	Content         string    `json:"content"`
+	TransferType    string    `json:"transfer_type"`
+	TransferAmount  uint64    `json:"transfer_amount"`
+	Accumulated     uint64    `json:"accumulated"`
+	ReferenceCode   string    `json:"reference_code" gorm:"index"`
+	Description     string    `json:"description"`
+}
+
+type Refund struct {
+	gorm.Model
+	OrderID       uint        `json:"order_id" gorm:"not null;index"`
+	Order         Order       `json:"-" gorm:"foreignkey:OrderID;constraint:OnDelete:CASCADE"`
+	TransactionID uint        `json:"transaction_id" gorm:"not null;index"`
+	Transaction   Transaction `json:"-" gorm:"foreignkey:TransactionID"`
+	Provider      string      `json:"provider"`
+	Amount        uint64      `json:"amount" gorm:"not null;check:amount > 0"`
+	Reason        string      `json:"reason"`
+	Status        string      `json:"status" gorm:"default:'PENDING';check:status IN ('PENDING', 'COMPLETED', 'FAILED')"`
+	Reference     string      `json:"reference"`
+	Note          string      `json:"note"`
+	CreatedBy     uint        `json:"created_by"`
+	CompletedAt   *time.Time  `json:"completed_at"`
+}
+
+type RefundItem struct {
+	gorm.Model
+	RefundID    uint      `json:"refund_id" gorm:"not null;index"`
+	Refund      Refund    `json:"-" gorm:"foreignkey:RefundID;constraint:OnDelete:CASCADE"`
+	OrderItemID uint      `json:"order_item_id" gorm:"not null;index"`
+	OrderItem   OrderItem `json:"-" gorm:"foreignkey:OrderItemID"`
+	ProductID   uint      `json:"product_id" gorm:"not null"`
+	Size        string    `json:"size" gorm:"not null"`
+	Quantity    uint      `json:"quantity" gorm:"not null"`
+	Amount      uint64    `json:"amount" gorm:"not null"`
+	Restocked   bool      `json:"restocked" gorm:"default:false"`
+}
+
+type WebhookEvent struct {
+	gorm.Model
+	Gateway       string `json:"gateway" gorm:"not null"`
+	ReferenceCode string `json:"reference_code" gorm:"index"`
+	Payload       string `json:"payload" gorm:"type:text;not null"`
+	ClientIP      string `json:"client_ip"`
+	Status        string `json:"status" gorm:"default:'RECEIVED';check:status IN ('RECEIVED', 'PROCESSED', 'DUPLICATE', 'IGNORED', 'REJECTED', 'FAILED')"`
+	Error         string `json:"error"`
+}
+
+// SearchHistory is a product search. Searches without a logged in customer have no
+// UserID, they only count for the trending searches.
+type SearchHistory struct {
+	gorm.Model
+	UserID        *uint  `json:"user_id" gorm:"index"`
+	User          User   `json:"-" gorm:"foreignkey:UserID"`
+	SearchKey     string `json:"search_key" gorm:"not null"`
+	NormalizedKey string `json:"normalized_key" gorm:"not null;index"`
+	ResultCount   int64  `json:"result_count" gorm:"not null;default:0"`
 }
 
 type RequestTransaction struct {
@@ -6,7 +6,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/big"
 	"mime/multipart"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -17,20 +19,22 @@ import (
 	"github.com/jinzhu/copier"
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/twilio/twilio-go"
-	twilioApi "github.com/twilio/twilio-go/rest/verify/v2"
-
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 )
 
 type Helper interface {
-	GenerateTokenAdmin(admin models.AdminDetailsResponse) (string, string, error)
+	GenerateAccessToken(subject models.TokenSubject, session_id string) (string, error)
+	GenerateRefreshToken() (string, error)
+	GenerateVerificationToken(user_id uint, email string, ttl time.Duration) (string, error)
+	HashToken(token string) string
 	AddFileToS3(file *multipart.FileHeader, bucketName string) (string, error)
-	TwilioSetup(username string, password string)
-	TwilioSendOTP(phone string, serviceID string) (string, error)
-	TwilioVerifyOTP(serviceID string, code string, phone string) error
-	GenerateTokenClients(user models.UserDetailsResponse) (string, error)
+	NormalizePhone(phone string) (string, error)
+	GenerateOTP() (string, error)
+	ValidateToken(token_string, role, token_type string) (AuthCustomClaims, error)
 	GenerateRefferalCode() (string, error)
 	PasswordHashing(string) (string, error)
 	CompareHashAndPassword(a string, b string) error
@@ -38,58 +42,112 @@ type Helper interface {
 }
 
 type helper struct {
-	cfg cfg.Config
+	cfg       cfg.Config
+	keys      map[string][]byte
+	activeKid string
 }
 
 func NewHelper(config cfg.Config) Helper {
+	// The keys are checked when the config is loaded
+	keys, activeKid, _ := config.JWTKeys()
 	return &helper{
-		cfg: config,
+		cfg:       config,
+		keys:      keys,
+		activeKid: activeKid,
 	}
 }
 
-var client *twilio.RestClient
-
 type AuthCustomClaims struct {
-	ID    uint   `json:"id"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	TokenType string `json:"token_type"`
+	SessionID string `json:"sid"`
+	// StaffRole and MustChangePassword are only set for admins
+	StaffRole          string `json:"staff_role,omitempty"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
 	jwt.StandardClaims
 }
 
-func (h *helper) GenerateTokenAdmin(admin models.AdminDetailsResponse) (string, string, error) {
-	accessTokenClaims := &AuthCustomClaims{
-		ID:    admin.ID,
-		Email: admin.Email,
-		Role:  "admin",
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 6).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-	}
+// tokenIssuer is the issuer of every token signed by the API.
+const tokenIssuer = "ahava"
+
+// accessTokenTTL is how long an access token is valid. Sessions last longer through
+// refresh tokens.
+const accessTokenTTL = time.Hour
+
+// GenerateAccessToken signs an access token of the login session with the active key and
+// names the key in the kid header.
+func (h *helper) GenerateAccessToken(subject models.TokenSubject, session_id string) (string, error) {
+	return h.signToken(AuthCustomClaims{
+		ID:        subject.ID,
+		Email:     subject.Email,
+		Role:      subject.Role,
+		TokenType: models.TokenTypeAccess,
+		SessionID: session_id,
+
+		StaffRole:          subject.StaffRole,
+		MustChangePassword: subject.MustChangePassword,
+	}, accessTokenTTL)
+}
 
-	refreshTokenClaims := &AuthCustomClaims{
-		ID:    admin.ID,
-		Email: admin.Email,
-		Role:  "admin",
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 30).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-	}
+// GenerateVerificationToken signs a token for the link that verifies the email of a
+// customer. The token names the email so it no longer works once the email changes.
+func (h *helper) GenerateVerificationToken(user_id uint, email string, ttl time.Duration) (string, error) {
+	return h.signToken(AuthCustomClaims{
+		ID:        user_id,
+		Email:     email,
+		Role:      models.RoleClient,
+		TokenType: models.TokenTypeVerifyEmail,
+	}, ttl)
+}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte("accesssecret"))
-	if err != nil {
-		return "", "", err
+// signToken signs the claims with the active key and names the key in the kid header.
+func (h *helper) signToken(claims AuthCustomClaims, ttl time.Duration) (string, error) {
+	key, ok := h.keys[h.activeKid]
+	if !ok || len(key) == 0 {
+		return "", models.ErrCreateToken
 	}
-
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte("refreshsecret"))
-	if err != nil {
-		return "", "", err
+	now := time.Now()
+	claims.StandardClaims = jwt.StandardClaims{
+		ExpiresAt: now.Add(ttl).Unix(),
+		IssuedAt:  now.Unix(),
+		Issuer:    tokenIssuer,
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	token.Header["kid"] = h.activeKid
+	return token.SignedString(key)
+}
 
-	return accessTokenString, refreshTokenString, nil
+// ValidateToken checks that the token is signed with HS256 by one of the configured keys,
+// has not expired and was issued to the role for the given use. It returns
+// models.ErrInvalidToken for bad tokens and models.ErrForbidden for other roles.
+func (h *helper) ValidateToken(token_string, role, token_type string) (AuthCustomClaims, error) {
+	var claims AuthCustomClaims
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+	token, err := parser.ParseWithClaims(token_string, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := h.keys[kid]
+		if !ok {
+			return nil, models.ErrInvalidToken
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		return AuthCustomClaims{}, models.ErrInvalidToken
+	}
+	// The parser only checks the expiry when there is one
+	if claims.ExpiresAt == 0 || claims.Issuer != tokenIssuer || claims.TokenType != token_type || claims.ID == 0 {
+		return AuthCustomClaims{}, models.ErrInvalidToken
+	}
+	// Access tokens belong to a login session
+	if token_type == models.TokenTypeAccess && claims.SessionID == "" {
+		return AuthCustomClaims{}, models.ErrInvalidToken
+	}
+	if claims.Role != role {
+		return AuthCustomClaims{}, models.ErrForbidden
+	}
+	return claims, nil
 }
 
 func (h *helper) AddFileToS3(file *multipart.FileHeader, bucketName string) (string, error) {
@@ -168,67 +226,53 @@ func (h *helper) AddFileToS3(file *multipart.FileHeader, bucketName string) (str
 // 	return result.Location, nil
 // }
 
-func (h *helper) TwilioSetup(username string, password string) {
-	client = twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: username,
-		Password: password,
-	})
-
-}
-
-func (h *helper) TwilioSendOTP(phone string, serviceID string) (string, error) {
-	to := "+91" + phone
-	params := &twilioApi.CreateVerificationParams{}
-	params.SetTo(to)
-	params.SetChannel("sms")
-
-	resp, err := client.VerifyV2.CreateVerification(serviceID, params)
-	if err != nil {
-
-		return " ", err
+// NormalizePhone returns a Vietnamese phone number in the +84 form. Numbers may be
+// given in the local 0 form, with or without the country code and with spaces, dots
+// or dashes.
+func (h *helper) NormalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == ' ' || r == '.' || r == '-' || r == '(' || r == ')' || r == '+':
+			return -1
+		}
+		return 'x'
+	}, phone)
+	switch {
+	case len(digits) == 11 && strings.HasPrefix(digits, "84"):
+		digits = digits[2:]
+	case len(digits) == 10 && strings.HasPrefix(digits, "0"):
+		digits = digits[1:]
 	}
-
-	return *resp.Sid, nil
-
+	if len(digits) != 9 || strings.ContainsRune(digits, 'x') {
+		return "", models.ErrInvalidPhone
+	}
+	return "+84" + digits, nil
 }
 
-func (h *helper) TwilioVerifyOTP(serviceID string, code string, phone string) error {
-
-	params := &twilioApi.CreateVerificationCheckParams{}
-	params.SetTo("+91" + phone)
-	params.SetCode(code)
-	resp, err := client.VerifyV2.CreateVerificationCheck(serviceID, params)
-
+// GenerateOTP returns a random 6 digit code.
+func (h *helper) GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
 	if err != nil {
-		return err
-	}
-
-	if *resp.Status == "approved" {
-		return nil
+		return "", err
 	}
-
-	return models.ErrValidateOTP
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
-func (h *helper) GenerateTokenClients(user models.UserDetailsResponse) (string, error) {
-	claims := &AuthCustomClaims{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  "client",
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 48).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte("ahava"))
-
-	if err != nil {
+// GenerateRefreshToken returns a random opaque refresh token.
+func (h *helper) GenerateRefreshToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
 
-	return tokenString, nil
+// HashToken returns the hash under which a refresh token is stored.
+func (h *helper) HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
 
 func (h *helper) GenerateRefferalCode() (string, error) {
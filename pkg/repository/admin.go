@@ -5,6 +5,7 @@ import (
 	"ahava/pkg/utils/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AdminRepository interface {
@@ -12,10 +13,19 @@ type AdminRepository interface {
 	ListAllUsers(limit, offset int) (models.ListUsers, error)
 	UpdateBlockUser(user_id uint, is_blocked bool) error
 
-	// NewPaymentMethod(string) error
-	// ListPaymentMethods() ([]domain.PaymentMethod, error)
-	// CheckIfPaymentMethodAlreadyExists(payment string) (bool, error)
-	// DeletePaymentMethod(id uint) error
+	GetAdmin(admin_id uint) (domain.Admin, error)
+	CheckIfAdminAlreadyExists(email string) (bool, error)
+	CreateAdmin(staff models.CreateStaff) (models.AdminDetailsResponse, error)
+	ListAdmins(limit, offset int) (models.ListStaff, error)
+	UpdateAdmin(admin_id uint, staff models.UpdateStaff) (models.AdminDetailsResponse, error)
+	DeleteAdmin(admin_id uint) error
+	UpdateAdminPassword(admin_id uint, password string, must_change bool) error
+
+	NewPaymentMethod(method models.PaymentMethod) (models.PaymentMethod, error)
+	ListPaymentMethods() ([]models.PaymentMethod, error)
+	CheckIfPaymentMethodAlreadyExists(payment string) (bool, error)
+	UpdatePaymentMethod(id uint, enable bool) (models.PaymentMethod, error)
+	DeletePaymentMethod(id uint) error
 }
 
 type adminRepository struct {
@@ -90,41 +100,247 @@ func (r *adminRepository) ListAllUsers(limit, offset int) (models.ListUsers, err
 	}, nil
 }
 
-// func (r *adminRepository) NewPaymentMethod(pay string) error {
+func (r *adminRepository) GetAdmin(admin_id uint) (domain.Admin, error) {
+	// Query to get the admin
+	var admin domain.Admin
+	if err := r.DB.First(&admin, admin_id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return domain.Admin{}, models.ErrEntityNotFound
+		}
+		return domain.Admin{}, err
+	}
+	return admin, nil
+}
 
-// 	if err := r.DB.Exec("insert into payment_methods(payment_name)values($1)", pay).Error; err != nil {
-// 		return err
-// 	}
+func (r *adminRepository) CheckIfAdminAlreadyExists(email string) (bool, error) {
+	// Count the admins with the email
+	var count int64
+	err := r.DB.Model(&domain.Admin{}).
+		Where("LOWER(email) = LOWER(?)", email).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
 
-// 	return nil
+func (r *adminRepository) CreateAdmin(staff models.CreateStaff) (models.AdminDetailsResponse, error) {
+	// The password is chosen by someone else, it has to be changed on first login
+	admin := domain.Admin{
+		Name:               staff.Name,
+		Email:              staff.Email,
+		Password:           staff.Password,
+		Role:               staff.Role,
+		MustChangePassword: true,
+	}
+	if err := r.DB.Create(&admin).Error; err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	// Return the admin
+	return adminDetails(admin), nil
+}
 
-// }
+func (r *adminRepository) ListAdmins(limit, offset int) (models.ListStaff, error) {
+	// Define the list of admins
+	var admins []domain.Admin
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.Admin{})
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListStaff{}, err
+	}
+	if err := query.Order("id ASC").Offset(offset).Limit(limit).Find(&admins).Error; err != nil {
+		return models.ListStaff{}, err
+	}
+	// Leave the passwords out
+	staff := []models.AdminDetailsResponse{}
+	for _, admin := range admins {
+		staff = append(staff, adminDetails(admin))
+	}
+	// Return the list of admins
+	return models.ListStaff{
+		Staff:  staff,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}, nil
+}
 
-// func (r *adminRepository) ListPaymentMethods() ([]domain.PaymentMethod, error) {
-// 	var model []domain.PaymentMethod
-// 	err := r.DB.Raw("SELECT * FROM payment_methods where is_deleted = false").Scan(&model).Error
-// 	if err != nil {
-// 		return []domain.PaymentMethod{}, err
-// 	}
+func (r *adminRepository) UpdateAdmin(admin_id uint, staff models.UpdateStaff) (models.AdminDetailsResponse, error) {
+	// Define the updated admin
+	var admin domain.Admin
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the owners so the last one cannot lose the role
+		if err := lockAdmin(tx, admin_id, &admin); err != nil {
+			return err
+		}
+		if staff.Role != "" && staff.Role != models.AdminRoleOwner {
+			if err := checkOtherOwner(tx, admin); err != nil {
+				return err
+			}
+		}
+		// Update the admin
+		if staff.Name != "" {
+			admin.Name = staff.Name
+		}
+		if staff.Role != "" {
+			admin.Role = staff.Role
+		}
+		return tx.Model(&admin).Select("name", "role").Updates(&admin).Error
+	})
+	if err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	// Return the updated admin
+	return adminDetails(admin), nil
+}
 
-// 	return model, nil
-// }
+func (r *adminRepository) DeleteAdmin(admin_id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the owners so the last one cannot be deleted
+		var admin domain.Admin
+		if err := lockAdmin(tx, admin_id, &admin); err != nil {
+			return err
+		}
+		if err := checkOtherOwner(tx, admin); err != nil {
+			return err
+		}
+		// Delete the admin
+		return tx.Delete(&admin).Error
+	})
+}
 
-// func (r *adminRepository) CheckIfPaymentMethodAlreadyExists(payment string) (bool, error) {
-// 	var count int64
-// 	err := r.DB.Raw("SELECT COUNT(*) FROM payment_methods WHERE payment_name = $1 and is_deleted = false", payment).Scan(&count).Error
-// 	if err != nil {
-// 		return false, err
-// 	}
+func (r *adminRepository) UpdateAdminPassword(admin_id uint, password string, must_change bool) error {
+	// Update the password
+	result := r.DB.Model(&domain.Admin{}).
+		Where("id = ?", admin_id).
+		Updates(map[string]interface{}{
+			"password":             password,
+			"must_change_password": must_change,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
 
-// 	return count > 0, nil
-// }
+// lockAdmin locks the owners and the admin and loads the admin.
+func lockAdmin(tx *gorm.DB, admin_id uint, admin *domain.Admin) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ? OR id = ?", models.AdminRoleOwner, admin_id).
+		Find(&[]domain.Admin{}).Error; err != nil {
+		return err
+	}
+	if err := tx.First(admin, admin_id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ErrEntityNotFound
+		}
+		return err
+	}
+	return nil
+}
 
-// func (r *adminRepository) DeletePaymentMethod(id uint) error {
-// 	err := r.DB.Exec("UPDATE payment_methods SET is_deleted = true WHERE id = $1 ", id).Error
-// 	if err != nil {
-// 		return err
-// 	}
+// checkOtherOwner returns models.ErrConflict when the admin is the last owner.
+func checkOtherOwner(tx *gorm.DB, admin domain.Admin) error {
+	if admin.Role != models.AdminRoleOwner {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&domain.Admin{}).
+		Where("role = ? AND id <> ?", models.AdminRoleOwner, admin.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.ErrConflict
+	}
+	return nil
+}
 
-// 	return nil
-// }
+// adminDetails returns the admin without the password.
+func adminDetails(admin domain.Admin) models.AdminDetailsResponse {
+	return models.AdminDetailsResponse{
+		ID:                 admin.ID,
+		Name:               admin.Name,
+		Email:              admin.Email,
+		Role:               admin.Role,
+		MustChangePassword: admin.MustChangePassword,
+	}
+}
+
+func (r *adminRepository) NewPaymentMethod(m models.PaymentMethod) (models.PaymentMethod, error) {
+	// Define the payment method
+	method := domain.PaymentMethod{
+		PaymentName: m.PaymentName,
+		Enable:      m.Enable,
+	}
+	// Create the payment method, Select makes a disabled method stay disabled
+	if err := r.DB.Select("payment_name", "enable").Create(&method).Error; err != nil {
+		return models.PaymentMethod{}, err
+	}
+	// Return the payment method
+	return models.PaymentMethod{
+		ID:          method.ID,
+		PaymentName: method.PaymentName,
+		Enable:      method.Enable,
+	}, nil
+}
+
+func (r *adminRepository) ListPaymentMethods() ([]models.PaymentMethod, error) {
+	// Define the payment methods
+	var methods []models.PaymentMethod
+	// Query to get the payment methods
+	err := r.DB.Model(&domain.PaymentMethod{}).Order("id ASC").Find(&methods).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the payment methods
+	return methods, nil
+}
+
+func (r *adminRepository) CheckIfPaymentMethodAlreadyExists(payment string) (bool, error) {
+	// Count the payment methods with the name
+	var count int64
+	err := r.DB.Model(&domain.PaymentMethod{}).
+		Where("UPPER(payment_name) = UPPER(?)", payment).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *adminRepository) UpdatePaymentMethod(id uint, enable bool) (models.PaymentMethod, error) {
+	// Define the payment method
+	var method models.PaymentMethod
+	// Update the payment method
+	result := r.DB.Model(&domain.PaymentMethod{}).
+		Where("id = ?", id).
+		Update("enable", enable)
+	if result.Error != nil {
+		return models.PaymentMethod{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.PaymentMethod{}, models.ErrEntityNotFound
+	}
+	// Return the updated payment method
+	if err := r.DB.Model(&domain.PaymentMethod{}).Where("id = ?", id).First(&method).Error; err != nil {
+		return models.PaymentMethod{}, err
+	}
+	return method, nil
+}
+
+func (r *adminRepository) DeletePaymentMethod(id uint) error {
+	// Delete the payment method
+	result := r.DB.Delete(&domain.PaymentMethod{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ type CartRepository interface {
 	AddToCart(user_id uint, cart_item models.UpdateCartItem) (models.CartDetails, error)
 
 	CheckIfItemIsAlreadyAdded(user_id, product_id uint, size string) (uint, error)
+	GetAvailableStock(product_id uint, size string) (uint, error)
 	UpdateQuantityAdd(user_id, cart_id, quantity uint) (models.CartDetails, error)
 	UpdateQuantityLess(user_id, cart_id, quantity uint) (models.CartDetails, error)
 	UpdateQuantity(user_id, cart_id, quantity uint) (models.CartDetails, error)
@@ -35,9 +36,10 @@ func (r *cartRepository) GetCart(user_id uint, cart_ids []uint) ([]models.CartIt
 	query := r.DB.Model(&domain.CartItem{}).
 		Joins("JOIN products p ON cart_items.product_id = p.id").
 		Joins("JOIN prices pr ON pr.product_id = p.id AND pr.size = cart_items.size").
-		Select(`cart_items.id, p.id as product_id, p.name, p.default_image, cart_items.quantity, cart_items.size, pr.original_price, pr.discount_price,
+		Select(`cart_items.id, p.id as product_id, p.name, p.default_image, cart_items.quantity, cart_items.size, pr.original_price, pr.stock,
+				`+offerPriceSQL+` AS discount_price,
 				(cart_items.quantity * pr.original_price) AS item_price, 
-				(cart_items.quantity * pr.discount_price) AS item_discount_price`).
+				(cart_items.quantity * `+offerPriceSQL+`) AS item_discount_price`).
 		Where("cart_items.user_id = ?", user_id)
 	// If there are cart ids, add a where clause to the query
 	if len(cart_ids) > 0 {
@@ -66,6 +68,23 @@ func (r *cartRepository) CheckIfItemIsAlreadyAdded(user_id, product_id uint, siz
 	return cart_id, nil
 }
 
+func (r *cartRepository) GetAvailableStock(product_id uint, size string) (uint, error) {
+	// Define the price
+	var price domain.Price
+	// Query to get the stock of the size
+	err := r.DB.Select("stock").
+		Where("product_id = ? AND size = ?", product_id, size).
+		First(&price).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, models.ErrEntityNotFound
+		}
+		return 0, err
+	}
+	// Return the stock
+	return price.Stock, nil
+}
+
 func (r *cartRepository) RemoveFromCart(user_id, cart_id uint) error {
 	// Delete the cart item
 	result := r.DB.Where("id=? AND user_id=?", cart_id, user_id).Delete(&domain.CartItem{})
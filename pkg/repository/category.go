@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categorySubtreeSQL selects the ids of the categories found by slug or name and of
+// every category below them. It takes the key twice.
+const categorySubtreeSQL = `WITH RECURSIVE subtree AS (
+	SELECT id FROM categories WHERE (slug = ? OR name = ?) AND deleted_at IS NULL
+	UNION
+	SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+	WHERE categories.deleted_at IS NULL
+) SELECT id FROM subtree`
+
+// categorySubtreeOf returns categorySubtreeSQL starting from the category whose id is
+// given by an SQL expression.
+func categorySubtreeOf(id string) string {
+	return strings.Replace(categorySubtreeSQL, "(slug = ? OR name = ?)", "id = "+id, 1)
+}
+
+type CategoryRepository interface {
+	AddCategory(category models.Category) (models.Category, error)
+	UpdateCategory(category_id uint, category models.UpdateCategory) (models.Category, error)
+	DeleteCategory(category_id uint) error
+	GetCategory(category_id uint) (models.Category, error)
+	ListCategories(include_hidden bool) ([]models.Category, error)
+	CheckCategorySlug(slug string, exclude_id uint) (bool, error)
+	IsCategoryBelow(category_id, ancestor_id uint) (bool, error)
+}
+
+type categoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewCategoryRepository(DB *gorm.DB) CategoryRepository {
+	return &categoryRepository{
+		DB: DB,
+	}
+}
+
+func (r *categoryRepository) AddCategory(c models.Category) (models.Category, error) {
+	// Define the category
+	category := domain.Category{
+		ParentID:        c.ParentID,
+		Name:            c.Name,
+		Slug:            c.Slug,
+		Description:     c.Description,
+		Image:           c.Image,
+		DisplayOrder:    c.DisplayOrder,
+		IsHidden:        c.IsHidden,
+		MetaTitle:       c.MetaTitle,
+		MetaDescription: c.MetaDescription,
+		MetaKeywords:    c.MetaKeywords,
+	}
+	// Create the category
+	if err := r.DB.Create(&category).Error; err != nil {
+		return models.Category{}, err
+	}
+	// Return the category
+	return categoryModel(category), nil
+}
+
+func (r *categoryRepository) UpdateCategory(category_id uint, c models.UpdateCategory) (models.Category, error) {
+	var category domain.Category
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the category
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, category_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		old_name := category.Name
+		// Replace every field, zero values included
+		if err := tx.Model(&category).Updates(map[string]interface{}{
+			"parent_id":        c.ParentID,
+			"name":             c.Name,
+			"slug":             c.Slug,
+			"description":      c.Description,
+			"image":            c.Image,
+			"display_order":    c.DisplayOrder,
+			"is_hidden":        c.IsHidden,
+			"meta_title":       c.MetaTitle,
+			"meta_description": c.MetaDescription,
+			"meta_keywords":    c.MetaKeywords,
+		}).Error; err != nil {
+			return err
+		}
+		if old_name == c.Name {
+			return nil
+		}
+		// The products refer to the category by name too
+		return tx.Model(&domain.Product{}).
+			Where("category_id = ?", category_id).
+			Update("category", c.Name).Error
+	})
+	if err != nil {
+		return models.Category{}, err
+	}
+	return r.GetCategory(category_id)
+}
+
+func (r *categoryRepository) DeleteCategory(category_id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the category
+		var category domain.Category
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, category_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		// Categories with subcategories or products can not be deleted
+		var count int64
+		if err := tx.Model(&domain.Category{}).Where("parent_id = ?", category_id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrConflict
+		}
+		if err := tx.Model(&domain.Product{}).Where("category_id = ?", category_id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrConflict
+		}
+		// Nor can the categories the offers run on
+		if err := tx.Model(&domain.Offer{}).Where("category_id = ?", category_id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrConflict
+		}
+		return tx.Delete(&category).Error
+	})
+}
+
+func (r *categoryRepository) GetCategory(category_id uint) (models.Category, error) {
+	var category models.Category
+	result := r.categoryQuery().Where("categories.id = ?", category_id).Scan(&category)
+	if result.Error != nil {
+		return models.Category{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Category{}, models.ErrEntityNotFound
+	}
+	return category, nil
+}
+
+func (r *categoryRepository) ListCategories(include_hidden bool) ([]models.Category, error) {
+	query := r.categoryQuery()
+	if !include_hidden {
+		query = query.Where("categories.is_hidden = false")
+	}
+	categories := []models.Category{}
+	err := query.Order("categories.display_order ASC, categories.name ASC, categories.id ASC").
+		Scan(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *categoryRepository) CheckCategorySlug(slug string, exclude_id uint) (bool, error) {
+	// Count the other categories using the slug
+	var count int64
+	err := r.DB.Model(&domain.Category{}).
+		Where("slug = ? AND id <> ?", slug, exclude_id).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *categoryRepository) IsCategoryBelow(category_id, ancestor_id uint) (bool, error) {
+	// Walk up from the category to the root
+	var count int64
+	err := r.DB.Raw(`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM categories WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT categories.id, categories.parent_id FROM categories
+			JOIN ancestors ON categories.id = ancestors.parent_id
+			WHERE categories.deleted_at IS NULL
+		) SELECT COUNT(*) FROM ancestors WHERE id = ?`, category_id, ancestor_id).
+		Scan(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// categoryQuery selects the categories with the number of their products.
+func (r *categoryRepository) categoryQuery() *gorm.DB {
+	return r.DB.Model(&domain.Category{}).
+		Select(`categories.id, categories.parent_id, categories.name, categories.slug,
+			categories.description, categories.image, categories.display_order,
+			categories.is_hidden, categories.meta_title, categories.meta_description,
+			categories.meta_keywords,
+			(SELECT COUNT(*) FROM products WHERE products.category_id = categories.id
+				AND products.deleted_at IS NULL) AS product_count`)
+}
+
+// productCategory finds the category of a product by id or, for the clients still
+// sending the category, by slug or else by name. It returns models.ErrConflict if
+// several categories have the name.
+func productCategory(db *gorm.DB, p models.Product) (domain.Category, error) {
+	if p.CategoryID != nil {
+		var category domain.Category
+		if err := db.First(&category, *p.CategoryID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return domain.Category{}, models.ErrEntityNotFound
+			}
+			return domain.Category{}, err
+		}
+		return category, nil
+	}
+	// The slug is unique
+	var categories []domain.Category
+	if err := db.Where("slug = ?", p.Category).Limit(1).Find(&categories).Error; err != nil {
+		return domain.Category{}, err
+	}
+	if len(categories) == 1 {
+		return categories[0], nil
+	}
+	// The name is not, it must be the only one
+	if err := db.Where("name = ?", p.Category).Limit(2).Find(&categories).Error; err != nil {
+		return domain.Category{}, err
+	}
+	switch len(categories) {
+	case 0:
+		return domain.Category{}, models.ErrEntityNotFound
+	case 1:
+		return categories[0], nil
+	default:
+		return domain.Category{}, models.ErrConflict
+	}
+}
+
+func categoryModel(c domain.Category) models.Category {
+	return models.Category{
+		ID:              c.ID,
+		ParentID:        c.ParentID,
+		Name:            c.Name,
+		Slug:            c.Slug,
+		Description:     c.Description,
+		Image:           c.Image,
+		DisplayOrder:    c.DisplayOrder,
+		IsHidden:        c.IsHidden,
+		MetaTitle:       c.MetaTitle,
+		MetaDescription: c.MetaDescription,
+		MetaKeywords:    c.MetaKeywords,
+	}
+}
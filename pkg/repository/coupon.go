@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponRepository interface {
+	AddCoupon(coupon models.Coupon) (models.Coupon, error)
+	UpdateCoupon(coupon_id uint, coupon models.Coupon) (models.Coupon, error)
+	UpdateCouponValidity(coupon_id uint, valid bool) error
+	GetCouponByID(coupon_id uint) (models.Coupon, error)
+	GetCouponByCode(code string) (models.Coupon, error)
+	ListAllCoupons(limit, offset int) (models.ListCoupons, error)
+	ListAvailableCoupons() ([]models.Coupon, error)
+	CountUserCouponUsage(coupon_id, user_id uint) (int64, error)
+}
+
+type couponRepository struct {
+	DB *gorm.DB
+}
+
+func NewCouponRepository(DB *gorm.DB) CouponRepository {
+	return &couponRepository{
+		DB: DB,
+	}
+}
+
+// couponFields are the columns written when a coupon is updated, so zero values are saved too.
+var couponFields = []string{
+	"coupon", "type", "discount_rate", "discount_amount", "max_discount", "min_order_value",
+	"start_at", "expire_at", "usage_limit", "usage_limit_per_user",
+}
+
+func (r *couponRepository) AddCoupon(c models.Coupon) (models.Coupon, error) {
+	// Define the coupon
+	coupon := domain.Coupons{
+		Coupon:            c.Coupon,
+		Type:              c.Type,
+		DiscountRate:      c.DiscountRate,
+		DiscountAmount:    c.DiscountAmount,
+		MaxDiscount:       c.MaxDiscount,
+		MinOrderValue:     c.MinOrderValue,
+		StartAt:           c.StartAt,
+		ExpireAt:          c.ExpireAt,
+		UsageLimit:        c.UsageLimit,
+		UsageLimitPerUser: c.UsageLimitPerUser,
+	}
+	// Create the coupon
+	if err := r.DB.Create(&coupon).Error; err != nil {
+		return models.Coupon{}, err
+	}
+	// Return the coupon
+	return r.GetCouponByID(coupon.ID)
+}
+
+func (r *couponRepository) UpdateCoupon(coupon_id uint, c models.Coupon) (models.Coupon, error) {
+	// Update the coupon
+	result := r.DB.Model(&domain.Coupons{}).
+		Where("id = ?", coupon_id).
+		Select(couponFields).
+		Updates(domain.Coupons{
+			Coupon:            c.Coupon,
+			Type:              c.Type,
+			DiscountRate:      c.DiscountRate,
+			DiscountAmount:    c.DiscountAmount,
+			MaxDiscount:       c.MaxDiscount,
+			MinOrderValue:     c.MinOrderValue,
+			StartAt:           c.StartAt,
+			ExpireAt:          c.ExpireAt,
+			UsageLimit:        c.UsageLimit,
+			UsageLimitPerUser: c.UsageLimitPerUser,
+		})
+	if result.Error != nil {
+		return models.Coupon{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Coupon{}, models.ErrEntityNotFound
+	}
+	// Return the updated coupon
+	return r.GetCouponByID(coupon_id)
+}
+
+func (r *couponRepository) UpdateCouponValidity(coupon_id uint, valid bool) error {
+	// Update the coupon validity
+	result := r.DB.Model(&domain.Coupons{}).
+		Where("id = ?", coupon_id).
+		Update("valid", valid)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *couponRepository) GetCouponByID(coupon_id uint) (models.Coupon, error) {
+	// Define the coupon
+	var coupon models.Coupon
+	// Query to get the coupon
+	err := r.DB.Model(&domain.Coupons{}).
+		Where("id = ?", coupon_id).
+		First(&coupon).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Coupon{}, models.ErrEntityNotFound
+		}
+		return models.Coupon{}, err
+	}
+	// Return the coupon
+	return coupon, nil
+}
+
+func (r *couponRepository) GetCouponByCode(code string) (models.Coupon, error) {
+	// Define the coupon
+	var coupon models.Coupon
+	// Query to get the coupon
+	err := r.DB.Model(&domain.Coupons{}).
+		Where("coupon = ?", code).
+		First(&coupon).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Coupon{}, models.ErrEntityNotFound
+		}
+		return models.Coupon{}, err
+	}
+	// Return the coupon
+	return coupon, nil
+}
+
+func (r *couponRepository) ListAllCoupons(limit, offset int) (models.ListCoupons, error) {
+	// Define the list of coupons
+	var coupons []models.Coupon
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.Coupons{})
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListCoupons{}, err
+	}
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&coupons).Error; err != nil {
+		return models.ListCoupons{}, err
+	}
+	// Return the list of coupons
+	return models.ListCoupons{
+		Coupons: coupons,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+func (r *couponRepository) ListAvailableCoupons() ([]models.Coupon, error) {
+	// Define the list of coupons
+	var coupons []models.Coupon
+	// Query to get the coupons that can be used now, a zero expiry means no expiry
+	now := time.Now()
+	err := r.DB.Model(&domain.Coupons{}).
+		Where("valid = true AND start_at <= ?", now).
+		Where("expire_at > ? OR expire_at = ?", now, time.Time{}).
+		Where("usage_limit = 0 OR used_count < usage_limit").
+		Order("expire_at ASC").
+		Find(&coupons).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the list of coupons
+	return coupons, nil
+}
+
+func (r *couponRepository) CountUserCouponUsage(coupon_id, user_id uint) (int64, error) {
+	// Count the number of orders of the user using the coupon
+	var count int64
+	err := r.DB.Model(&domain.CouponUsage{}).
+		Where("coupon_id = ? AND user_id = ?", coupon_id, user_id).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// redeemCoupon records the use of a coupon by an order of the given total. The coupon
+// row is locked so it is checked again against what it is when the order is placed, and
+// the global and per-user usage limits hold under concurrent checkouts.
+// It returns models.ErrInvalidCoupon if the coupon can no longer be used.
+func redeemCoupon(tx *gorm.DB, coupon_id, user_id, order_id uint, total, discount uint64) error {
+	// Lock the coupon
+	var coupon domain.Coupons
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, coupon_id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ErrInvalidCoupon
+		}
+		return err
+	}
+	// Check the coupon is still running, a zero expiry means no expiry
+	now := time.Now()
+	if !coupon.Valid || now.Before(coupon.StartAt) || (!coupon.ExpireAt.IsZero() && !now.Before(coupon.ExpireAt)) {
+		return models.ErrInvalidCoupon
+	}
+	// Check the minimum order value
+	if total < coupon.MinOrderValue {
+		return models.ErrInvalidCoupon
+	}
+	// Check the usage limits
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return models.ErrInvalidCoupon
+	}
+	if coupon.UsageLimitPerUser > 0 {
+		var count int64
+		if err := tx.Model(&domain.CouponUsage{}).
+			Where("coupon_id = ? AND user_id = ?", coupon_id, user_id).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(coupon.UsageLimitPerUser) {
+			return models.ErrInvalidCoupon
+		}
+	}
+	// Record the usage
+	if err := tx.Model(&domain.Coupons{}).
+		Where("id = ?", coupon_id).
+		Update("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+		return err
+	}
+	return tx.Create(&domain.CouponUsage{
+		CouponID: coupon_id,
+		UserID:   user_id,
+		OrderID:  order_id,
+		Discount: discount,
+	}).Error
+}
+
+// releaseCoupon gives back the coupon used by an order, if any.
+func releaseCoupon(tx *gorm.DB, order_id uint) error {
+	var usage domain.CouponUsage
+	result := tx.Where("order_id = ?", order_id).Limit(1).Find(&usage)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Delete(&usage).Error; err != nil {
+		return err
+	}
+	return tx.Model(&domain.Coupons{}).
+		Where("id = ? AND used_count > 0", usage.CouponID).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type LoginAttemptRepository interface {
+	IsLoginLocked(role, account, ip string, now time.Time) (bool, error)
+	RecordLoginFailure(role, scope, identifier string, now, window_start time.Time) (domain.LoginAttempt, error)
+	LockLogin(attempt_id uint, until time.Time) error
+	ResetLoginFailures(role, scope, identifier string) error
+	ListLockouts(role, scope string, now time.Time, limit, offset int) (models.ListLoginLockouts, error)
+	Unlock(attempt_id uint) error
+}
+
+type loginAttemptRepository struct {
+	DB *gorm.DB
+}
+
+func NewLoginAttemptRepository(DB *gorm.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{
+		DB: DB,
+	}
+}
+
+func (r *loginAttemptRepository) IsLoginLocked(role, account, ip string, now time.Time) (bool, error) {
+	// Either the account or the address being locked is enough
+	var count int64
+	err := r.DB.Model(&domain.LoginAttempt{}).
+		Where("role = ? AND locked_until > ?", role, now).
+		Where("(scope = ? AND identifier = ?) OR (scope = ? AND identifier = ?)",
+			models.LoginScopeAccount, account, models.LoginScopeIP, ip).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *loginAttemptRepository) RecordLoginFailure(role, scope, identifier string, now, window_start time.Time) (domain.LoginAttempt, error) {
+	// Count the failure in one statement so concurrent logins do not lose any,
+	// failures older than the window are forgotten
+	var attempt domain.LoginAttempt
+	err := r.DB.Raw(`INSERT INTO login_attempts (created_at, updated_at, role, scope, identifier, failures, last_failure_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT (role, scope, identifier) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING *`,
+		now, now, role, scope, identifier, now, window_start).Scan(&attempt).Error
+	return attempt, err
+}
+
+func (r *loginAttemptRepository) LockLogin(attempt_id uint, until time.Time) error {
+	// Never shorten a longer lock set by a concurrent failure
+	return r.DB.Model(&domain.LoginAttempt{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", attempt_id, until).
+		Update("locked_until", until).Error
+}
+
+func (r *loginAttemptRepository) ResetLoginFailures(role, scope, identifier string) error {
+	return r.DB.Model(&domain.LoginAttempt{}).
+		Where("role = ? AND scope = ? AND identifier = ?", role, scope, identifier).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": nil}).Error
+}
+
+func (r *loginAttemptRepository) ListLockouts(role, scope string, now time.Time, limit, offset int) (models.ListLoginLockouts, error) {
+	// Define the list of lockouts
+	var attempts []domain.LoginAttempt
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.LoginAttempt{}).Where("locked_until > ?", now)
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListLoginLockouts{}, err
+	}
+	if err := query.Order("locked_until DESC").Offset(offset).Limit(limit).Find(&attempts).Error; err != nil {
+		return models.ListLoginLockouts{}, err
+	}
+	lockouts := []models.LoginLockout{}
+	for _, attempt := range attempts {
+		lockouts = append(lockouts, models.LoginLockout{
+			ID:            attempt.ID,
+			Role:          attempt.Role,
+			Scope:         attempt.Scope,
+			Identifier:    attempt.Identifier,
+			Failures:      attempt.Failures,
+			LastFailureAt: attempt.LastFailureAt,
+			LockedUntil:   *attempt.LockedUntil,
+		})
+	}
+	// Return the list of lockouts
+	return models.ListLoginLockouts{
+		Lockouts: lockouts,
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	}, nil
+}
+
+func (r *loginAttemptRepository) Unlock(attempt_id uint) error {
+	result := r.DB.Model(&domain.LoginAttempt{}).
+		Where("id = ?", attempt_id).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoyaltyRepository interface {
+	GetLoyaltyPoints(user_id uint, limit, offset int) (models.LoyaltyPoints, error)
+	GetExpiringPoints(user_id uint, before time.Time) (uint64, error)
+	GetYearSpend(user_id uint, since time.Time) (uint64, error)
+	RedeemPoints(user_id uint, points uint64, now time.Time) (models.LoyaltyEntry, error)
+	ExpirePoints(now time.Time) (int, error)
+}
+
+type loyaltyRepository struct {
+	DB *gorm.DB
+}
+
+func NewLoyaltyRepository(DB *gorm.DB) LoyaltyRepository {
+	return &loyaltyRepository{
+		DB: DB,
+	}
+}
+
+func (r *loyaltyRepository) GetLoyaltyPoints(user_id uint, limit, offset int) (models.LoyaltyPoints, error) {
+	// Customers without an account have no points
+	var account domain.LoyaltyAccount
+	if err := r.DB.Where("user_id = ?", user_id).Limit(1).Find(&account).Error; err != nil {
+		return models.LoyaltyPoints{}, err
+	}
+	// Get the entries of the ledger, the latest first
+	var total int64
+	entries := []models.LoyaltyEntry{}
+	if account.ID != 0 {
+		query := r.DB.Model(&domain.LoyaltyEntry{}).Where("account_id = ?", account.ID)
+		if err := query.Count(&total).Error; err != nil {
+			return models.LoyaltyPoints{}, err
+		}
+		if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&entries).Error; err != nil {
+			return models.LoyaltyPoints{}, err
+		}
+	}
+	// Return the points
+	return models.LoyaltyPoints{
+		Points:  account.Points,
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+func (r *loyaltyRepository) GetExpiringPoints(user_id uint, before time.Time) (uint64, error) {
+	var points uint64
+	err := r.DB.Model(&domain.LoyaltyEntry{}).
+		Select("COALESCE(SUM(loyalty_entries.remaining), 0)").
+		Joins("JOIN loyalty_accounts ON loyalty_accounts.id = loyalty_entries.account_id").
+		Where("loyalty_accounts.user_id = ? AND loyalty_entries.type = ?", user_id, models.LoyaltyEntryEarn).
+		Where("loyalty_entries.remaining > 0 AND loyalty_entries.expires_at <= ?", before).
+		Scan(&points).Error
+	if err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+func (r *loyaltyRepository) GetYearSpend(user_id uint, since time.Time) (uint64, error) {
+	// Sum up what is kept of the orders delivered since then
+	var spend uint64
+	err := r.DB.Model(&domain.Order{}).
+		Select("COALESCE(SUM(orders.final_price - LEAST(orders.refunded_amount, orders.final_price)), 0)").
+		Where("orders.user_id = ? AND orders.order_status = ?", user_id, models.OrderStatusDelivered).
+		Where(`EXISTS (SELECT 1 FROM order_status_histories
+			WHERE order_status_histories.order_id = orders.id
+			AND order_status_histories.to_status = ?
+			AND order_status_histories.created_at >= ?)`, models.OrderStatusDelivered, since).
+		Scan(&spend).Error
+	if err != nil {
+		return 0, err
+	}
+	return spend, nil
+}
+
+func (r *loyaltyRepository) RedeemPoints(user_id uint, points uint64, now time.Time) (models.LoyaltyEntry, error) {
+	var entry domain.LoyaltyEntry
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		account, err := lockLoyaltyAccount(tx, user_id)
+		if err != nil {
+			return err
+		}
+		// Expired points can not be redeemed
+		if err := expireLoyaltyLots(tx, &account, now); err != nil {
+			return err
+		}
+		// Spend the points that expire first
+		if err := spendLoyaltyLots(tx, account.ID, points); err != nil {
+			return err
+		}
+		entry, err = addLoyaltyEntry(tx, &account, domain.LoyaltyEntry{
+			Type:   models.LoyaltyEntryRedeem,
+			Points: -int64(points),
+			Note:   "Đổi điểm lấy tiền vào ví",
+		})
+		if err != nil {
+			return err
+		}
+		// Credit the value of the points to the wallet
+		_, err = moveWallet(tx, user_id, domain.WalletEntry{
+			Type:   models.WalletEntryLoyalty,
+			Amount: int64(points * models.LoyaltyPointValue),
+			Reason: fmt.Sprintf("Đổi %d điểm tích lũy", points),
+		})
+		return err
+	})
+	if err != nil {
+		return models.LoyaltyEntry{}, err
+	}
+	return loyaltyEntry(entry), nil
+}
+
+func (r *loyaltyRepository) ExpirePoints(now time.Time) (int, error) {
+	// Find the customers with points due to expire
+	var user_ids []uint
+	err := r.DB.Model(&domain.LoyaltyAccount{}).
+		Where(`id IN (SELECT account_id FROM loyalty_entries
+			WHERE type = ? AND remaining > 0 AND expires_at <= ? AND deleted_at IS NULL)`,
+			models.LoyaltyEntryEarn, now).
+		Pluck("user_id", &user_ids).Error
+	if err != nil {
+		return 0, err
+	}
+	// Expire the points of every customer in their own transaction
+	for _, user_id := range user_ids {
+		err := r.DB.Transaction(func(tx *gorm.DB) error {
+			account, err := lockLoyaltyAccount(tx, user_id)
+			if err != nil {
+				return err
+			}
+			return expireLoyaltyLots(tx, &account, now)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(user_ids), nil
+}
+
+// awardLoyaltyPoints gives the customer of a delivered order a point for every
+// models.LoyaltyEarnUnit of its price. The points expire after models.LoyaltyPointsLifetime.
+func awardLoyaltyPoints(tx *gorm.DB, order domain.Order) error {
+	points := order.FinalPrice / models.LoyaltyEarnUnit
+	if points == 0 {
+		return nil
+	}
+	account, err := lockLoyaltyAccount(tx, order.UserID)
+	if err != nil {
+		return err
+	}
+	expires_at := time.Now().Add(models.LoyaltyPointsLifetime)
+	_, err = addLoyaltyEntry(tx, &account, domain.LoyaltyEntry{
+		Type:      models.LoyaltyEntryEarn,
+		Points:    int64(points),
+		Remaining: points,
+		OrderID:   &order.ID,
+		ExpiresAt: &expires_at,
+		Note:      fmt.Sprintf("Tích điểm đơn hàng #%d", order.ID),
+	})
+	return err
+}
+
+// revokeLoyaltyPoints takes back what is left of the points earned by a returned order.
+// The points already redeemed are not taken back.
+func revokeLoyaltyPoints(tx *gorm.DB, order_id uint) error {
+	// Find the points earned by the order
+	var lot domain.LoyaltyEntry
+	result := tx.Where("order_id = ? AND type = ? AND remaining > 0", order_id, models.LoyaltyEntryEarn).
+		Limit(1).
+		Find(&lot)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	// Lock the account, then read the lot again as it may have been spent meanwhile
+	var account domain.LoyaltyAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, lot.AccountID).Error; err != nil {
+		return err
+	}
+	if err := tx.First(&lot, lot.ID).Error; err != nil {
+		return err
+	}
+	if lot.Remaining == 0 {
+		return nil
+	}
+	if err := tx.Model(&lot).Update("remaining", 0).Error; err != nil {
+		return err
+	}
+	_, err := addLoyaltyEntry(tx, &account, domain.LoyaltyEntry{
+		Type:    models.LoyaltyEntryRevoke,
+		Points:  -int64(lot.Remaining),
+		OrderID: &order_id,
+		Note:    fmt.Sprintf("Thu hồi điểm đơn hàng #%d bị hoàn trả", order_id),
+	})
+	return err
+}
+
+// lockLoyaltyAccount locks the loyalty account of the customer, creating it if needed.
+func lockLoyaltyAccount(tx *gorm.DB, user_id uint) (domain.LoyaltyAccount, error) {
+	// Create the account on its first use
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.LoyaltyAccount{UserID: user_id}).Error; err != nil {
+		return domain.LoyaltyAccount{}, err
+	}
+	var account domain.LoyaltyAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", user_id).
+		First(&account).Error; err != nil {
+		return domain.LoyaltyAccount{}, err
+	}
+	return account, nil
+}
+
+// addLoyaltyEntry applies e.Points to the locked account and records the entry in the ledger.
+// It returns models.ErrInsufficientPoints if the points would drop below zero.
+func addLoyaltyEntry(tx *gorm.DB, account *domain.LoyaltyAccount, e domain.LoyaltyEntry) (domain.LoyaltyEntry, error) {
+	points := int64(account.Points) + e.Points
+	if points < 0 {
+		return domain.LoyaltyEntry{}, models.ErrInsufficientPoints
+	}
+	if err := tx.Model(&domain.LoyaltyAccount{}).
+		Where("id = ?", account.ID).
+		Update("points", points).Error; err != nil {
+		return domain.LoyaltyEntry{}, err
+	}
+	account.Points = uint64(points)
+	// Record the entry
+	e.AccountID = account.ID
+	e.PointsAfter = account.Points
+	if err := tx.Create(&e).Error; err != nil {
+		return domain.LoyaltyEntry{}, err
+	}
+	return e, nil
+}
+
+// expireLoyaltyLots expires what is left of the points of the locked account that
+// expired by now, one entry for every lot of points.
+func expireLoyaltyLots(tx *gorm.DB, account *domain.LoyaltyAccount, now time.Time) error {
+	var lots []domain.LoyaltyEntry
+	if err := tx.Where("account_id = ? AND type = ? AND remaining > 0 AND expires_at <= ?",
+		account.ID, models.LoyaltyEntryEarn, now).
+		Order("expires_at ASC, id ASC").
+		Find(&lots).Error; err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		if err := tx.Model(&lot).Update("remaining", 0).Error; err != nil {
+			return err
+		}
+		if _, err := addLoyaltyEntry(tx, account, domain.LoyaltyEntry{
+			Type:    models.LoyaltyEntryExpire,
+			Points:  -int64(lot.Remaining),
+			OrderID: lot.OrderID,
+			Note:    "Điểm tích lũy hết hạn",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spendLoyaltyLots takes points from the lots of the locked account, those expiring
+// first being spent first.
+// It returns models.ErrInsufficientPoints if the lots do not have enough points.
+func spendLoyaltyLots(tx *gorm.DB, account_id uint, points uint64) error {
+	var lots []domain.LoyaltyEntry
+	if err := tx.Where("account_id = ? AND type = ? AND remaining > 0", account_id, models.LoyaltyEntryEarn).
+		Order("expires_at ASC, id ASC").
+		Find(&lots).Error; err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		if points == 0 {
+			break
+		}
+		spent := min(lot.Remaining, points)
+		if err := tx.Model(&lot).Update("remaining", lot.Remaining-spent).Error; err != nil {
+			return err
+		}
+		points -= spent
+	}
+	if points > 0 {
+		return models.ErrInsufficientPoints
+	}
+	return nil
+}
+
+func loyaltyEntry(e domain.LoyaltyEntry) models.LoyaltyEntry {
+	return models.LoyaltyEntry{
+		ID:          e.ID,
+		Type:        e.Type,
+		Points:      e.Points,
+		PointsAfter: e.PointsAfter,
+		Remaining:   e.Remaining,
+		OrderID:     e.OrderID,
+		ExpiresAt:   e.ExpiresAt,
+		Note:        e.Note,
+		CreatedAt:   e.CreatedAt,
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OfferRepository interface {
+	AddOffer(offer models.Offer) (models.Offer, error)
+	UpdateOffer(offer_id uint, offer models.Offer) (models.Offer, error)
+	DeleteOffer(offer_id uint) error
+	GetOffer(offer_id uint) (models.Offer, error)
+	ListAllOffers(limit, offset int) (models.ListOffers, error)
+	ListActiveOffers() ([]models.Offer, error)
+	GetOfferCategory(offer models.Offer) (models.Category, error)
+}
+
+type offerRepository struct {
+	DB *gorm.DB
+}
+
+func NewOfferRepository(DB *gorm.DB) OfferRepository {
+	return &offerRepository{
+		DB: DB,
+	}
+}
+
+// offerFields are the columns written when an offer is updated, so zero values are saved too.
+var offerFields = []string{
+	"name", "scope", "product_id", "category_id", "category", "size", "offer_rate", "start_at", "expire_at", "valid",
+}
+
+// offerPriceSQL is the effective discount price of a price row: the lowest of its own
+// discount price and the prices given by the offers running now on its product, size
+// or category. A category offer also runs on the categories below its own. Offer rates
+// are taken off the original price.
+var offerPriceSQL = `LEAST(pr.discount_price, (
+	SELECT pr.original_price * (100 - MAX(o.offer_rate)) / 100 FROM offers o
+	WHERE o.valid = true AND o.deleted_at IS NULL AND o.start_at <= NOW() AND o.expire_at > NOW()
+	AND ((o.scope = 'PRODUCT' AND o.product_id = pr.product_id)
+		OR (o.scope = 'SIZE' AND o.product_id = pr.product_id AND o.size = pr.size)
+		OR (o.scope = 'CATEGORY' AND (SELECT op.category_id FROM products op WHERE op.id = pr.product_id)
+			IN (` + categorySubtreeOf("o.category_id") + `)))))`
+
+// effectivePrice returns offerPriceSQL for the prices table referred to by alias.
+func effectivePrice(alias string) string {
+	return strings.ReplaceAll(offerPriceSQL, "pr.", alias+".")
+}
+
+func (r *offerRepository) AddOffer(o models.Offer) (models.Offer, error) {
+	// Define the offer
+	offer := domain.Offer{
+		Name:       o.Name,
+		Scope:      o.Scope,
+		ProductID:  o.ProductID,
+		CategoryID: o.CategoryID,
+		Category:   o.Category,
+		Size:       o.Size,
+		OfferRate:  o.OfferRate,
+		StartAt:    o.StartAt,
+		ExpireAt:   o.ExpireAt,
+		Valid:      true,
+	}
+	// Create the offer
+	if err := r.DB.Create(&offer).Error; err != nil {
+		return models.Offer{}, err
+	}
+	// Return the offer
+	return r.GetOffer(offer.ID)
+}
+
+func (r *offerRepository) UpdateOffer(offer_id uint, o models.Offer) (models.Offer, error) {
+	// Update the offer
+	result := r.DB.Model(&domain.Offer{}).
+		Where("id = ?", offer_id).
+		Select(offerFields).
+		Updates(domain.Offer{
+			Name:       o.Name,
+			Scope:      o.Scope,
+			ProductID:  o.ProductID,
+			CategoryID: o.CategoryID,
+			Category:   o.Category,
+			Size:       o.Size,
+			OfferRate:  o.OfferRate,
+			StartAt:    o.StartAt,
+			ExpireAt:   o.ExpireAt,
+			Valid:      o.Valid,
+		})
+	if result.Error != nil {
+		return models.Offer{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Offer{}, models.ErrEntityNotFound
+	}
+	// Return the updated offer
+	return r.GetOffer(offer_id)
+}
+
+func (r *offerRepository) DeleteOffer(offer_id uint) error {
+	// Delete the offer
+	result := r.DB.Delete(&domain.Offer{}, offer_id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *offerRepository) GetOffer(offer_id uint) (models.Offer, error) {
+	// Define the offer
+	var offer models.Offer
+	// Query to get the offer
+	err := r.DB.Model(&domain.Offer{}).
+		Where("id = ?", offer_id).
+		First(&offer).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Offer{}, models.ErrEntityNotFound
+		}
+		return models.Offer{}, err
+	}
+	// Return the offer
+	return offer, nil
+}
+
+func (r *offerRepository) ListAllOffers(limit, offset int) (models.ListOffers, error) {
+	// Define the list of offers
+	var offers []models.Offer
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.Offer{})
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListOffers{}, err
+	}
+	if err := query.Order("start_at DESC").Offset(offset).Limit(limit).Find(&offers).Error; err != nil {
+		return models.ListOffers{}, err
+	}
+	// Return the list of offers
+	return models.ListOffers{
+		Offers: offers,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}, nil
+}
+
+func (r *offerRepository) ListActiveOffers() ([]models.Offer, error) {
+	// Define the list of offers
+	var offers []models.Offer
+	// Query to get the offers running now
+	now := time.Now()
+	err := r.DB.Model(&domain.Offer{}).
+		Where("valid = true AND start_at <= ? AND expire_at > ?", now, now).
+		Order("expire_at ASC").
+		Find(&offers).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the list of offers
+	return offers, nil
+}
+
+func (r *offerRepository) GetOfferCategory(o models.Offer) (models.Category, error) {
+	// Find the category by id, slug or name like the products do
+	category, err := productCategory(r.DB, models.Product{CategoryID: o.CategoryID, Category: o.Category})
+	if err != nil {
+		return models.Category{}, err
+	}
+	return categoryModel(category), nil
+}
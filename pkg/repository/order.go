@@ -3,18 +3,33 @@ package repository
 import (
 	"ahava/pkg/domain"
 	"ahava/pkg/utils/models"
+	"fmt"
+	"sort"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository interface {
-	PlaceOrder(order models.PlaceOrder, final_price uint64) (models.Order, error)
-	PlaceOrderItem(order_id uint, item models.CartItem) error
+	PlaceOrder(order models.PlaceOrder, checkout models.CheckOut) (models.Order, error)
 	GetOrderItems(order_id uint) ([]models.OrderItem, error)
+	GetOrdersItems(order_ids []uint) (map[uint][]models.OrderItem, error)
 	ListAllOrders(limit, offset int) (models.ListOrders, error)
 	GetOrderDetails(user_id, order_id uint) (models.Order, error)
-	GetOrderForWebhook(order_id uint) (models.Order, error)
+	GetOrderPayments(order_id uint) ([]models.Transaction, error)
 	UpdateOrder(order_id uint, order models.Order) (models.Order, error)
+
+	GetOrder(order_id uint) (models.Order, error)
+	UpdateOrderStatus(order_id uint, history models.OrderStatusHistory) (models.Order, error)
+	GetOrderStatusHistory(order_id uint) ([]models.OrderStatusHistory, error)
+
+	CreateReturnRequest(user_id, order_id uint, reason string) (models.ReturnRequest, error)
+	GetReturnRequest(return_id uint) (models.ReturnRequest, error)
+	GetOrderReturnRequests(order_id uint) ([]models.ReturnRequest, error)
+	ListReturnRequests(status string, limit, offset int) (models.ListReturnRequests, error)
+	ApproveReturnRequest(return_id uint, review models.ReturnRequest, history models.OrderStatusHistory) (models.ReturnRequest, error)
+	RejectReturnRequest(return_id uint, review models.ReturnRequest) (models.ReturnRequest, error)
 }
 
 type orderRepository struct {
@@ -27,75 +42,194 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	}
 }
 
-func (r *orderRepository) PlaceOrder(o models.PlaceOrder, final_price uint64) (models.Order, error) {
+func (r *orderRepository) PlaceOrder(o models.PlaceOrder, checkout models.CheckOut) (models.Order, error) {
 	// Define the order
 	order := domain.Order{
-		UserID:        o.UserID,
-		Address:       o.Address,
-		Name:          o.Name,
-		Phone:         o.Phone,
-		PaymentMethod: o.PaymentMethod,
-		FinalPrice:    final_price,
-		Coupon:        o.Coupon,
-	}
-	// Create the order
-	err := r.DB.Create(&order).Error
+		UserID:         o.UserID,
+		Address:        o.Address,
+		Name:           o.Name,
+		Phone:          o.Phone,
+		PaymentMethod:  o.PaymentMethod,
+		FinalPrice:     checkout.FinalPrice,
+		Coupon:         checkout.Coupon,
+		CouponDiscount: checkout.CouponDiscount,
+		TierDiscount:   checkout.TierDiscount,
+	}
+	items := checkout.CartItems
+	// Create the order, its items, reserve the stock and clear the cart in one transaction
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the checked out cart items, they must not have changed since the checkout
+		if err := lockCartItems(tx, o.UserID, items); err != nil {
+			return err
+		}
+		// Create the order
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		// Reserve the stock of the ordered sizes
+		if err := reserveStock(tx, order.ID, items); err != nil {
+			return err
+		}
+		// Redeem the applied coupon
+		if checkout.CouponID != 0 {
+			if err := redeemCoupon(tx, checkout.CouponID, o.UserID, order.ID, checkout.TotalDiscountedPrice, checkout.CouponDiscount); err != nil {
+				return err
+			}
+		}
+		// Create the order items
+		cart_ids := make([]uint, 0, len(items))
+		for _, item := range items {
+			if err := tx.Create(&domain.OrderItem{
+				OrderID:           order.ID,
+				ProductID:         item.ProductID,
+				Quantity:          item.Quantity,
+				Size:              item.Size,
+				OriginalPrice:     item.OriginalPrice,
+				DiscountPrice:     item.DiscountPrice,
+				ItemPrice:         item.ItemPrice,
+				ItemDiscountPrice: item.ItemDiscountPrice,
+			}).Error; err != nil {
+				return err
+			}
+			cart_ids = append(cart_ids, item.ID)
+		}
+		// Remove the checked out items from the cart
+		result := tx.Where("id IN ? AND user_id = ?", cart_ids, o.UserID).Delete(&domain.CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(cart_ids)) {
+			return models.ErrConflict
+		}
+		// Pay with the store credit, the rest is paid with the payment method
+		if o.UseWallet {
+			if _, err := payWithWallet(tx, order, o.WalletAmount); err != nil {
+				return err
+			}
+			return tx.First(&order, order.ID).Error
+		}
+		return nil
+	})
 	if err != nil {
 		return models.Order{}, err
 	}
 	// Return the order
 	return models.Order{
-		ID:            order.ID,
-		UserID:        order.UserID,
-		Address:       order.Address,
-		Name:          order.Name,
-		Phone:         order.Phone,
-		PaymentMethod: order.PaymentMethod,
-		FinalPrice:    order.FinalPrice,
-		Coupon:        order.Coupon,
-		OrderStatus:   order.OrderStatus,
-		PaymentStatus: order.PaymentStatus,
+		ID:             order.ID,
+		UserID:         order.UserID,
+		Address:        order.Address,
+		Name:           order.Name,
+		Phone:          order.Phone,
+		PaymentMethod:  order.PaymentMethod,
+		FinalPrice:     order.FinalPrice,
+		Coupon:         order.Coupon,
+		CouponDiscount: order.CouponDiscount,
+		TierDiscount:   order.TierDiscount,
+		PaidAmount:     order.PaidAmount,
+		OrderStatus:    order.OrderStatus,
+		PaymentStatus:  order.PaymentStatus,
 	}, nil
 }
 
-func (r *orderRepository) PlaceOrderItem(order_id uint, item models.CartItem) error {
-	// Create the order item
-	err := r.DB.Create(&domain.OrderItem{
-		OrderID:           order_id,
-		ProductID:         item.ProductID,
-		Quantity:          item.Quantity,
-		Size:              item.Size,
-		OriginalPrice:     item.OriginalPrice,
-		DiscountPrice:     item.DiscountPrice,
-		ItemPrice:         item.ItemPrice,
-		ItemDiscountPrice: item.ItemDiscountPrice},
-	).Error
-	if err != nil {
+// lockCartItems locks the cart items of the customer being checked out.
+// It returns models.ErrConflict if any of them was removed or changed meanwhile.
+func lockCartItems(tx *gorm.DB, user_id uint, items []models.CartItem) error {
+	cart_ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		cart_ids = append(cart_ids, item.ID)
+	}
+	var cart []domain.CartItem
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ? AND user_id = ?", cart_ids, user_id).
+		Order("id").
+		Find(&cart).Error; err != nil {
 		return err
 	}
+	if len(cart) != len(items) {
+		return models.ErrConflict
+	}
+	locked := make(map[uint]domain.CartItem, len(cart))
+	for _, item := range cart {
+		locked[item.ID] = item
+	}
+	for _, item := range items {
+		c, ok := locked[item.ID]
+		if !ok || c.ProductID != item.ProductID || c.Size != item.Size || c.Quantity != item.Quantity {
+			return models.ErrConflict
+		}
+	}
 	return nil
 }
 
-func (r *orderRepository) GetOrderForWebhook(order_id uint) (models.Order, error) {
-	// Define the order
-	var order models.Order
-	// Query to get the order details
-	err := r.DB.Raw(`SELECT id,final_price FROM orders WHERE id=?`,
-		order_id).Scan(&order).Error
+// reserveStock decrements the stock of every ordered size and records it in the stock ledger.
+// It returns models.ErrOutOfStock if any size does not have enough stock.
+func reserveStock(tx *gorm.DB, order_id uint, items []models.CartItem) error {
+	// Lock the price rows in a fixed order to avoid deadlocks
+	sorted := make([]models.CartItem, len(items))
+	copy(sorted, items)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ProductID != sorted[j].ProductID {
+			return sorted[i].ProductID < sorted[j].ProductID
+		}
+		return sorted[i].Size < sorted[j].Size
+	})
+	// Decrement the stock
+	for _, item := range sorted {
+		_, err := moveStock(tx, domain.StockMovement{
+			ProductID: item.ProductID,
+			Size:      item.Size,
+			Change:    -int(item.Quantity),
+			Type:      models.StockMovementOrder,
+			OrderID:   order_id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restockOrderItems puts the quantities of the order items back into stock, less what
+// refunds have already put back. Sizes that no longer exist are skipped.
+func restockOrderItems(tx *gorm.DB, order_id uint, movement_type string) error {
+	var items []domain.OrderItem
+	if err := tx.Where("order_id = ?", order_id).Order("product_id, size").Find(&items).Error; err != nil {
+		return err
+	}
+	restocked, err := refundedQuantities(tx, order_id, true)
 	if err != nil {
-		return models.Order{}, err
+		return err
 	}
-	// Return the order details
-	return order, nil
+	for _, item := range items {
+		quantity := int(item.Quantity) - int(restocked[item.ID])
+		if quantity <= 0 {
+			continue
+		}
+		_, err := moveStock(tx, domain.StockMovement{
+			ProductID: item.ProductID,
+			Size:      item.Size,
+			Change:    quantity,
+			Type:      movement_type,
+			OrderID:   order_id,
+		})
+		if err != nil && err != models.ErrEntityNotFound {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *orderRepository) GetOrderDetails(user_id, order_id uint) (models.Order, error) {
 	// Define the order
 	var order models.Order
 	// Query to get the order details
-	err := r.DB.Where("order_id=? AND user_id=?").
-		Find(&order).Error
+	err := r.DB.Model(&domain.Order{}).
+		Where("id = ? AND user_id = ?", order_id, user_id).
+		First(&order).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Order{}, models.ErrEntityNotFound
+		}
 		return models.Order{}, err
 	}
 	// Return the order details
@@ -124,6 +258,293 @@ func (r *orderRepository) UpdateOrder(order_id uint, o models.Order) (models.Ord
 	return order, nil
 }
 
+func (r *orderRepository) GetOrder(order_id uint) (models.Order, error) {
+	// Define the order
+	var order models.Order
+	// Query to get the order
+	err := r.DB.Model(&domain.Order{}).
+		Where("id = ?", order_id).
+		First(&order).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Order{}, models.ErrEntityNotFound
+		}
+		return models.Order{}, err
+	}
+	// Return the order
+	return order, nil
+}
+
+func (r *orderRepository) UpdateOrderStatus(order_id uint, h models.OrderStatusHistory) (models.Order, error) {
+	// Define the order
+	var order models.Order
+	// Update the status and record the history in one transaction
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateOrderStatus(tx, order_id, h); err != nil {
+			return err
+		}
+		// Get the updated order
+		return tx.Model(&domain.Order{}).Where("id = ?", order_id).First(&order).Error
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Return the updated order
+	return order, nil
+}
+
+// updateOrderStatus moves the order from h.FromStatus to h.ToStatus and records the change.
+// It returns models.ErrConflict if the order is no longer in h.FromStatus.
+func updateOrderStatus(tx *gorm.DB, order_id uint, h models.OrderStatusHistory) error {
+	// Only update if the order is still in the expected status
+	result := tx.Model(&domain.Order{}).
+		Where("id = ? AND order_status = ?", order_id, h.FromStatus).
+		Update("order_status", h.ToStatus)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConflict
+	}
+	// Release the reserved stock and coupon of canceled orders
+	if h.ToStatus == models.OrderStatusCanceled {
+		if err := restockOrderItems(tx, order_id, models.StockMovementCancel); err != nil {
+			return err
+		}
+		if err := releaseCoupon(tx, order_id); err != nil {
+			return err
+		}
+		// Give back what has been paid for the order
+		reason := fmt.Sprintf("Hoàn tiền đơn hàng #%d bị hủy", order_id)
+		if err := refundOrderPayments(tx, order_id, false, reason, statusAdmin(h)); err != nil {
+			return err
+		}
+	}
+	if h.ToStatus == models.OrderStatusDelivered {
+		var order domain.Order
+		if err := tx.Select("id", "user_id", "final_price").First(&order, order_id).Error; err != nil {
+			return err
+		}
+		// The referrer is rewarded once the order is delivered, as it can no longer be canceled
+		if err := rewardReferral(tx, order.UserID, order.ID); err != nil {
+			return err
+		}
+		// Delivered orders earn loyalty points
+		if err := awardLoyaltyPoints(tx, order); err != nil {
+			return err
+		}
+	}
+	// Returned orders lose the points and the referral reward they earned and give back
+	// what was paid with the wallet, the other payments are refunded with the returned items
+	if h.ToStatus == models.OrderStatusReturned {
+		if err := revokeLoyaltyPoints(tx, order_id); err != nil {
+			return err
+		}
+		if err := revokeReferral(tx, order_id); err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("Hoàn tiền đơn hàng #%d được hoàn trả", order_id)
+		if err := refundOrderPayments(tx, order_id, true, reason, statusAdmin(h)); err != nil {
+			return err
+		}
+	}
+	// Record the status change
+	return tx.Create(&domain.OrderStatusHistory{
+		OrderID:       order_id,
+		FromStatus:    h.FromStatus,
+		ToStatus:      h.ToStatus,
+		ChangedBy:     h.ChangedBy,
+		ChangedByRole: h.ChangedByRole,
+		Note:          h.Note,
+	}).Error
+}
+
+// statusAdmin returns the admin who changed the status, 0 for the customer.
+func statusAdmin(h models.OrderStatusHistory) uint {
+	if h.ChangedByRole == models.ChangedByAdmin {
+		return h.ChangedBy
+	}
+	return 0
+}
+
+func (r *orderRepository) GetOrderStatusHistory(order_id uint) ([]models.OrderStatusHistory, error) {
+	// Define the status history
+	var history []models.OrderStatusHistory
+	// Query to get the status history of the order
+	err := r.DB.Model(&domain.OrderStatusHistory{}).
+		Where("order_id = ?", order_id).
+		Order("created_at ASC").
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the status history
+	return history, nil
+}
+
+func (r *orderRepository) CreateReturnRequest(user_id, order_id uint, reason string) (models.ReturnRequest, error) {
+	// Define the return request
+	request := domain.ReturnRequest{
+		OrderID: order_id,
+		UserID:  user_id,
+		Reason:  reason,
+	}
+	// Check the order and create the request under the lock of the order, so that
+	// concurrent requests can not both pass the check
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var order domain.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", order_id, user_id).
+			First(&order).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		// Only delivered orders can be returned
+		if order.OrderStatus != models.OrderStatusDelivered {
+			return models.ErrInvalidStatusTransition
+		}
+		// Check if there is already an open or approved request
+		var count int64
+		if err := tx.Model(&domain.ReturnRequest{}).
+			Where("order_id = ? AND status <> ?", order_id, models.ReturnStatusRejected).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrAlreadyExists
+		}
+		// Create the return request
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the return request
+	return models.ReturnRequest{
+		ID:        request.ID,
+		OrderID:   request.OrderID,
+		UserID:    request.UserID,
+		Reason:    request.Reason,
+		Status:    request.Status,
+		CreatedAt: request.CreatedAt,
+	}, nil
+}
+
+func (r *orderRepository) GetReturnRequest(return_id uint) (models.ReturnRequest, error) {
+	// Define the return request
+	var request models.ReturnRequest
+	// Query to get the return request
+	err := r.DB.Model(&domain.ReturnRequest{}).
+		Where("id = ?", return_id).
+		First(&request).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ReturnRequest{}, models.ErrEntityNotFound
+		}
+		return models.ReturnRequest{}, err
+	}
+	// Return the return request
+	return request, nil
+}
+
+func (r *orderRepository) GetOrderReturnRequests(order_id uint) ([]models.ReturnRequest, error) {
+	// Define the return requests
+	var requests []models.ReturnRequest
+	// Query to get the return requests of the order
+	err := r.DB.Model(&domain.ReturnRequest{}).
+		Where("order_id = ?", order_id).
+		Order("created_at DESC").
+		Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the return requests
+	return requests, nil
+}
+
+func (r *orderRepository) ListReturnRequests(status string, limit, offset int) (models.ListReturnRequests, error) {
+	// Define the list of return requests
+	var requests []models.ReturnRequest
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.ReturnRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListReturnRequests{}, err
+	}
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&requests).Error; err != nil {
+		return models.ListReturnRequests{}, err
+	}
+	// Return the list of return requests
+	return models.ListReturnRequests{
+		ReturnRequests: requests,
+		Total:          total,
+		Limit:          limit,
+		Offset:         offset,
+	}, nil
+}
+
+func (r *orderRepository) ApproveReturnRequest(return_id uint, review models.ReturnRequest, history models.OrderStatusHistory) (models.ReturnRequest, error) {
+	// Define the return request
+	var request models.ReturnRequest
+	// Approve the request and mark the order as returned in one transaction
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reviewReturnRequest(tx, return_id, models.ReturnStatusApproved, review); err != nil {
+			return err
+		}
+		if err := updateOrderStatus(tx, review.OrderID, history); err != nil {
+			return err
+		}
+		// Get the updated return request
+		return tx.Model(&domain.ReturnRequest{}).Where("id = ?", return_id).First(&request).Error
+	})
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the updated return request
+	return request, nil
+}
+
+func (r *orderRepository) RejectReturnRequest(return_id uint, review models.ReturnRequest) (models.ReturnRequest, error) {
+	// Define the return request
+	var request models.ReturnRequest
+	// Reject the request
+	if err := reviewReturnRequest(r.DB, return_id, models.ReturnStatusRejected, review); err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Get the updated return request
+	err := r.DB.Model(&domain.ReturnRequest{}).Where("id = ?", return_id).First(&request).Error
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the updated return request
+	return request, nil
+}
+
+// reviewReturnRequest closes a pending return request with the given status.
+// It returns models.ErrConflict if the request has already been reviewed.
+func reviewReturnRequest(tx *gorm.DB, return_id uint, status string, review models.ReturnRequest) error {
+	result := tx.Model(&domain.ReturnRequest{}).
+		Where("id = ? AND status = ?", return_id, models.ReturnStatusPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"admin_note":  review.AdminNote,
+			"reviewed_by": review.ReviewedBy,
+			"reviewed_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConflict
+	}
+	return nil
+}
+
 func (r *orderRepository) ListAllOrders(limit, offset int) (models.ListOrders, error) {
 	// Define the list of orders
 	var orders []models.Order
@@ -149,6 +570,21 @@ func (r *orderRepository) ListAllOrders(limit, offset int) (models.ListOrders, e
 	}, nil
 }
 
+func (r *orderRepository) GetOrderPayments(order_id uint) ([]models.Transaction, error) {
+	// Define the payments
+	var payments []models.Transaction
+	// Query to get the transfers received for the order
+	err := r.DB.Model(&domain.Transaction{}).
+		Where("order_id = ? AND reference_code <> ''", order_id).
+		Order("created_at ASC").
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the payments
+	return payments, nil
+}
+
 func (r *orderRepository) GetOrderItems(order_id uint) ([]models.OrderItem, error) {
 	// Define the order items
 	var orderItems []models.OrderItem
@@ -162,6 +598,27 @@ func (r *orderRepository) GetOrderItems(order_id uint) ([]models.OrderItem, erro
 	return orderItems, nil
 }
 
+func (r *orderRepository) GetOrdersItems(order_ids []uint) (map[uint][]models.OrderItem, error) {
+	// Define the order items keyed by order
+	items := make(map[uint][]models.OrderItem, len(order_ids))
+	if len(order_ids) == 0 {
+		return items, nil
+	}
+	// Query to get the items of all the orders at once
+	var orderItems []models.OrderItem
+	err := r.DB.Where("order_id IN ?", order_ids).
+		Order("order_id, id").
+		Find(&orderItems).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range orderItems {
+		items[item.OrderID] = append(items[item.OrderID], item)
+	}
+	// Return the order items
+	return items, nil
+}
+
 // func (r *orderRepository) GetOrders(order models.) ([]domain.Order, error) {
 
 // 	var orders []domain.Order
@@ -319,16 +776,6 @@ func (r *orderRepository) GetOrderItems(order_id uint) ([]models.OrderItem, erro
 // 	return amount, nil
 // }
 
-// func (i *orderRepository) CreditToUserWallet(amount float64, walletid uint) error {
-
-// 	if err := i.DB.Exec("update wallets set amount=$1 where id=$2", amount, walletId).Error; err != nil {
-// 		return err
-// 	}
-
-// 	return nil
-
-// }
-
 // func (o *orderRepository) FindUserIdFromOrderID(id uint) (int, error) {
 
 // 	var userID uint
@@ -340,41 +787,6 @@ func (r *orderRepository) GetOrderItems(order_id uint) ([]models.OrderItem, erro
 // 	return userID, nil
 // }
 
-// func (o *orderRepository) FindWalletIdFromUserID(userID uint) (int, error) {
-
-// 	var count int
-// 	err := o.DB.Raw("select count(*) from wallets where user_id = ?", userId).Scan(&count).Error
-// 	if err != nil {
-// 		return 0, err
-// 	}
-
-// 	var walletid uint
-// 	if count > 0 {
-// 		err := o.DB.Raw("select id from wallets where user_id = ?", userId).Scan(&walletID).Error
-// 		if err != nil {
-// 			return 0, err
-// 		}
-// 	}
-
-// 	return walletID, nil
-
-// }
-
-// func (o *orderRepository) CreateNewWallet(userID uint) (int, error) {
-
-// 	var walletid uint
-// 	err := o.DB.Exec("Insert into wallets(user_id,amount) values($1,$2)", userID, 0).Error
-// 	if err != nil {
-// 		return 0, err
-// 	}
-
-// 	if err := o.DB.Raw("select id from wallets where user_id=$1", userID).Scan(&walletID).Error; err != nil {
-// 		return 0, err
-// 	}
-
-// 	return walletID, nil
-// }
-
 // func (o *orderRepository) MakePaymentStatusAsPaid(id uint) error {
 
 // 	err := o.DB.Exec("UPDATE orders SET payment_status = 'PAID' WHERE id = $1", id).Error
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"crypto/subtle"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OtpRepository interface {
+	FindUserByMobileNumber(phones []string) (domain.User, error)
+	FindUserByEmail(email string) (domain.User, error)
+	CreateOtp(user_id uint, purpose, channel, target, code_hash string, expires_at time.Time) error
+	CountOtps(user_id uint, purpose string, since time.Time) (int64, error)
+	VerifyOtp(user_id uint, purpose, code_hash string, max_attempts uint) error
+}
+
+type otpRepository struct {
+	DB *gorm.DB
+}
+
+func NewOtpRepository(DB *gorm.DB) OtpRepository {
+	return &otpRepository{
+		DB: DB,
+	}
+}
+
+func (r *otpRepository) FindUserByMobileNumber(phones []string) (domain.User, error) {
+	// Phones are stored in different forms, match any of them
+	var user domain.User
+	err := r.DB.Where("phone IN ?", phones).Order("id ASC").First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return domain.User{}, models.ErrEntityNotFound
+		}
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (r *otpRepository) FindUserByEmail(email string) (domain.User, error) {
+	var user domain.User
+	err := r.DB.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return domain.User{}, models.ErrEntityNotFound
+		}
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (r *otpRepository) CreateOtp(user_id uint, purpose, channel, target, code_hash string, expires_at time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the latest code can be used
+		now := time.Now()
+		if err := tx.Model(&domain.Otp{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?", user_id, purpose, now).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&domain.Otp{
+			UserID:    user_id,
+			Purpose:   purpose,
+			Channel:   channel,
+			Target:    target,
+			CodeHash:  code_hash,
+			ExpiresAt: expires_at,
+		}).Error
+	})
+}
+
+func (r *otpRepository) CountOtps(user_id uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := r.DB.Model(&domain.Otp{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user_id, purpose, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *otpRepository) VerifyOtp(user_id uint, purpose, code_hash string, max_attempts uint) error {
+	mismatch := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the latest code
+		var otp domain.Otp
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", user_id, purpose).
+			Order("id DESC").
+			First(&otp).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrValidateOTP
+			}
+			return err
+		}
+		if !otp.ExpiresAt.After(time.Now()) {
+			return models.ErrValidateOTP
+		}
+		if otp.Attempts >= max_attempts {
+			return models.ErrTooManyRequests
+		}
+		// Count the wrong attempt, the code is dropped once the limit is reached
+		if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(code_hash)) != 1 {
+			mismatch = true
+			return tx.Model(&otp).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		// The code can be used only once
+		return tx.Model(&otp).Update("consumed_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+	if mismatch {
+		return models.ErrValidateOTP
+	}
+	return nil
+}
@@ -3,13 +3,23 @@ package repository
 import (
 	"ahava/pkg/domain"
 	"ahava/pkg/utils/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepository interface {
-	CreateQR(qr models.CreateQR, user_id uint) error
+	CreatePendingPayment(user_id uint, provider string, intent models.PaymentIntent) error
+	GetPendingPayment(order_id uint, provider string, amount uint64) (models.PaymentIntent, error)
+	ExpirePendingPayments(order_id uint) error
+	CheckPaymentCode(code string) (bool, error)
+	GetPaymentMethod(payment_name string) (models.PaymentMethod, error)
+	ListEnabledPaymentMethods() ([]models.PaymentMethod, error)
 	SaveTransaction(transaction models.Transaction) (models.Transaction, error)
+	CheckReferenceCode(reference_code string) (bool, error)
+	SaveWebhookEvent(gateway, client_ip string, payload []byte) (uint, error)
+	UpdateWebhookEvent(event_id uint, reference_code, status, message string) error
 }
 
 type paymentRepository struct {
@@ -22,23 +32,116 @@ func NewPaymentRepository(db *gorm.DB) PaymentRepository {
 	}
 }
 
-func (r *paymentRepository) CreateQR(qr models.CreateQR, user_id uint) error {
+func (r *paymentRepository) CreatePendingPayment(user_id uint, provider string, intent models.PaymentIntent) error {
 
-	if err := r.DB.Exec(`INSERT INTO transactions (user_id,order_id,code) VALUES (?,?,?)`, user_id, qr.OrderID, qr.Description).Error; err != nil {
+	if err := r.DB.Exec(`INSERT INTO transactions (user_id,order_id,provider,code,amount,expire_at,created_at,updated_at) VALUES (?,?,?,?,?,?,NOW(),NOW())`,
+		user_id, intent.OrderID, provider, intent.Description, intent.Amount, intent.ExpireAt).Error; err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (r *paymentRepository) SaveTransaction(t models.Transaction) (models.Transaction, error) {
+func (r *paymentRepository) GetPendingPayment(order_id uint, provider string, amount uint64) (models.PaymentIntent, error) {
+	// Define the transaction
+	var transaction domain.Transaction
+	// Query to get the latest unpaid payment of the order with the provider that has not expired
+	result := r.DB.Model(&domain.Transaction{}).
+		Where("order_id = ? AND provider = ? AND amount = ? AND expire_at > ?", order_id, provider, amount, time.Now()).
+		Where("reference_code IS NULL OR reference_code = ''").
+		Order("id DESC").
+		Limit(1).
+		Find(&transaction)
+	if result.Error != nil {
+		return models.PaymentIntent{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.PaymentIntent{}, models.ErrEntityNotFound
+	}
+	// Return the payment
+	return models.PaymentIntent{
+		OrderID:       transaction.OrderID,
+		PaymentMethod: transaction.Provider,
+		Amount:        transaction.Amount,
+		Description:   transaction.Code,
+		ExpireAt:      transaction.ExpireAt,
+	}, nil
+}
+
+func (r *paymentRepository) ExpirePendingPayments(order_id uint) error {
+	// Expire the unpaid payments of the order, transfers made to them are still recorded
+	return r.DB.Model(&domain.Transaction{}).
+		Where("order_id = ? AND expire_at > ?", order_id, time.Now()).
+		Where("reference_code IS NULL OR reference_code = ''").
+		Update("expire_at", time.Now()).Error
+}
+
+func (r *paymentRepository) GetPaymentMethod(payment_name string) (models.PaymentMethod, error) {
+	// Define the payment method
+	var method models.PaymentMethod
+	// Query to get the payment method
+	err := r.DB.Model(&domain.PaymentMethod{}).
+		Where("UPPER(payment_name) = UPPER(?)", payment_name).
+		First(&method).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.PaymentMethod{}, models.ErrEntityNotFound
+		}
+		return models.PaymentMethod{}, err
+	}
+	// Return the payment method
+	return method, nil
+}
 
-	var transaction models.Transaction
+func (r *paymentRepository) ListEnabledPaymentMethods() ([]models.PaymentMethod, error) {
+	// Define the payment methods
+	var methods []models.PaymentMethod
+	// Query to get the enabled payment methods
+	err := r.DB.Model(&domain.PaymentMethod{}).
+		Where("enable = true").
+		Order("id ASC").
+		Find(&methods).Error
+	if err != nil {
+		return nil, err
+	}
+	// Return the payment methods
+	return methods, nil
+}
 
-	result := r.DB.
-		Model(&domain.Transaction{}).
-		Where("code = ?", t.Code).
-		Updates(domain.Transaction{
+func (r *paymentRepository) CheckPaymentCode(code string) (bool, error) {
+	// Count the transactions using the payment code
+	var count int64
+	err := r.DB.Model(&domain.Transaction{}).
+		Where("code = ?", code).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *paymentRepository) SaveTransaction(t models.Transaction) (models.Transaction, error) {
+	// Define the transaction
+	var transaction domain.Transaction
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the transactions of the payment code, the one created with the QR code comes first
+		var transactions []domain.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ?", t.Code).
+			Order("id ASC").
+			Find(&transactions).Error; err != nil {
+			return err
+		}
+		if len(transactions) == 0 {
+			return models.ErrEntityNotFound
+		}
+		// A transfer can only be recorded once
+		for _, existing := range transactions {
+			if existing.ReferenceCode == t.ReferenceCode {
+				return models.ErrAlreadyExists
+			}
+		}
+		transfer := domain.Transaction{
 			Gateway:         t.Gateway,
 			TransactionDate: t.TransactionDate,
 			AccountNumber:   t.AccountNumber,
@@ -48,18 +151,138 @@ func (r *paymentRepository) SaveTransaction(t models.Transaction) (models.Transa
 			Accumulated:     t.Accumulated,
 			ReferenceCode:   t.ReferenceCode,
 			Description:     t.Description,
-		}).
-		Scan(&transaction)
+		}
+		if transactions[0].ReferenceCode == "" {
+			// The first transfer completes the transaction created with the QR code
+			transaction = transactions[0]
+			if err := tx.Model(&transaction).Updates(transfer).Error; err != nil {
+				return err
+			}
+		} else {
+			// Further transfers are added to the ledger of the order
+			transfer.UserID = transactions[0].UserID
+			transfer.OrderID = transactions[0].OrderID
+			transfer.Code = transactions[0].Code
+			transfer.Provider = transactions[0].Provider
+			if err := tx.Create(&transfer).Error; err != nil {
+				return err
+			}
+			transaction = transfer
+		}
+		// Update the amount paid for the order
+		return updatePaymentStatus(tx, transaction.OrderID)
+	})
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	// Return the transaction
+	return models.Transaction{
+		ID:              transaction.ID,
+		UserID:          transaction.UserID,
+		OrderID:         transaction.OrderID,
+		Gateway:         transaction.Gateway,
+		TransactionDate: transaction.TransactionDate,
+		AccountNumber:   transaction.AccountNumber,
+		Code:            transaction.Code,
+		Content:         transaction.Content,
+		TransferType:    transaction.TransferType,
+		TransferAmount:  transaction.TransferAmount,
+		Accumulated:     transaction.Accumulated,
+		ReferenceCode:   transaction.ReferenceCode,
+		Description:     transaction.Description,
+		Provider:        transaction.Provider,
+		CreatedAt:       transaction.CreatedAt,
+	}, nil
+}
 
-	// Check for errors in the update process
-	if result.Error != nil {
-		return models.Transaction{}, result.Error
+// updatePaymentStatus sums the transfers received and the refunds completed for an order
+// and sets its paid and refunded amounts and payment status. The order row is locked so
+// concurrent transfers and refunds add up correctly.
+func updatePaymentStatus(tx *gorm.DB, order_id uint) error {
+	// Lock the order
+	var order domain.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order_id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ErrEntityNotFound
+		}
+		return err
+	}
+	// Sum the transfers received
+	var received uint64
+	if err := tx.Model(&domain.Transaction{}).
+		Select("COALESCE(SUM(transfer_amount), 0)").
+		Where("order_id = ? AND reference_code <> ''", order_id).
+		Scan(&received).Error; err != nil {
+		return err
 	}
+	// Sum the refunds completed
+	var refunded uint64
+	if err := tx.Model(&domain.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("order_id = ? AND status = ?", order_id, models.RefundStatusCompleted).
+		Scan(&refunded).Error; err != nil {
+		return err
+	}
+	// Update the order
+	status := paymentStatus(received, refunded, order.FinalPrice)
+	return tx.Model(&order).Updates(map[string]interface{}{
+		"paid_amount":     received,
+		"refunded_amount": refunded,
+		"payment_status":  status,
+	}).Error
+}
 
-	// Check if any rows were affected (to handle case where no transaction with the given code exists)
-	if result.RowsAffected == 0 {
-		return models.Transaction{}, models.ErrEntityNotFound
+// paymentStatus returns the payment status of an order given the amounts received and
+// refunded. An order is refunded once everything received has been given back.
+func paymentStatus(received, refunded, final_price uint64) string {
+	switch {
+	case refunded > 0 && refunded >= received:
+		return models.PaymentStatusRefunded
+	case received == 0:
+		return models.PaymentStatusNotPaid
+	case received < final_price:
+		return models.PaymentStatusIncomplete
+	case received == final_price:
+		return models.PaymentStatusPaid
+	default:
+		return models.PaymentStatusOverpaid
 	}
+}
+
+func (r *paymentRepository) CheckReferenceCode(reference_code string) (bool, error) {
+	// Count the transactions already recorded with the reference code
+	var count int64
+	err := r.DB.Model(&domain.Transaction{}).
+		Where("reference_code = ?", reference_code).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *paymentRepository) SaveWebhookEvent(gateway, client_ip string, payload []byte) (uint, error) {
+	// Define the webhook event
+	event := domain.WebhookEvent{
+		Gateway:  gateway,
+		Payload:  string(payload),
+		ClientIP: client_ip,
+		Status:   models.WebhookEventReceived,
+	}
+	// Save the raw payload before anything else is done with it
+	if err := r.DB.Create(&event).Error; err != nil {
+		return 0, err
+	}
+	return event.ID, nil
+}
 
-	return transaction, nil
+func (r *paymentRepository) UpdateWebhookEvent(event_id uint, reference_code, status, message string) error {
+	// Update the outcome of the webhook event
+	return r.DB.Model(&domain.WebhookEvent{}).
+		Where("id = ?", event_id).
+		Updates(map[string]interface{}{
+			"reference_code": reference_code,
+			"status":         status,
+			"error":          message,
+		}).Error
 }
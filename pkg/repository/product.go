@@ -4,7 +4,9 @@ import (
 	"ahava/pkg/domain"
 	"ahava/pkg/utils/models"
 
+	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepository interface {
@@ -19,13 +21,18 @@ type ProductRepository interface {
 	ListCategoryProducts(category string) ([]models.Product, error)
 	ListFeaturedProducts() ([]models.Product, error)
 
-	SearchProducts(key string) ([]models.Product, error)
+	SearchProducts(key string, limit, offset int) (models.SearchProducts, error)
+	QueryProducts(query models.ProductQuery, limit, offset int) (models.CatalogProducts, error)
 
 	GetProductPrice(product_id uint) ([]models.Price, error)
+	GetProductPrices(product_ids []uint) (map[uint][]models.Price, error)
 
 	AddProductPrice(product_id uint, price models.Price) (models.Price, error)
 	UpdateProductPrice(product_id, price_id uint, price models.Price) (models.Price, error)
 	DeleteProductPrice(product_id, price_id uint) error
+
+	AdjustStock(movement models.StockMovement) (models.Price, error)
+	ListStockMovements(product_id uint, limit, offset int) (models.ListStockMovements, error)
 }
 
 type productRepository struct {
@@ -38,13 +45,18 @@ func NewProductRepository(DB *gorm.DB) ProductRepository {
 
 func (r *productRepository) AddProduct(p models.Product) (models.Product, error) {
 
+	category, err := productCategory(r.DB, p)
+	if err != nil {
+		return models.Product{}, err
+	}
+
 	product := domain.Product{
 		Name:             p.Name,
 		Code:             p.Code,
-		Category:         p.Category,
+		CategoryID:       &category.ID,
+		Category:         category.Name,
 		DefaultImage:     p.DefaultImage,
 		Images:           p.Images,
-		Stock:            p.Stock,
 		Type:             p.Type,
 		Tag:              p.Tag,
 		ShortDescription: p.ShortDescription,
@@ -61,10 +73,10 @@ func (r *productRepository) AddProduct(p models.Product) (models.Product, error)
 		ID:               product.ID,
 		Name:             product.Name,
 		Code:             product.Code,
+		CategoryID:       product.CategoryID,
 		Category:         product.Category,
 		DefaultImage:     product.DefaultImage,
 		Images:           product.Images,
-		Stock:            product.Stock,
 		Type:             product.Type,
 		Tag:              product.Tag,
 		ShortDescription: product.ShortDescription,
@@ -103,10 +115,10 @@ func (r *productRepository) GetProductDetails(product_id uint) (models.Product,
 		ID:               product.ID,
 		Name:             product.Name,
 		Code:             product.Code,
+		CategoryID:       product.CategoryID,
 		Category:         product.Category,
 		DefaultImage:     product.DefaultImage,
 		Images:           product.Images,
-		Stock:            product.Stock,
 		Type:             product.Type,
 		Tag:              product.Tag,
 		ShortDescription: product.ShortDescription,
@@ -122,7 +134,7 @@ func (r *productRepository) ListAllProducts(limit, offset int) (models.ListProdu
 	var products []models.Product
 	var total int64
 	// Define the query
-	query := r.DB.Model(&domain.Product{}).Select("id, name, code, category, default_image, images, type, tag, is_featured")
+	query := r.DB.Model(&domain.Product{}).Select("id, name, code, category_id, category, default_image, images, type, tag, is_featured")
 	if err := query.Count(&total).Error; err != nil {
 		return models.ListProducts{}, err
 	}
@@ -134,10 +146,10 @@ func (r *productRepository) ListAllProducts(limit, offset int) (models.ListProdu
 			ID:           productDetail.ID,
 			Name:         productDetail.Name,
 			Code:         productDetail.Code,
+			CategoryID:   productDetail.CategoryID,
 			Category:     productDetail.Category,
 			DefaultImage: productDetail.DefaultImage,
 			Images:       productDetail.Images,
-			Stock:        productDetail.Stock,
 			Type:         productDetail.Type,
 			Tag:          productDetail.Tag,
 			IsFeatured:   *productDetail.IsFeatured,
@@ -155,9 +167,9 @@ func (r *productRepository) ListAllProducts(limit, offset int) (models.ListProdu
 func (r *productRepository) ListCategoryProducts(category string) ([]models.Product, error) {
 	// Define list of products and product details
 	var products []models.Product
-	// Query to get the products based on the category
-	err := r.DB.Model(&domain.Product{}).Select("id, name, code, category, default_image, images, type, tag, is_featured, short_description").
-		Where("category = ?", category).Find(&products).Error
+	// Query to get the products of the category and of the categories below it
+	err := r.DB.Model(&domain.Product{}).Select("id, name, code, category_id, category, default_image, images, type, tag, is_featured, short_description").
+		Where("category_id IN ("+categorySubtreeSQL+")", category, category).Find(&products).Error
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +181,7 @@ func (r *productRepository) ListFeaturedProducts() ([]models.Product, error) {
 	// Define list of products and product details
 	var products []models.Product
 	// Query to get the featured products
-	err := r.DB.Model(&domain.Product{}).Select("id, name, code, category, default_image, images, type, tag, is_featured, short_description").
+	err := r.DB.Model(&domain.Product{}).Select("id, name, code, category_id, category, default_image, images, type, tag, is_featured, short_description").
 		Where("is_featured = true").Find(&products).Error
 	if err != nil {
 		return nil, err
@@ -178,32 +190,235 @@ func (r *productRepository) ListFeaturedProducts() ([]models.Product, error) {
 	return products, nil
 }
 
-func (r *productRepository) SearchProducts(key string) ([]models.Product, error) {
-	// Define list of products and product details
-	var products []models.Product
-	// Query to search the products based on the key
-	err := r.DB.Model(&domain.Product{}).Select("id, name, code, category, default_image, images, type, tag, is_featured, short_description").
-		Where("name ILIKE ? OR category ILIKE ?", "%"+key+"%", "%"+key+"%").
-		Find(&products).Error
+func (r *productRepository) SearchProducts(key string, limit, offset int) (models.SearchProducts, error) {
+	// Match the visible products against the key, folded like the search vector
+	query := r.DB.Model(&domain.Product{}).
+		Joins("CROSS JOIN websearch_to_tsquery('ahava_search', ?) AS search_query", key).
+		Where("products.search_vector @@ search_query AND products.is_hidden IS NOT TRUE")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return models.SearchProducts{}, err
+	}
+	// Get the best matches first, with the matched words highlighted
+	products := []models.SearchResult{}
+	err := query.Select(`products.id, products.name, products.code, products.category_id, products.category,
+			products.default_image, products.images, products.type, products.tag,
+			products.is_featured, products.short_description,
+			ts_rank_cd(products.search_vector, search_query) AS rank,
+			ts_headline('ahava_search', products.name, search_query,
+				'HighlightAll=true, StartSel=<mark>, StopSel=</mark>') AS highlighted_name,
+			ts_headline('ahava_search', concat_ws(' ', products.short_description, products.description), search_query,
+				'StartSel=<mark>, StopSel=</mark>, MinWords=10, MaxWords=30, MaxFragments=2') AS snippet`).
+		Order("rank DESC, products.id DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&products).Error
 	if err != nil {
-		return nil, err
+		return models.SearchProducts{}, err
 	}
-	// Return the list of products
-	return products, nil
+	// Return the search results
+	return models.SearchProducts{
+		Key:      key,
+		Products: products,
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	}, nil
+}
+
+// priceBucketBounds split the catalog into the buckets of the price facet.
+var priceBucketBounds = []int64{100000, 300000, 500000, 1000000}
+
+// The facets of the catalog, each one is counted without its own filter so the
+// other values stay visible.
+const (
+	facetType  = "type"
+	facetTag   = "tag"
+	facetPrice = "price"
+)
+
+func (r *productRepository) QueryProducts(q models.ProductQuery, limit, offset int) (models.CatalogProducts, error) {
+	// Count the matching products
+	query := r.catalogQuery(q, "")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return models.CatalogProducts{}, err
+	}
+	// Sort them, the cheapest size sets the price of a product
+	var order string
+	switch q.Sort {
+	case models.ProductSortPriceAsc:
+		order = "product_prices.min_price ASC NULLS LAST, products.id DESC"
+	case models.ProductSortPriceDesc:
+		order = "product_prices.min_price DESC NULLS LAST, products.id DESC"
+	case models.ProductSortBestSelling:
+		query = query.Joins(`LEFT JOIN (SELECT order_items.product_id, SUM(order_items.quantity) AS sold
+			FROM order_items JOIN orders ON orders.id = order_items.order_id
+			WHERE order_items.deleted_at IS NULL AND orders.order_status NOT IN ?
+			GROUP BY order_items.product_id) AS sales ON sales.product_id = products.id`,
+			[]string{models.OrderStatusCanceled, models.OrderStatusReturned})
+		order = "COALESCE(sales.sold, 0) DESC, products.id DESC"
+	case models.ProductSortFeatured:
+		order = "products.is_featured DESC, products.created_at DESC, products.id DESC"
+	default:
+		order = "products.created_at DESC, products.id DESC"
+	}
+	// Get the page of products
+	products := []models.Product{}
+	if err := query.Select(`products.id, products.name, products.code, products.category_id, products.category,
+			products.default_image, products.images, products.type, products.tag,
+			products.is_featured, products.short_description`).
+		Order(order).
+		Offset(offset).
+		Limit(limit).
+		Scan(&products).Error; err != nil {
+		return models.CatalogProducts{}, err
+	}
+	facets, err := r.productFacets(q)
+	if err != nil {
+		return models.CatalogProducts{}, err
+	}
+	// Return the catalog
+	return models.CatalogProducts{
+		Products: products,
+		Facets:   facets,
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	}, nil
+}
+
+// catalogQuery returns the visible products matching the query, except for the filter
+// of the skipped facet. The sizes matching the size, stock and price filters are summed
+// up in product_prices.
+func (r *productRepository) catalogQuery(q models.ProductQuery, skip string) *gorm.DB {
+	sizes, args, filtered := catalogSizes(q, skip)
+	query := r.DB.Model(&domain.Product{}).
+		Joins("CROSS JOIN LATERAL (SELECT MIN("+offerPriceSQL+") AS min_price FROM prices pr WHERE "+sizes+") AS product_prices", args...).
+		Where("products.is_hidden IS NOT TRUE")
+	// A product matches if one of its sizes matches all the size filters
+	if filtered {
+		query = query.Where("product_prices.min_price IS NOT NULL")
+	}
+	if q.Category != "" {
+		query = query.Where("products.category_id IN ("+categorySubtreeSQL+")", q.Category, q.Category)
+	}
+	if skip != facetType && len(q.Types) > 0 {
+		query = query.Where("products.type IN ?", q.Types)
+	}
+	if skip != facetTag && len(q.Tags) > 0 {
+		query = query.Where("products.tag IN ?", q.Tags)
+	}
+	return query
+}
+
+// catalogSizes returns the condition on the prices table pr matching the sizes of the
+// product to the size, stock and price filters of the query, except for the filter of
+// the skipped facet, and whether any filter applies.
+func catalogSizes(q models.ProductQuery, skip string) (string, []interface{}, bool) {
+	sizes := "pr.product_id = products.id AND pr.deleted_at IS NULL"
+	var args []interface{}
+	filtered := false
+	if len(q.Sizes) > 0 {
+		sizes += " AND pr.size IN ?"
+		args = append(args, q.Sizes)
+		filtered = true
+	}
+	if q.InStock {
+		sizes += " AND pr.stock > 0"
+		filtered = true
+	}
+	if skip != facetPrice && q.MinPrice != nil {
+		sizes += " AND " + offerPriceSQL + " >= ?"
+		args = append(args, *q.MinPrice)
+		filtered = true
+	}
+	if skip != facetPrice && q.MaxPrice != nil {
+		sizes += " AND " + offerPriceSQL + " <= ?"
+		args = append(args, *q.MaxPrice)
+		filtered = true
+	}
+	return sizes, args, filtered
+}
+
+func (r *productRepository) productFacets(q models.ProductQuery) (models.ProductFacets, error) {
+	facets := models.ProductFacets{
+		Types:  []models.FacetCount{},
+		Tags:   []models.FacetCount{},
+		Prices: []models.PriceBucket{},
+	}
+	// Count the products of every type and tag
+	if err := r.catalogQuery(q, facetType).
+		Select("products.type AS value, COUNT(*) AS count").
+		Where("products.type <> ''").
+		Group("products.type").
+		Order("count DESC, value ASC").
+		Scan(&facets.Types).Error; err != nil {
+		return models.ProductFacets{}, err
+	}
+	if err := r.catalogQuery(q, facetTag).
+		Select("products.tag AS value, COUNT(*) AS count").
+		Where("products.tag <> ''").
+		Group("products.tag").
+		Order("count DESC, value ASC").
+		Scan(&facets.Tags).Error; err != nil {
+		return models.ProductFacets{}, err
+	}
+	// Count the products in every price bucket, bucket i being below priceBucketBounds[i].
+	// Like the price filter, a product is in every bucket one of its matching sizes is in.
+	var buckets []struct {
+		Bucket int
+		Count  int64
+	}
+	sizes, args, _ := catalogSizes(q, facetPrice)
+	if err := r.catalogQuery(q, facetPrice).
+		Joins("JOIN prices pr ON "+sizes, args...).
+		Select("width_bucket("+offerPriceSQL+", ?::bigint[]) AS bucket, COUNT(DISTINCT products.id) AS count", pq.Int64Array(priceBucketBounds)).
+		Group("bucket").
+		Scan(&buckets).Error; err != nil {
+		return models.ProductFacets{}, err
+	}
+	counts := make(map[int]int64, len(buckets))
+	for _, b := range buckets {
+		counts[b.Bucket] = b.Count
+	}
+	var lower uint64
+	for i := 0; i <= len(priceBucketBounds); i++ {
+		bucket := models.PriceBucket{Min: lower, Count: counts[i]}
+		if i < len(priceBucketBounds) {
+			upper := uint64(priceBucketBounds[i])
+			bucket.Max = &upper
+			lower = upper
+		}
+		facets.Prices = append(facets.Prices, bucket)
+	}
+	return facets, nil
 }
 
 func (r *productRepository) UpdateProduct(product_id uint, p models.Product) (models.Product, error) {
 	// Define the product
 	var product models.Product
+	// Move the product to the given category, if any
+	var category domain.Category
+	if p.CategoryID != nil || p.Category != "" {
+		var err error
+		if category, err = productCategory(r.DB, p); err != nil {
+			return models.Product{}, err
+		}
+	}
+	var category_id *uint
+	if category.ID != 0 {
+		category_id = &category.ID
+	}
 	// Update the product details
 	result := r.DB.Model(&domain.Product{}).Where("id = ?", product_id).
 		Updates(domain.Product{
 			Name:             p.Name,
 			Code:             p.Code,
-			Category:         p.Category,
+			CategoryID:       category_id,
+			Category:         category.Name,
 			DefaultImage:     p.DefaultImage,
 			Images:           p.Images,
-			Stock:            p.Stock,
 			Type:             p.Type,
 			Tag:              p.Tag,
 			Description:      p.Description,
@@ -253,8 +468,26 @@ func (r *productRepository) AddProductPrice(product_id uint, p models.Price) (mo
 		OriginalPrice: p.OriginalPrice,
 		DiscountPrice: p.DiscountPrice,
 	}
-	// Create the price
-	if err := r.DB.Create(&price).Error; err != nil {
+	// Create the price and record its initial stock
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&price).Error; err != nil {
+			return err
+		}
+		if p.Stock == 0 {
+			return nil
+		}
+		movement, err := moveStock(tx, domain.StockMovement{
+			PriceID: price.ID,
+			Change:  int(p.Stock),
+			Type:    models.StockMovementInitial,
+		})
+		if err != nil {
+			return err
+		}
+		price.Stock = movement.StockAfter
+		return nil
+	})
+	if err != nil {
 		return models.Price{}, err
 	}
 	// Return the price
@@ -264,6 +497,7 @@ func (r *productRepository) AddProductPrice(product_id uint, p models.Price) (mo
 		Image:         price.Image,
 		OriginalPrice: price.OriginalPrice,
 		DiscountPrice: price.DiscountPrice,
+		Stock:         price.Stock,
 	}, nil
 }
 
@@ -272,6 +506,7 @@ func (r *productRepository) GetProductPrice(product_id uint) ([]models.Price, er
 	var prices []models.Price
 	// Query to get the price details
 	err := r.DB.Model(&domain.Price{}).
+		Select("prices.id, prices.size, prices.image, prices.original_price, prices.stock, prices.discount_price AS base_discount_price, "+effectivePrice("prices")+" AS discount_price").
 		Where("product_id = ?", product_id).
 		Scan(&prices).Error
 	if err != nil {
@@ -281,6 +516,32 @@ func (r *productRepository) GetProductPrice(product_id uint) ([]models.Price, er
 	return prices, nil
 }
 
+func (r *productRepository) GetProductPrices(product_ids []uint) (map[uint][]models.Price, error) {
+	// Define the prices keyed by product
+	prices := make(map[uint][]models.Price, len(product_ids))
+	if len(product_ids) == 0 {
+		return prices, nil
+	}
+	// Query to get the price details of all the products at once
+	var rows []struct {
+		ProductID uint
+		models.Price
+	}
+	err := r.DB.Model(&domain.Price{}).
+		Select("prices.product_id, prices.id, prices.size, prices.image, prices.original_price, prices.stock, prices.discount_price AS base_discount_price, "+effectivePrice("prices")+" AS discount_price").
+		Where("product_id IN ?", product_ids).
+		Order("prices.product_id, prices.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		prices[row.ProductID] = append(prices[row.ProductID], row.Price)
+	}
+	// Return the price details
+	return prices, nil
+}
+
 func (r *productRepository) DeleteProductPrice(product_id, price_id uint) error {
 	// Query to delete the price
 	result := r.DB.Delete(&domain.Price{}, price_id)
@@ -293,3 +554,95 @@ func (r *productRepository) DeleteProductPrice(product_id, price_id uint) error
 	// Return the price
 	return nil
 }
+
+func (r *productRepository) AdjustStock(m models.StockMovement) (models.Price, error) {
+	// Define the price
+	var price models.Price
+	// Change the stock and record the movement in one transaction
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := moveStock(tx, domain.StockMovement{
+			PriceID:   m.PriceID,
+			ProductID: m.ProductID,
+			Change:    m.Change,
+			Type:      m.Type,
+			AdminID:   m.AdminID,
+			Note:      m.Note,
+		})
+		if err != nil {
+			return err
+		}
+		// Get the updated price
+		return tx.Model(&domain.Price{}).Where("id = ?", m.PriceID).First(&price).Error
+	})
+	if err != nil {
+		return models.Price{}, err
+	}
+	// Return the updated price
+	return price, nil
+}
+
+func (r *productRepository) ListStockMovements(product_id uint, limit, offset int) (models.ListStockMovements, error) {
+	// Define the list of stock movements
+	var movements []models.StockMovement
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.StockMovement{}).Where("product_id = ?", product_id)
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListStockMovements{}, err
+	}
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&movements).Error; err != nil {
+		return models.ListStockMovements{}, err
+	}
+	// Return the list of stock movements
+	return models.ListStockMovements{
+		Movements: movements,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}, nil
+}
+
+// moveStock locks the price row matching the movement, applies m.Change to its stock
+// and records the movement in the ledger. The price is matched by whichever of
+// m.PriceID, m.ProductID and m.Size are set.
+// It returns models.ErrOutOfStock if the stock would drop below zero.
+func moveStock(tx *gorm.DB, m domain.StockMovement) (domain.StockMovement, error) {
+	// Lock the price row
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	if m.PriceID != 0 {
+		query = query.Where("id = ?", m.PriceID)
+	}
+	if m.ProductID != 0 {
+		query = query.Where("product_id = ?", m.ProductID)
+	}
+	if m.Size != "" {
+		query = query.Where("size = ?", m.Size)
+	}
+	var price domain.Price
+	if err := query.First(&price).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return domain.StockMovement{}, models.ErrEntityNotFound
+		}
+		return domain.StockMovement{}, err
+	}
+	// Check the stock does not drop below zero
+	stock := int(price.Stock) + m.Change
+	if stock < 0 {
+		return domain.StockMovement{}, models.ErrOutOfStock
+	}
+	// Update the stock
+	if err := tx.Model(&domain.Price{}).
+		Where("id = ?", price.ID).
+		Update("stock", stock).Error; err != nil {
+		return domain.StockMovement{}, err
+	}
+	// Record the movement
+	m.PriceID = price.ID
+	m.ProductID = price.ProductID
+	m.Size = price.Size
+	m.StockAfter = uint(stock)
+	if err := tx.Create(&m).Error; err != nil {
+		return domain.StockMovement{}, err
+	}
+	return m, nil
+}
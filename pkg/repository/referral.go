@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReferralRepository interface {
+	FindUserByReferralCode(code string) (domain.User, error)
+	CheckReferralCode(code string) (bool, error)
+	GetReferralCode(user_id uint) (string, error)
+	HasUsedClientIP(user_id uint, client_ip string) (bool, error)
+	CreateReferral(referral models.Referral) error
+	ListReferrals(referrer_id uint, status string, limit, offset int) (models.ListReferrals, error)
+}
+
+type referralRepository struct {
+	DB *gorm.DB
+}
+
+func NewReferralRepository(DB *gorm.DB) ReferralRepository {
+	return &referralRepository{
+		DB: DB,
+	}
+}
+
+func (r *referralRepository) FindUserByReferralCode(code string) (domain.User, error) {
+	var user domain.User
+	err := r.DB.Where("referral_code = UPPER(?)", code).Order("id ASC").First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return domain.User{}, models.ErrEntityNotFound
+		}
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (r *referralRepository) CheckReferralCode(code string) (bool, error) {
+	// Count the users using the referral code
+	var count int64
+	err := r.DB.Model(&domain.User{}).
+		Where("referral_code = ?", code).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *referralRepository) GetReferralCode(user_id uint) (string, error) {
+	var user domain.User
+	err := r.DB.Select("referral_code").First(&user, user_id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", models.ErrEntityNotFound
+		}
+		return "", err
+	}
+	return user.ReferralCode, nil
+}
+
+func (r *referralRepository) HasUsedClientIP(user_id uint, client_ip string) (bool, error) {
+	// The login sessions keep the addresses the customer used
+	var count int64
+	err := r.DB.Model(&domain.RefreshToken{}).
+		Where("subject_id = ? AND role = ? AND client_ip = ?", user_id, models.RoleClient, client_ip).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *referralRepository) CreateReferral(referral models.Referral) error {
+	return r.DB.Create(&domain.Referral{
+		ReferrerID:   referral.ReferrerID,
+		RefereeID:    referral.RefereeID,
+		Status:       referral.Status,
+		RewardAmount: referral.RewardAmount,
+		Note:         referral.Note,
+	}).Error
+}
+
+func (r *referralRepository) ListReferrals(referrer_id uint, status string, limit, offset int) (models.ListReferrals, error) {
+	// Define the query, referrer_id 0 lists the referrals of every customer
+	query := r.DB.Model(&domain.Referral{})
+	if referrer_id != 0 {
+		query = query.Where("referrer_id = ?", referrer_id)
+	}
+	// Sum up the referrals before filtering by status
+	var stats models.ReferralStats
+	if err := query.Session(&gorm.Session{}).
+		Select(`COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE status = ?) AS pending,
+			COUNT(*) FILTER (WHERE status = ?) AS rewarded,
+			COUNT(*) FILTER (WHERE status = ?) AS rejected,
+			COALESCE(SUM(reward_amount) FILTER (WHERE status = ?), 0) AS total_reward`,
+			models.ReferralStatusPending, models.ReferralStatusRewarded,
+			models.ReferralStatusRejected, models.ReferralStatusRewarded).
+		Scan(&stats).Error; err != nil {
+		return models.ListReferrals{}, err
+	}
+	if status != "" {
+		query = query.Where("referrals.status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListReferrals{}, err
+	}
+	// Get the referrals with the names of both customers
+	referrals := []models.Referral{}
+	if err := query.
+		Select(`referrals.id, referrals.referrer_id, referrers.name AS referrer_name,
+			referrals.referee_id, referees.name AS referee_name, referrals.status,
+			referrals.reward_amount, referrals.order_id, referrals.note,
+			referrals.created_at, referrals.rewarded_at`).
+		Joins("JOIN users AS referrers ON referrers.id = referrals.referrer_id").
+		Joins("JOIN users AS referees ON referees.id = referrals.referee_id").
+		Order("referrals.id DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&referrals).Error; err != nil {
+		return models.ListReferrals{}, err
+	}
+	// Return the list of referrals
+	return models.ListReferrals{
+		Stats:     stats,
+		Referrals: referrals,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}, nil
+}
+
+// rewardReferral rewards the referrer of a customer whose order is delivered by crediting
+// their wallet. Only the pending referral is rewarded, so the referrer is rewarded for
+// the first delivered order only.
+func rewardReferral(tx *gorm.DB, user_id, order_id uint) error {
+	// Lock the pending referral of the customer
+	var referral domain.Referral
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("referee_id = ? AND status = ?", user_id, models.ReferralStatusPending).
+		Limit(1).
+		Find(&referral)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	// Mark it rewarded
+	if err := tx.Model(&referral).Updates(map[string]interface{}{
+		"status":      models.ReferralStatusRewarded,
+		"order_id":    order_id,
+		"rewarded_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	if referral.RewardAmount == 0 {
+		return nil
+	}
+	// Credit the reward to the referrer
+	_, err := moveWallet(tx, referral.ReferrerID, domain.WalletEntry{
+		Type:       models.WalletEntryReferral,
+		Amount:     int64(referral.RewardAmount),
+		ReferralID: &referral.ID,
+		Reason:     "Thưởng giới thiệu khách hàng",
+	})
+	return err
+}
+
+// revokeReferral takes back the reward earned by a returned order. The referral is
+// pending again, so a later order can earn it, and the reward is debited from the wallet
+// of the referrer as far as the balance covers it.
+func revokeReferral(tx *gorm.DB, order_id uint) error {
+	// Lock the referral rewarded for the order
+	var referral domain.Referral
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", order_id, models.ReferralStatusRewarded).
+		Limit(1).
+		Find(&referral)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	// Mark it pending again
+	if err := tx.Model(&referral).Updates(map[string]interface{}{
+		"status":      models.ReferralStatusPending,
+		"order_id":    nil,
+		"rewarded_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	if referral.RewardAmount == 0 {
+		return nil
+	}
+	// Debit the reward from the referrer
+	var wallet domain.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", referral.ReferrerID).
+		Limit(1).
+		Find(&wallet).Error; err != nil {
+		return err
+	}
+	amount := min(wallet.Balance, referral.RewardAmount)
+	if amount == 0 {
+		return nil
+	}
+	_, err := moveWallet(tx, referral.ReferrerID, domain.WalletEntry{
+		Type:       models.WalletEntryReferral,
+		Amount:     -int64(amount),
+		OrderID:    &order_id,
+		ReferralID: &referral.ID,
+		Reason:     fmt.Sprintf("Thu hồi thưởng giới thiệu, đơn hàng #%d bị hoàn trả", order_id),
+	})
+	return err
+}
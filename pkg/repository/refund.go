@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundRepository interface {
+	CreateRefunds(refunds []models.Refund, restock bool) ([]models.Refund, error)
+	UpdateRefundStatus(refund_id uint, from_status string, refund models.Refund) (models.Refund, error)
+	GetRefund(refund_id uint) (models.Refund, error)
+	ListRefunds(order_id uint, status string, limit, offset int) (models.ListRefunds, error)
+	GetTransaction(transaction_id uint) (models.Transaction, error)
+	GetRefundedQuantities(order_id uint) (map[uint]uint, error)
+	GetReservedAmounts(order_id uint) (map[uint]uint64, error)
+}
+
+type refundRepository struct {
+	DB *gorm.DB
+}
+
+func NewRefundRepository(DB *gorm.DB) RefundRepository {
+	return &refundRepository{
+		DB: DB,
+	}
+}
+
+func (r *refundRepository) CreateRefunds(refunds []models.Refund, restock bool) ([]models.Refund, error) {
+	// Define the created refunds
+	var created []models.Refund
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if len(refunds) == 0 {
+			return models.ErrBadRequest
+		}
+		order_id := refunds[0].OrderID
+		// Lock the order so refunds of the same order are checked one at a time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&domain.Order{}, order_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		// Check the items have not been refunded meanwhile
+		refunded, err := refundedQuantities(tx, order_id, false)
+		if err != nil {
+			return err
+		}
+		for _, refund := range refunds {
+			for _, item := range refund.Items {
+				var orderItem domain.OrderItem
+				if err := tx.Where("id = ? AND order_id = ?", item.OrderItemID, order_id).First(&orderItem).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return models.ErrEntityNotFound
+					}
+					return err
+				}
+				if refunded[item.OrderItemID]+item.Quantity > orderItem.Quantity {
+					return models.ErrConflict
+				}
+				refunded[item.OrderItemID] += item.Quantity
+			}
+		}
+		for _, request := range refunds {
+			// Check the payment still covers the refund
+			if err := checkRefundable(tx, request.TransactionID, order_id, request.Amount, 0); err != nil {
+				return err
+			}
+			// Create the refund
+			refund := domain.Refund{
+				OrderID:       request.OrderID,
+				TransactionID: request.TransactionID,
+				Provider:      request.Provider,
+				Amount:        request.Amount,
+				Reason:        request.Reason,
+				Status:        models.RefundStatusPending,
+				CreatedBy:     request.CreatedBy,
+			}
+			if err := tx.Create(&refund).Error; err != nil {
+				return err
+			}
+			// Create the refund items and put them back into stock
+			for _, i := range request.Items {
+				item := domain.RefundItem{
+					RefundID:    refund.ID,
+					OrderItemID: i.OrderItemID,
+					ProductID:   i.ProductID,
+					Size:        i.Size,
+					Quantity:    i.Quantity,
+					Amount:      i.Amount,
+				}
+				if restock {
+					_, err := moveStock(tx, domain.StockMovement{
+						ProductID: i.ProductID,
+						Size:      i.Size,
+						Change:    int(i.Quantity),
+						Type:      models.StockMovementReturn,
+						OrderID:   order_id,
+						AdminID:   request.CreatedBy,
+						Note:      request.Reason,
+					})
+					if err != nil && err != models.ErrEntityNotFound {
+						return err
+					}
+					item.Restocked = err == nil
+				}
+				if err := tx.Create(&item).Error; err != nil {
+					return err
+				}
+			}
+			result, err := getRefund(tx, refund.ID)
+			if err != nil {
+				return err
+			}
+			created = append(created, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Return the refunds
+	return created, nil
+}
+
+func (r *refundRepository) UpdateRefundStatus(refund_id uint, from_status string, u models.Refund) (models.Refund, error) {
+	// Define the refund
+	var result models.Refund
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the refund
+		var refund domain.Refund
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, refund_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		if refund.Status != from_status {
+			return models.ErrConflict
+		}
+		// A failed refund does not hold its amount, check the payment still covers it
+		if from_status == models.RefundStatusFailed && u.Status != models.RefundStatusFailed {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&domain.Order{}, refund.OrderID).Error; err != nil {
+				return err
+			}
+			if err := checkRefundable(tx, refund.TransactionID, refund.OrderID, refund.Amount, refund.ID); err != nil {
+				return err
+			}
+		}
+		// Update the refund
+		updates := map[string]interface{}{"status": u.Status}
+		if u.Reference != "" {
+			updates["reference"] = u.Reference
+		}
+		if u.Note != "" {
+			updates["note"] = u.Note
+		}
+		if u.Status == models.RefundStatusCompleted {
+			updates["completed_at"] = time.Now()
+		}
+		if err := tx.Model(&refund).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Refunds to the wallet are credited as they complete
+		if u.Status == models.RefundStatusCompleted && refund.Provider == models.PaymentMethodWallet {
+			var order domain.Order
+			if err := tx.Select("id", "user_id").First(&order, refund.OrderID).Error; err != nil {
+				return err
+			}
+			if _, err := moveWallet(tx, order.UserID, domain.WalletEntry{
+				Type:     models.WalletEntryRefund,
+				Amount:   int64(refund.Amount),
+				OrderID:  &order.ID,
+				RefundID: &refund.ID,
+				Reason:   refund.Reason,
+			}); err != nil {
+				return err
+			}
+		}
+		// Update the refunded amount of the order
+		if err := updatePaymentStatus(tx, refund.OrderID); err != nil {
+			return err
+		}
+		var err error
+		result, err = getRefund(tx, refund_id)
+		return err
+	})
+	if err != nil {
+		return models.Refund{}, err
+	}
+	// Return the updated refund
+	return result, nil
+}
+
+// checkRefundable checks that the transfer belongs to the order and that what is left
+// of it once the other refunds are taken off covers amount. Failed refunds and the
+// refund being retried, if any, are not taken off.
+func checkRefundable(tx *gorm.DB, transaction_id, order_id uint, amount uint64, refund_id uint) error {
+	var transaction domain.Transaction
+	err := tx.Where("id = ? AND order_id = ? AND reference_code <> ''", transaction_id, order_id).
+		First(&transaction).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.ErrEntityNotFound
+		}
+		return err
+	}
+	var reserved uint64
+	if err := tx.Model(&domain.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("transaction_id = ? AND status <> ? AND id <> ?", transaction_id, models.RefundStatusFailed, refund_id).
+		Scan(&reserved).Error; err != nil {
+		return err
+	}
+	if reserved+amount > transaction.TransferAmount {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+// refundedQuantities returns the quantity of each order item taken by the refunds of
+// the order, or only the quantity put back into stock when restocked is set.
+func refundedQuantities(tx *gorm.DB, order_id uint, restocked bool) (map[uint]uint, error) {
+	var rows []struct {
+		OrderItemID uint
+		Quantity    uint
+	}
+	query := tx.Model(&domain.RefundItem{}).
+		Select("refund_items.order_item_id, SUM(refund_items.quantity) AS quantity").
+		Joins("JOIN refunds ON refunds.id = refund_items.refund_id AND refunds.deleted_at IS NULL").
+		Where("refunds.order_id = ?", order_id)
+	if restocked {
+		query = query.Where("refund_items.restocked = true")
+	}
+	if err := query.Group("refund_items.order_item_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	quantities := make(map[uint]uint)
+	for _, row := range rows {
+		quantities[row.OrderItemID] = row.Quantity
+	}
+	return quantities, nil
+}
+
+// getRefund returns the refund with its items.
+func getRefund(tx *gorm.DB, refund_id uint) (models.Refund, error) {
+	// Query to get the refund
+	var refund models.Refund
+	err := tx.Model(&domain.Refund{}).
+		Where("id = ?", refund_id).
+		First(&refund).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Refund{}, models.ErrEntityNotFound
+		}
+		return models.Refund{}, err
+	}
+	// Query to get the items of the refund
+	if err := tx.Model(&domain.RefundItem{}).
+		Where("refund_id = ?", refund_id).
+		Order("id ASC").
+		Find(&refund.Items).Error; err != nil {
+		return models.Refund{}, err
+	}
+	return refund, nil
+}
+
+func (r *refundRepository) GetRefund(refund_id uint) (models.Refund, error) {
+	return getRefund(r.DB, refund_id)
+}
+
+func (r *refundRepository) ListRefunds(order_id uint, status string, limit, offset int) (models.ListRefunds, error) {
+	// Define the list of refunds
+	var refunds []models.Refund
+	var total int64
+	// Define the query
+	query := r.DB.Model(&domain.Refund{})
+	if order_id != 0 {
+		query = query.Where("order_id = ?", order_id)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return models.ListRefunds{}, err
+	}
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&refunds).Error; err != nil {
+		return models.ListRefunds{}, err
+	}
+	// Return the list of refunds
+	return models.ListRefunds{
+		Refunds: refunds,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+func (r *refundRepository) GetTransaction(transaction_id uint) (models.Transaction, error) {
+	// Define the transaction
+	var transaction models.Transaction
+	// Query to get the transaction
+	err := r.DB.Model(&domain.Transaction{}).
+		Where("id = ?", transaction_id).
+		First(&transaction).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Transaction{}, models.ErrEntityNotFound
+		}
+		return models.Transaction{}, err
+	}
+	// Return the transaction
+	return transaction, nil
+}
+
+func (r *refundRepository) GetRefundedQuantities(order_id uint) (map[uint]uint, error) {
+	return refundedQuantities(r.DB, order_id, false)
+}
+
+func (r *refundRepository) GetReservedAmounts(order_id uint) (map[uint]uint64, error) {
+	return reservedAmounts(r.DB, order_id)
+}
+
+// reservedAmounts sums the refunds of each transfer of the order that have not failed.
+func reservedAmounts(tx *gorm.DB, order_id uint) (map[uint]uint64, error) {
+	var rows []struct {
+		TransactionID uint
+		Amount        uint64
+	}
+	err := tx.Model(&domain.Refund{}).
+		Select("transaction_id, SUM(amount) AS amount").
+		Where("order_id = ? AND status <> ?", order_id, models.RefundStatusFailed).
+		Group("transaction_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	amounts := make(map[uint]uint64)
+	for _, row := range rows {
+		amounts[row.TransactionID] = row.Amount
+	}
+	return amounts, nil
+}
+
+// refundOrderPayments refunds what is left of the payments of the order. Payments made
+// with the wallet are credited back at once, the others get a pending refund for finance
+// to send. With wallet_only set, only the wallet payments are refunded.
+func refundOrderPayments(tx *gorm.DB, order_id uint, wallet_only bool, reason string, admin_id uint) error {
+	// Get the payments received
+	var payments []domain.Transaction
+	query := tx.Where("order_id = ? AND reference_code <> ''", order_id)
+	if wallet_only {
+		query = query.Where("provider = ?", models.PaymentMethodWallet)
+	}
+	if err := query.Order("id ASC").Find(&payments).Error; err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+	reserved, err := reservedAmounts(tx, order_id)
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		if payment.TransferAmount <= reserved[payment.ID] {
+			continue
+		}
+		// Refund what is left of the payment
+		refund := domain.Refund{
+			OrderID:       order_id,
+			TransactionID: payment.ID,
+			Provider:      payment.Provider,
+			Amount:        payment.TransferAmount - reserved[payment.ID],
+			Reason:        reason,
+			Status:        models.RefundStatusPending,
+			CreatedBy:     admin_id,
+		}
+		to_wallet := payment.Provider == models.PaymentMethodWallet
+		if to_wallet {
+			completed_at := time.Now()
+			refund.Status = models.RefundStatusCompleted
+			refund.CompletedAt = &completed_at
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		// Credit the wallet payments back
+		if to_wallet {
+			if _, err := moveWallet(tx, payment.UserID, domain.WalletEntry{
+				Type:     models.WalletEntryRefund,
+				Amount:   int64(refund.Amount),
+				OrderID:  &refund.OrderID,
+				RefundID: &refund.ID,
+				Reason:   reason,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	// Update the refunded amount of the order
+	return updatePaymentStatus(tx, order_id)
+}
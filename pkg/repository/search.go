@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SearchRepository interface {
+	AddSearchHistory(history models.SearchHistory) error
+	GetSearchHistory(user_id uint, limit int) ([]models.SearchHistory, error)
+	DeleteSearchHistory(user_id, history_id uint) error
+	ClearSearchHistory(user_id uint) error
+	ListTrendingSearches(since time.Time, limit int) ([]models.TrendingSearch, error)
+	SuggestProducts(query string, limit int) ([]models.ProductSuggestion, error)
+	SuggestCategories(query string, limit int) ([]models.CategorySuggestion, error)
+}
+
+type searchRepository struct {
+	DB *gorm.DB
+}
+
+func NewSearchRepository(DB *gorm.DB) SearchRepository {
+	return &searchRepository{
+		DB: DB,
+	}
+}
+
+func (r *searchRepository) AddSearchHistory(h models.SearchHistory) error {
+	history := domain.SearchHistory{
+		SearchKey:     h.SearchKey,
+		NormalizedKey: h.NormalizedKey,
+		ResultCount:   h.ResultCount,
+	}
+	if h.UserID != 0 {
+		history.UserID = &h.UserID
+	}
+	return r.DB.Create(&history).Error
+}
+
+func (r *searchRepository) GetSearchHistory(user_id uint, limit int) ([]models.SearchHistory, error) {
+	// Keep the latest search of every key
+	latest := r.DB.Model(&domain.SearchHistory{}).
+		Select("DISTINCT ON (normalized_key) id, user_id, search_key, result_count, created_at").
+		Where("user_id = ?", user_id).
+		Order("normalized_key, created_at DESC")
+	// Get the latest searches first
+	history := []models.SearchHistory{}
+	err := r.DB.Table("(?) AS history", latest).
+		Order("created_at DESC").
+		Limit(limit).
+		Scan(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (r *searchRepository) DeleteSearchHistory(user_id, history_id uint) error {
+	// Delete every search of the same key, the history only shows the latest one
+	result := r.DB.Where("user_id = ? AND normalized_key = (?)", user_id,
+		r.DB.Model(&domain.SearchHistory{}).
+			Select("normalized_key").
+			Where("id = ? AND user_id = ?", history_id, user_id)).
+		Delete(&domain.SearchHistory{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *searchRepository) ClearSearchHistory(user_id uint) error {
+	return r.DB.Where("user_id = ?", user_id).Delete(&domain.SearchHistory{}).Error
+}
+
+func (r *searchRepository) ListTrendingSearches(since time.Time, limit int) ([]models.TrendingSearch, error) {
+	// Cleared history still counts, and every customer counts once per key. Only the
+	// searches that found products are suggested.
+	searches := []models.TrendingSearch{}
+	err := r.DB.Unscoped().Model(&domain.SearchHistory{}).
+		Select(`MODE() WITHIN GROUP (ORDER BY search_key) AS search_key,
+			COUNT(DISTINCT COALESCE('U' || user_id::text, 'S' || id::text)) AS searches`).
+		Where("created_at >= ? AND result_count > 0", since).
+		Group("normalized_key").
+		Order("searches DESC, MAX(created_at) DESC").
+		Limit(limit).
+		Scan(&searches).Error
+	if err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (r *searchRepository) SuggestProducts(query string, limit int) ([]models.ProductSuggestion, error) {
+	// The query is a prefix query of the ahava_search configuration
+	products := []models.ProductSuggestion{}
+	err := r.DB.Model(&domain.Product{}).
+		Select("id, name, category, default_image, ts_rank(name_vector, to_tsquery('ahava_search', ?)) AS rank", query).
+		Where("name_vector @@ to_tsquery('ahava_search', ?) AND is_hidden IS NOT TRUE", query).
+		Order("rank DESC, name ASC").
+		Limit(limit).
+		Scan(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *searchRepository) SuggestCategories(query string, limit int) ([]models.CategorySuggestion, error) {
+	// Match the words of the visible category names and slugs, folded like the products
+	categories := []models.CategorySuggestion{}
+	err := r.DB.Model(&domain.Category{}).
+		Select("id, parent_id, name, slug").
+		Where("to_tsvector('ahava_search', name || ' ' || replace(slug, '-', ' ')) @@ to_tsquery('ahava_search', ?)", query).
+		Where("is_hidden = false").
+		Order("display_order ASC, name ASC, id ASC").
+		Limit(limit).
+		Scan(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenRepository interface {
+	CreateRefreshToken(subject models.TokenSubject, session_id, token_hash string, device models.DeviceInfo, expires_at time.Time) error
+	RotateRefreshToken(role, token_hash, next_hash string, device models.DeviceInfo, expires_at time.Time) (models.TokenSubject, string, error)
+	CheckSession(role string, subject_id uint, session_id string) (bool, error)
+	RevokeSession(role string, subject_id uint, session_id string) error
+	RevokeAllSessions(role string, subject_id uint) error
+}
+
+type tokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewTokenRepository(DB *gorm.DB) TokenRepository {
+	return &tokenRepository{
+		DB: DB,
+	}
+}
+
+func (r *tokenRepository) CreateRefreshToken(subject models.TokenSubject, session_id, token_hash string, device models.DeviceInfo, expires_at time.Time) error {
+	// Save the hash of the refresh token
+	return r.DB.Create(&domain.RefreshToken{
+		SubjectID:  subject.ID,
+		Role:       subject.Role,
+		SessionID:  session_id,
+		TokenHash:  token_hash,
+		DeviceInfo: device.UserAgent,
+		ClientIP:   device.ClientIP,
+		ExpiresAt:  expires_at,
+	}).Error
+}
+
+func (r *tokenRepository) RotateRefreshToken(role, token_hash, next_hash string, device models.DeviceInfo, expires_at time.Time) (models.TokenSubject, string, error) {
+	// Define the subject and the session of the token
+	var subject models.TokenSubject
+	var session_id string
+	reused := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the refresh token
+		var token domain.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND role = ?", token_hash, role).
+			First(&token).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrInvalidToken
+			}
+			return err
+		}
+		now := time.Now()
+		// A token used twice has been stolen, end the whole session
+		if token.UsedAt != nil || token.RevokedAt != nil {
+			reused = true
+			return revokeSessions(tx, "role = ? AND subject_id = ? AND session_id = ?", role, token.SubjectID, token.SessionID)
+		}
+		if !token.ExpiresAt.After(now) {
+			return models.ErrInvalidToken
+		}
+		// Check the subject can still log in
+		subject, err = getSubject(tx, role, token.SubjectID)
+		if err != nil {
+			return err
+		}
+		// Mark the token used and replace it in the same session
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		session_id = token.SessionID
+		return tx.Create(&domain.RefreshToken{
+			SubjectID:  token.SubjectID,
+			Role:       role,
+			SessionID:  token.SessionID,
+			TokenHash:  next_hash,
+			DeviceInfo: device.UserAgent,
+			ClientIP:   device.ClientIP,
+			ExpiresAt:  expires_at,
+		}).Error
+	})
+	if err != nil {
+		return models.TokenSubject{}, "", err
+	}
+	if reused {
+		return models.TokenSubject{}, "", models.ErrInvalidToken
+	}
+	// Return the subject and the session
+	return subject, session_id, nil
+}
+
+func (r *tokenRepository) CheckSession(role string, subject_id uint, session_id string) (bool, error) {
+	// A session is active while one of its tokens is neither revoked nor expired
+	var count int64
+	err := r.DB.Model(&domain.RefreshToken{}).
+		Where("role = ? AND subject_id = ? AND session_id = ?", role, subject_id, session_id).
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *tokenRepository) RevokeSession(role string, subject_id uint, session_id string) error {
+	return revokeSessions(r.DB, "role = ? AND subject_id = ? AND session_id = ?", role, subject_id, session_id)
+}
+
+func (r *tokenRepository) RevokeAllSessions(role string, subject_id uint) error {
+	return revokeSessions(r.DB, "role = ? AND subject_id = ?", role, subject_id)
+}
+
+// revokeSessions revokes the refresh tokens matching the conditions that are still valid.
+func revokeSessions(tx *gorm.DB, query string, args ...interface{}) error {
+	return tx.Model(&domain.RefreshToken{}).
+		Where(query, args...).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// getSubject returns the admin or the customer a token is issued to. Blocked customers
+// are forbidden.
+func getSubject(tx *gorm.DB, role string, subject_id uint) (models.TokenSubject, error) {
+	subject := models.TokenSubject{ID: subject_id, Role: role}
+	switch role {
+	case models.RoleAdmin:
+		var admin domain.Admin
+		if err := tx.First(&admin, subject_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.TokenSubject{}, models.ErrInvalidToken
+			}
+			return models.TokenSubject{}, err
+		}
+		subject.Email = admin.Email
+		subject.StaffRole = admin.Role
+		subject.MustChangePassword = admin.MustChangePassword
+	case models.RoleClient:
+		var user domain.User
+		if err := tx.First(&user, subject_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.TokenSubject{}, models.ErrInvalidToken
+			}
+			return models.TokenSubject{}, err
+		}
+		if user.IsBlocked {
+			return models.TokenSubject{}, models.ErrForbidden
+		}
+		subject.Email = user.Email
+	default:
+		return models.TokenSubject{}, models.ErrInvalidToken
+	}
+	return subject, nil
+}
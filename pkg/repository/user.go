@@ -3,6 +3,7 @@ package repository
 import (
 	"ahava/pkg/domain"
 	"ahava/pkg/utils/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -20,15 +21,12 @@ type UserRepository interface {
 	GetUserDetails(user_id uint) (models.UserDetailsResponse, error)
 	ChangePassword(user_id uint, password string) error
 	GetPassword(user_id uint) (string, error)
+	SetEmailVerified(user_id uint, email string) error
 	// FindIdFromPhone(phone string) (int, error)
 	EditProfile(user_id uint, profile models.EditProfile) (models.UserDetailsResponse, error)
 
 	// CheckIfFirstAddress(user_id uint) bool
 
-	// CreditReferencePointsToWallet(user_id uint) error
-	// FindUserFromReference(ref string) (int, error)
-
-	// GetReferralCodeFromID(id uint) (string, error)
 }
 
 type userDatabase struct {
@@ -95,9 +93,6 @@ func (r *userDatabase) FindUser(login models.UserLogin) (domain.User, error) {
 		}
 		return domain.User{}, err
 	}
-	if user.IsBlocked {
-		return domain.User{}, models.ErrForbidden
-	}
 
 	return user, nil
 }
@@ -237,6 +232,23 @@ func (r *userDatabase) GetPassword(id uint) (string, error) {
 	return userPassword, nil
 }
 
+func (r *userDatabase) SetEmailVerified(user_id uint, email string) error {
+	// Verify the email only if it is still the email of the user
+	result := r.DB.Model(&domain.User{}).
+		Where("id = ? AND email = ?", user_id, email).
+		Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrEntityNotFound
+	}
+	return nil
+}
+
 // func (ad *userDatabase) FindIdFromPhone(phone string) (uint, error) {
 
 // 	var id uint
@@ -273,35 +285,6 @@ func (r *userDatabase) EditProfile(userID uint, profile models.EditProfile) (mod
 	return user, nil
 }
 
-// func (ad *userDatabase) FindUserFromReference(ref string) (uint, error) {
-// 	var user int
-
-// 	if err := ad.DB.Raw("SELECT id FROM users WHERE referral_code = ?", ref).Find(&user).Error; err != nil {
-// 		return 0, err
-// 	}
-
-// 	return user, nil
-// }
-
-func (r *userDatabase) CreditReferencePointsToWallet(user_id uint) error {
-	err := r.DB.Exec("Update wallets set amount=amount+20 where user_id=$1", user_id).Error
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (r *userDatabase) GetReferralCodeFromID(id uint) (string, error) {
-	var referral string
-	err := r.DB.Raw("SELECT referral_code FROM users WHERE id=?", id).Scan(&referral).Error
-	if err != nil {
-		return "", err
-	}
-
-	return referral, nil
-}
-
 func (r *userDatabase) ListAllUsers(limit, offset int) (models.ListUsers, error) {
 	// Define the list of users
 	var listUsers models.ListUsers
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"ahava/pkg/domain"
+	"ahava/pkg/utils/models"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WalletRepository interface {
+	GetWallet(user_id uint, limit, offset int) (models.Wallet, error)
+	AdjustWallet(user_id, admin_id uint, adjustment models.WalletAdjustment) (models.WalletEntry, error)
+}
+
+type walletRepository struct {
+	DB *gorm.DB
+}
+
+func NewWalletRepository(DB *gorm.DB) WalletRepository {
+	return &walletRepository{
+		DB: DB,
+	}
+}
+
+func (r *walletRepository) GetWallet(user_id uint, limit, offset int) (models.Wallet, error) {
+	// Customers without a wallet have an empty one
+	var wallet domain.Wallet
+	if err := r.DB.Where("user_id = ?", user_id).Limit(1).Find(&wallet).Error; err != nil {
+		return models.Wallet{}, err
+	}
+	// Get the entries of the ledger, the latest first
+	var total int64
+	entries := []models.WalletEntry{}
+	if wallet.ID != 0 {
+		query := r.DB.Model(&domain.WalletEntry{}).Where("wallet_id = ?", wallet.ID)
+		if err := query.Count(&total).Error; err != nil {
+			return models.Wallet{}, err
+		}
+		if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&entries).Error; err != nil {
+			return models.Wallet{}, err
+		}
+	}
+	// Return the wallet
+	return models.Wallet{
+		UserID:  user_id,
+		Balance: wallet.Balance,
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+func (r *walletRepository) AdjustWallet(user_id, admin_id uint, adjustment models.WalletAdjustment) (models.WalletEntry, error) {
+	var entry domain.WalletEntry
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Check the customer exists
+		if err := tx.Select("id").First(&domain.User{}, user_id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.ErrEntityNotFound
+			}
+			return err
+		}
+		var err error
+		entry, err = moveWallet(tx, user_id, domain.WalletEntry{
+			Type:    models.WalletEntryAdjustment,
+			Amount:  adjustment.Amount,
+			AdminID: &admin_id,
+			Reason:  adjustment.Reason,
+		})
+		return err
+	})
+	if err != nil {
+		return models.WalletEntry{}, err
+	}
+	return walletEntry(entry), nil
+}
+
+// moveWallet locks the wallet of the customer, creating it if needed, applies e.Amount
+// to its balance and records the entry in the ledger.
+// It returns models.ErrInsufficientBalance if the balance would drop below zero.
+func moveWallet(tx *gorm.DB, user_id uint, e domain.WalletEntry) (domain.WalletEntry, error) {
+	// Create the wallet on its first use
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.Wallet{UserID: user_id}).Error; err != nil {
+		return domain.WalletEntry{}, err
+	}
+	// Lock the wallet
+	var wallet domain.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", user_id).
+		First(&wallet).Error; err != nil {
+		return domain.WalletEntry{}, err
+	}
+	// Check the balance does not drop below zero
+	balance := int64(wallet.Balance) + e.Amount
+	if balance < 0 {
+		return domain.WalletEntry{}, models.ErrInsufficientBalance
+	}
+	// Update the balance
+	if err := tx.Model(&domain.Wallet{}).
+		Where("id = ?", wallet.ID).
+		Update("balance", balance).Error; err != nil {
+		return domain.WalletEntry{}, err
+	}
+	// Record the entry
+	e.WalletID = wallet.ID
+	e.BalanceAfter = uint64(balance)
+	if err := tx.Create(&e).Error; err != nil {
+		return domain.WalletEntry{}, err
+	}
+	return e, nil
+}
+
+// payWithWallet takes up to amount of the order price from the wallet of the customer,
+// amount 0 taking as much as the balance covers, and records it as a payment of the
+// order. It returns the amount paid.
+func payWithWallet(tx *gorm.DB, order domain.Order, amount uint64) (uint64, error) {
+	if amount == 0 {
+		var wallet domain.Wallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", order.UserID).
+			Limit(1).
+			Find(&wallet).Error; err != nil {
+			return 0, err
+		}
+		amount = wallet.Balance
+	}
+	if amount > order.FinalPrice {
+		amount = order.FinalPrice
+	}
+	if amount == 0 {
+		return 0, nil
+	}
+	// Take the amount from the wallet
+	entry, err := moveWallet(tx, order.UserID, domain.WalletEntry{
+		Type:    models.WalletEntryOrderPayment,
+		Amount:  -int64(amount),
+		OrderID: &order.ID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Record it in the payments of the order, so refunds can give it back
+	code := fmt.Sprintf("WALLET%d", entry.ID)
+	if err := tx.Create(&domain.Transaction{
+		UserID:          order.UserID,
+		OrderID:         order.ID,
+		Provider:        models.PaymentMethodWallet,
+		Gateway:         models.PaymentMethodWallet,
+		TransactionDate: entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		Code:            code,
+		Amount:          amount,
+		TransferType:    "in",
+		TransferAmount:  amount,
+		ReferenceCode:   code,
+	}).Error; err != nil {
+		return 0, err
+	}
+	// Update the amount paid for the order
+	return amount, updatePaymentStatus(tx, order.ID)
+}
+
+func walletEntry(e domain.WalletEntry) models.WalletEntry {
+	return models.WalletEntry{
+		ID:           e.ID,
+		Type:         e.Type,
+		Amount:       e.Amount,
+		BalanceAfter: e.BalanceAfter,
+		OrderID:      e.OrderID,
+		RefundID:     e.RefundID,
+		ReferralID:   e.ReferralID,
+		AdminID:      e.AdminID,
+		Reason:       e.Reason,
+		CreatedAt:    e.CreatedAt,
+	}
+}
@@ -86,19 +86,21 @@ func (r *wishlistRepository) GetWishList(user_id uint, order_by string) ([]model
 
 	var wishlistProducts []models.WishlistProduct
 
+	discountPrice := effectivePrice("prices")
+
 	query := r.DB.Model(&domain.Product{}).
 		Select(`products.id AS product_id, products.name, products.default_image, wishlists.id,
-				COUNT(wishlists.product_id) AS total_count, prices.original_price, prices.discount_price, wishlists.created_at, prices.size`).
+				COUNT(wishlists.product_id) AS total_count, prices.original_price, `+discountPrice+` AS discount_price, wishlists.created_at, prices.size`).
 		Joins("JOIN wishlists ON wishlists.product_id = products.id").
 		Joins("JOIN prices ON prices.product_id = products.id AND prices.size = wishlists.size").
 		Where("wishlists.is_deleted = false AND wishlists.user_id = ?", user_id).
-		Group("wishlists.id, products.id, products.name, products.default_image, prices.discount_price, prices.original_price, prices.size")
+		Group("wishlists.id, products.id, products.name, products.default_image, prices.id, prices.discount_price, prices.original_price, prices.size")
 
 	switch order_by {
 	case "price_asc":
-		query = query.Order("prices.discount_price ASC")
+		query = query.Order("discount_price ASC")
 	case "price_desc":
-		query = query.Order("prices.discount_price DESC")
+		query = query.Order("discount_price DESC")
 	case "latest":
 		query = query.Order("products.created_at DESC")
 	case "most_favorite":
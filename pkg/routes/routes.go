@@ -3,48 +3,92 @@ package routes
 import (
 	"ahava/pkg/api/handler"
 	"ahava/pkg/api/middleware"
+	"ahava/pkg/utils/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AdminRoutes(
 	engine *gin.RouterGroup,
+	authMiddleware gin.HandlerFunc,
 	adminHandler handler.AdminHandler,
 	productHandler handler.ProductHandler,
 	userHandler handler.UserHandler,
-	// couponHandler handler.CouponHandler,
-	// offerHandler handler.OfferHandler,
 	uploadHandler handler.UploadHandler,
 	orderHandler handler.OrderHandler,
 	newsHandler handler.NewsHandler,
+	couponHandler handler.CouponHandler,
+	offerHandler handler.OfferHandler,
+	paymentHandler handler.PaymentHandler,
+	refundHandler handler.RefundHandler,
+	walletHandler handler.WalletHandler,
+	categoryHandler handler.CategoryHandler,
 ) {
 	engine.POST("/login", adminHandler.Login)
-	engine.Use(middleware.AdminAuthMiddleware)
+	engine.Use(authMiddleware)
+	{
+		engine.POST("/logout", adminHandler.Logout)
+		engine.PUT("/password", adminHandler.ChangePassword)
+	}
+	// Staff with a temporary password have to change it first
+	engine.Use(middleware.RequirePasswordChanged())
 	{
-		filemanagement := engine.Group("/file")
+		staffmanagement := engine.Group("/staff", middleware.RequirePermission(models.PermissionManageStaff))
+		{
+			staffmanagement.GET("", adminHandler.ListStaff)
+			staffmanagement.GET("/:admin_id", adminHandler.GetStaff)
+			staffmanagement.POST("", adminHandler.CreateStaff)
+			staffmanagement.PUT("/:admin_id", adminHandler.UpdateStaff)
+			staffmanagement.DELETE("/:admin_id", adminHandler.DeleteStaff)
+			staffmanagement.PUT("/:admin_id/password", adminHandler.ResetStaffPassword)
+		}
+		filemanagement := engine.Group("/file", middleware.RequirePermission(models.PermissionUploadFiles))
 		{
 			filemanagement.POST("/upload", uploadHandler.FileUpload)
 		}
-		usermanagement := engine.Group("/user")
+		usermanagement := engine.Group("/user", middleware.RequirePermission(models.PermissionManageUsers))
 		{
 			usermanagement.GET("", adminHandler.ListAllUsers)
-			usermanagement.PUT("/block/:id", adminHandler.BlockUser)
-			usermanagement.PUT("/unblock/:id", adminHandler.UnBlockUser)
+			usermanagement.PUT("/block/:user_id", adminHandler.BlockUser)
+			usermanagement.PUT("/unblock/:user_id", adminHandler.UnBlockUser)
+			usermanagement.GET("/lockout", adminHandler.ListLoginLockouts)
+			usermanagement.PUT("/unlock/:lockout_id", adminHandler.UnlockLogin)
+			usermanagement.GET("/referral", adminHandler.ListReferrals)
 		}
 
-		productmanagement := engine.Group("/product")
+		productmanagement := engine.Group("/product", middleware.RequirePermission(models.PermissionManageCatalog))
 		{
 			productmanagement.GET("", productHandler.ListAllProducts)
 			productmanagement.GET("/detail", productHandler.GetProductDetails)
 			productmanagement.POST("", productHandler.AddProduct)
 			productmanagement.DELETE("/:product_id", productHandler.DeleteProduct)
 			productmanagement.PUT("/:product_id", productHandler.UpdateProduct)
+			productmanagement.GET("/:product_id/stock", productHandler.ListStockMovements)
+			productmanagement.PUT("/:product_id/price/:price_id/stock", productHandler.AdjustStock)
+		}
+		categorymanagement := engine.Group("/category", middleware.RequirePermission(models.PermissionManageCatalog))
+		{
+			categorymanagement.GET("", categoryHandler.ListCategories)
+			categorymanagement.GET("/:category_id", categoryHandler.GetCategory)
+			categorymanagement.POST("", categoryHandler.AddCategory)
+			categorymanagement.PUT("/:category_id", categoryHandler.UpdateCategory)
+			categorymanagement.DELETE("/:category_id", categoryHandler.DeleteCategory)
 		}
 		ordermanagement := engine.Group("/order")
 		{
-			ordermanagement.GET("", orderHandler.ListAllOrders)
+			viewOrders := middleware.RequirePermission(models.PermissionViewOrders)
+			manageOrders := middleware.RequirePermission(models.PermissionManageOrders)
+			ordermanagement.GET("", viewOrders, orderHandler.ListAllOrders)
+			ordermanagement.GET("/:order_id", viewOrders, orderHandler.GetOrder)
+			ordermanagement.GET("/:order_id/payment", viewOrders, paymentHandler.QueryPaymentStatus)
+			ordermanagement.POST("/:order_id/refund", middleware.RequirePermission(models.PermissionManageFinance), refundHandler.CreateRefund)
+			ordermanagement.GET("/:order_id/status", viewOrders, orderHandler.GetOrderStatusHistory)
+			ordermanagement.PUT("/:order_id/status", manageOrders, orderHandler.UpdateOrderStatus)
+			ordermanagement.GET("/return", viewOrders, orderHandler.ListReturnRequests)
+			ordermanagement.PUT("/return/:return_id/approve", manageOrders, orderHandler.ApproveReturnRequest)
+			ordermanagement.PUT("/return/:return_id/reject", manageOrders, orderHandler.RejectReturnRequest)
 		}
-		newsmanagement := engine.Group("/news")
+		newsmanagement := engine.Group("/news", middleware.RequirePermission(models.PermissionManageContent))
 		{
 			newsmanagement.GET("", newsHandler.ListAllNews)
 			newsmanagement.GET("/:news_id", newsHandler.GetNewsByID)
@@ -52,72 +96,128 @@ func AdminRoutes(
 			newsmanagement.PUT("/:news_id", newsHandler.UpdateNews)
 			newsmanagement.DELETE("/:news_id", newsHandler.DeleteNews)
 		}
-		// payment := engine.Group("/payment-method")
-		// {
-		// 	payment.POST("", adminHandler.NewPaymentMethod)
-		// 	payment.GET("", adminHandler.ListPaymentMethods)
-		// 	payment.DELETE("", adminHandler.DeletePaymentMethod)
-		// }
-
-		// coupons := engine.Group("/coupons")
-		// {
-		// 	coupons.GET("", couponHandler.GetAllCoupons)
-		// 	coupons.POST("", couponHandler.CreateNewCoupon)
-		// 	coupons.DELETE("", couponHandler.MakeCouponInvalid)
-		// 	//reactivation of coupons
-		// 	coupons.PUT("", couponHandler.ReActivateCoupon)
-		// }
+		wallet := engine.Group("/wallet", middleware.RequirePermission(models.PermissionManageFinance))
+		{
+			wallet.GET("/:user_id", walletHandler.GetUserWallet)
+			wallet.POST("/:user_id/adjust", walletHandler.AdjustWallet)
+		}
+		refund := engine.Group("/refunds", middleware.RequirePermission(models.PermissionManageFinance))
+		{
+			refund.GET("", refundHandler.ListRefunds)
+			refund.GET("/:refund_id", refundHandler.GetRefund)
+			refund.PUT("/:refund_id/retry", refundHandler.RetryRefund)
+			refund.PUT("/:refund_id/complete", refundHandler.CompleteRefund)
+			refund.PUT("/:refund_id/fail", refundHandler.FailRefund)
+		}
+		payment := engine.Group("/payment-method", middleware.RequirePermission(models.PermissionManageFinance))
+		{
+			payment.POST("", adminHandler.NewPaymentMethod)
+			payment.GET("", adminHandler.ListPaymentMethods)
+			payment.PUT("/:method_id", adminHandler.UpdatePaymentMethod)
+			payment.DELETE("/:method_id", adminHandler.DeletePaymentMethod)
+		}
+
+		coupons := engine.Group("/coupons", middleware.RequirePermission(models.PermissionManageCatalog))
+		{
+			coupons.GET("", couponHandler.GetAllCoupons)
+			coupons.GET("/:coupon_id", couponHandler.GetCoupon)
+			coupons.POST("", couponHandler.CreateNewCoupon)
+			coupons.PUT("/:coupon_id", couponHandler.UpdateCoupon)
+			coupons.DELETE("/:coupon_id", couponHandler.MakeCouponInvalid)
+			//reactivation of coupons
+			coupons.PUT("/:coupon_id/reactivate", couponHandler.ReActivateCoupon)
+		}
+
+		offers := engine.Group("/offers", middleware.RequirePermission(models.PermissionManageCatalog))
+		{
+			offers.GET("", offerHandler.GetAllOffers)
+			offers.GET("/:offer_id", offerHandler.GetOffer)
+			offers.POST("", offerHandler.AddOffer)
+			offers.PUT("/:offer_id", offerHandler.UpdateOffer)
+			offers.DELETE("/:offer_id", offerHandler.DeleteOffer)
+		}
 	}
 }
 
 func UserRoutes(
 	engine *gin.RouterGroup,
+	authMiddleware gin.HandlerFunc,
+	optionalAuthMiddleware gin.HandlerFunc,
 	userHandler handler.UserHandler,
-	// otpHandler handler.OtpHandler,
+	otpHandler handler.OtpHandler,
+	verificationHandler handler.VerificationHandler,
 	productHandler handler.ProductHandler,
 	orderHandler handler.OrderHandler,
 	cartHandler handler.CartHandler,
 	paymentHandler handler.PaymentHandler,
 	wishlisthandler handler.WishlistHandler,
 	newsHandler handler.NewsHandler,
-	// couponHandler handler.CouponHandler
+	couponHandler handler.CouponHandler,
+	offerHandler handler.OfferHandler,
+	walletHandler handler.WalletHandler,
+	loyaltyHandler handler.LoyaltyHandler,
+	categoryHandler handler.CategoryHandler,
 ) {
 
 	engine.POST("/signup", userHandler.Register)
 	engine.POST("/login", userHandler.Login)
-	// engine.GET("/forgot-password", userHandler.ForgotPasswordSend)
-	// engine.POST("/forgot-password", userHandler.ForgotPasswordVerifyAndChange)
+	engine.POST("/token/refresh", userHandler.RefreshToken)
+	engine.POST("/forgot-password", userHandler.ForgotPasswordSend)
+	engine.PUT("/forgot-password", userHandler.ForgotPasswordVerifyAndChange)
 
-	// engine.POST("/otplogin", otpHandler.SendOTP)
-	// engine.POST("/verifyotp", otpHandler.VerifyOTP)
+	engine.POST("/otplogin", otpHandler.SendOTP)
+	engine.POST("/verifyotp", otpHandler.VerifyOTP)
+
+	engine.GET("/verify-email", verificationHandler.VerifyEmailLink)
 
 	payment := engine.Group("/payment")
 	{
 		payment.POST("/webhook", paymentHandler.Webhook)
+		payment.GET("/callback/:provider", paymentHandler.Callback)
+		payment.POST("/callback/:provider", paymentHandler.Callback)
+		payment.GET("/method", paymentHandler.ListPaymentMethods)
 	}
 
 	home := engine.Group("/home")
 	{
-		home.POST("/search", productHandler.SearchProducts)
-		// home.GET("/search", productHandler.GetSearchHistory)
+		// Searches of logged in customers are kept in their history
+		home.POST("/search", optionalAuthMiddleware, productHandler.SearchProducts)
+		home.GET("/search/trending", productHandler.ListTrendingSearches)
+		home.GET("/search/suggest", productHandler.SuggestSearch)
 	}
 
 	product := engine.Group("/product")
 	{
 		product.GET("/detail", productHandler.GetProductDetails)
 		product.GET("", productHandler.ListCategoryProducts)
+		product.GET("/query", productHandler.QueryProducts)
 		product.GET("/featured", productHandler.ListFeaturedProducts)
 	}
+	engine.GET("/category", categoryHandler.GetCategoryTree)
+	engine.GET("/offer", offerHandler.GetActiveOffers)
+
 	news := engine.Group("/news")
 	{
 		news.GET("", newsHandler.ListAllNews)
 		news.GET("/:news_id", newsHandler.GetNewsByID)
 	}
-	engine.Use(middleware.UserAuthMiddleware)
+	engine.Use(authMiddleware)
 	{
+		engine.POST("/logout", userHandler.Logout)
+		engine.POST("/logout/all", userHandler.LogoutAll)
+
+		search := engine.Group("/home/search")
+		{
+			search.GET("", productHandler.GetSearchHistory)
+			search.DELETE("", productHandler.ClearSearchHistory)
+			search.DELETE("/:history_id", productHandler.DeleteSearchHistory)
+		}
+
 		profile := engine.Group("/profile")
 		{
 			profile.GET("/detail", userHandler.GetUserDetails)
+			profile.POST("/verify-email", verificationHandler.VerifyEmail)
+			profile.POST("/verify-email/resend", verificationHandler.SendVerification)
 			address := profile.Group("/address")
 			{
 				address.GET("", userHandler.GetAddresses)
@@ -125,7 +225,10 @@ func UserRoutes(
 				address.PUT("/:address_id", userHandler.UpdateAddress)
 				address.DELETE("/:address_id", userHandler.DeleteAddress)
 			}
-			// profile.GET("/reference-link", userHandler.GetMyReferenceLink)
+			profile.GET("/referral", userHandler.GetReferralDashboard)
+			profile.GET("/wallet", walletHandler.GetWallet)
+			profile.GET("/loyalty", loyaltyHandler.GetLoyalty)
+			profile.POST("/loyalty/redeem", loyaltyHandler.RedeemPoints)
 			edit := profile.Group("/edit")
 			{
 				edit.PUT("", userHandler.EditProfile)
@@ -139,6 +242,7 @@ func UserRoutes(
 			cart.POST("", cartHandler.AddToCart)
 			cart.DELETE("/:cart_id", cartHandler.RemoveFromCart)
 			cart.PUT("/:cart_id", cartHandler.UpdateQuantity)
+			cart.POST("/checkout", cartHandler.CheckOut)
 		}
 		wishlist := engine.Group("/wishlist")
 		{
@@ -150,11 +254,15 @@ func UserRoutes(
 		{
 			order.GET("/detail", orderHandler.GetOrderDetails)
 			order.POST("", orderHandler.PlaceOrder)
+			order.POST("/:order_id/cancel", orderHandler.CancelOrder)
+			order.POST("/:order_id/return", orderHandler.RequestReturn)
+			order.GET("/:order_id/return", orderHandler.GetReturnRequests)
 		}
 		payment := engine.Group("/payment")
 		{
-			payment.POST("/qr", paymentHandler.CreateQR)
+			payment.POST("/intent", paymentHandler.CreatePaymentIntent)
+			payment.POST("/qr", paymentHandler.CreatePaymentIntent)
 		}
-		// engine.GET("/coupon", couponHandler.GetAllCoupons)
+		engine.GET("/coupon", couponHandler.GetAvailableCoupons)
 	}
 }
@@ -5,42 +5,77 @@ import (
 	helper "ahava/pkg/helper"
 	repository "ahava/pkg/repository"
 	"ahava/pkg/utils/models"
+	"strings"
 
 	"github.com/jinzhu/copier"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AdminService interface {
-	Login(models.AdminLogin) (domain.TokenAdmin, error)
+	Login(admin models.AdminLogin, device models.DeviceInfo) (domain.TokenAdmin, error)
+	RefreshTokens(refresh_token string, device models.DeviceInfo) (models.TokenPair, error)
+	Logout(admin_id uint, session_id string) error
+	ChangePassword(admin_id uint, model models.AdminChangePassword, device models.DeviceInfo) (models.TokenPair, error)
+	ListStaff(limit, offset int) (models.ListStaff, error)
+	GetStaff(admin_id uint) (models.AdminDetailsResponse, error)
+	CreateStaff(staff models.CreateStaff) (models.AdminDetailsResponse, error)
+	UpdateStaff(caller_id, admin_id uint, staff models.UpdateStaff) (models.AdminDetailsResponse, error)
+	DeleteStaff(caller_id, admin_id uint) error
+	ResetStaffPassword(admin_id uint, password string) error
+	ListLoginLockouts(role, scope string, limit, offset int) (models.ListLoginLockouts, error)
+	UnlockLogin(lockout_id uint) error
+	ListReferrals(status string, limit, offset int) (models.ListReferrals, error)
 	BlockUser(user_id uint) error
 	UnBlockUser(user_id uint) error
 	ListAllUsers(limit, offset int) (models.ListUsers, error)
-	// NewPaymentMethod(string) error
-	// ListPaymentMethods() ([]domain.PaymentMethod, error)
-	// DeletePaymentMethod(id uint) error
+	NewPaymentMethod(method models.PaymentMethod) (models.PaymentMethod, error)
+	ListPaymentMethods() ([]models.PaymentMethod, error)
+	UpdatePaymentMethod(id uint, enable bool) (models.PaymentMethod, error)
+	DeletePaymentMethod(id uint) error
 }
 
 type adminService struct {
 	adminRepository repository.AdminRepository
 	helper          helper.Helper
+	tokenService    TokenService
+	loginAttempts   LoginAttemptService
+	referrals       ReferralService
 }
 
-func NewAdminService(repo repository.AdminRepository, h helper.Helper) AdminService {
+func NewAdminService(repo repository.AdminRepository, h helper.Helper, tokenService TokenService, loginAttempts LoginAttemptService, referrals ReferralService) AdminService {
 	return &adminService{
 		adminRepository: repo,
 		helper:          h,
+		tokenService:    tokenService,
+		loginAttempts:   loginAttempts,
+		referrals:       referrals,
 	}
 }
 
-func (ad *adminService) Login(adminDetails models.AdminLogin) (domain.TokenAdmin, error) {
+func (ad *adminService) Login(adminDetails models.AdminLogin, device models.DeviceInfo) (domain.TokenAdmin, error) {
+	// Refuse the login while the account or the address is locked
+	if err := ad.loginAttempts.CheckLogin(models.RoleAdmin, adminDetails.Email, device.ClientIP); err != nil {
+		return domain.TokenAdmin{}, err
+	}
 	// Get the admin details
 	adminCompareDetails, err := ad.adminRepository.Login(adminDetails)
 	if err != nil {
 		return domain.TokenAdmin{}, err
 	}
-	// Compare password from database and that provided from admins
-	err = bcrypt.CompareHashAndPassword([]byte(adminCompareDetails.Password), []byte(adminDetails.Password))
-	if err != nil {
+	// Compare password from database and that provided from admins,
+	// unknown emails and wrong passwords get the same answer in the same time
+	found := adminCompareDetails.ID != 0
+	password_hash := []byte(adminCompareDetails.Password)
+	if !found {
+		password_hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(password_hash, []byte(adminDetails.Password)) != nil || !found {
+		if err := ad.loginAttempts.LoginFailed(models.RoleAdmin, adminDetails.Email, device.ClientIP); err != nil {
+			return domain.TokenAdmin{}, err
+		}
+		return domain.TokenAdmin{}, models.ErrInvalidLogin
+	}
+	if err := ad.loginAttempts.LoginSucceeded(models.RoleAdmin, adminDetails.Email); err != nil {
 		return domain.TokenAdmin{}, err
 	}
 	// Copy all details except password and sent it back to the front end
@@ -49,26 +84,161 @@ func (ad *adminService) Login(adminDetails models.AdminLogin) (domain.TokenAdmin
 	if err != nil {
 		return domain.TokenAdmin{}, err
 	}
-	// Generate token for the admin
-	access, refresh, err := ad.helper.GenerateTokenAdmin(adminDetailsResponse)
+	// Start a login session for the admin
+	tokens, err := ad.tokenService.IssueTokens(models.TokenSubject{
+		ID:                 adminDetailsResponse.ID,
+		Email:              adminDetailsResponse.Email,
+		Role:               models.RoleAdmin,
+		StaffRole:          adminDetailsResponse.Role,
+		MustChangePassword: adminDetailsResponse.MustChangePassword,
+	}, device)
 	if err != nil {
 		return domain.TokenAdmin{}, err
 	}
 	// Return the token
 	return domain.TokenAdmin{
 		Admin:        adminDetailsResponse,
-		AccessToken:  access,
-		RefreshToken: refresh,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
+func (ad *adminService) RefreshTokens(refresh_token string, device models.DeviceInfo) (models.TokenPair, error) {
+	return ad.tokenService.RefreshTokens(models.RoleAdmin, refresh_token, device)
+}
+
+func (ad *adminService) Logout(admin_id uint, session_id string) error {
+	return ad.tokenService.Logout(models.RoleAdmin, admin_id, session_id)
+}
+
+func (ad *adminService) ChangePassword(admin_id uint, model models.AdminChangePassword, device models.DeviceInfo) (models.TokenPair, error) {
+	// Check the old password
+	admin, err := ad.adminRepository.GetAdmin(admin_id)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(model.OldPassword)); err != nil {
+		return models.TokenPair{}, models.ErrInvalidPassword
+	}
+	if model.Password == model.OldPassword {
+		return models.TokenPair{}, models.ErrBadRequest
+	}
+	// Save the new password
+	password, err := ad.helper.PasswordHashing(model.Password)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := ad.adminRepository.UpdateAdminPassword(admin_id, password, false); err != nil {
+		return models.TokenPair{}, err
+	}
+	// End the other sessions and start a new one without the password change flag
+	if err := ad.tokenService.LogoutAll(models.RoleAdmin, admin_id); err != nil {
+		return models.TokenPair{}, err
+	}
+	return ad.tokenService.IssueTokens(models.TokenSubject{
+		ID:        admin.ID,
+		Email:     admin.Email,
+		Role:      models.RoleAdmin,
+		StaffRole: admin.Role,
+	}, device)
+}
+
+func (ad *adminService) ListStaff(limit, offset int) (models.ListStaff, error) {
+	return ad.adminRepository.ListAdmins(limit, offset)
+}
+
+func (ad *adminService) GetStaff(admin_id uint) (models.AdminDetailsResponse, error) {
+	admin, err := ad.adminRepository.GetAdmin(admin_id)
+	if err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	return models.AdminDetailsResponse{
+		ID:                 admin.ID,
+		Name:               admin.Name,
+		Email:              admin.Email,
+		Role:               admin.Role,
+		MustChangePassword: admin.MustChangePassword,
+	}, nil
+}
+
+func (ad *adminService) CreateStaff(staff models.CreateStaff) (models.AdminDetailsResponse, error) {
+	// Check if the email is already used
+	exists, err := ad.adminRepository.CheckIfAdminAlreadyExists(staff.Email)
+	if err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	if exists {
+		return models.AdminDetailsResponse{}, models.ErrAlreadyExists
+	}
+	// Hash the temporary password
+	staff.Password, err = ad.helper.PasswordHashing(staff.Password)
+	if err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	return ad.adminRepository.CreateAdmin(staff)
+}
+
+func (ad *adminService) UpdateStaff(caller_id, admin_id uint, staff models.UpdateStaff) (models.AdminDetailsResponse, error) {
+	// Staff cannot change their own role
+	if caller_id == admin_id && staff.Role != "" {
+		return models.AdminDetailsResponse{}, models.ErrForbidden
+	}
+	result, err := ad.adminRepository.UpdateAdmin(admin_id, staff)
+	if err != nil {
+		return models.AdminDetailsResponse{}, err
+	}
+	// The new role applies once the admin logs in again
+	if staff.Role != "" {
+		if err := ad.tokenService.LogoutAll(models.RoleAdmin, admin_id); err != nil {
+			return models.AdminDetailsResponse{}, err
+		}
+	}
+	return result, nil
+}
+
+func (ad *adminService) DeleteStaff(caller_id, admin_id uint) error {
+	// Staff cannot delete their own account
+	if caller_id == admin_id {
+		return models.ErrForbidden
+	}
+	if err := ad.adminRepository.DeleteAdmin(admin_id); err != nil {
+		return err
+	}
+	return ad.tokenService.LogoutAll(models.RoleAdmin, admin_id)
+}
+
+func (ad *adminService) ResetStaffPassword(admin_id uint, password string) error {
+	// The new password is temporary, it has to be changed on next login
+	hashed, err := ad.helper.PasswordHashing(password)
+	if err != nil {
+		return err
+	}
+	if err := ad.adminRepository.UpdateAdminPassword(admin_id, hashed, true); err != nil {
+		return err
+	}
+	return ad.tokenService.LogoutAll(models.RoleAdmin, admin_id)
+}
+
+func (ad *adminService) ListLoginLockouts(role, scope string, limit, offset int) (models.ListLoginLockouts, error) {
+	return ad.loginAttempts.ListLockouts(role, scope, limit, offset)
+}
+
+func (ad *adminService) UnlockLogin(lockout_id uint) error {
+	return ad.loginAttempts.Unlock(lockout_id)
+}
+
+func (ad *adminService) ListReferrals(status string, limit, offset int) (models.ListReferrals, error) {
+	return ad.referrals.ListReferrals(status, limit, offset)
+}
+
 func (ad *adminService) BlockUser(user_id uint) error {
 	// Block the user
 	err := ad.adminRepository.UpdateBlockUser(user_id, true)
 	if err != nil {
 		return err
 	}
-	return nil
+	// End the sessions of the user right away
+	return ad.tokenService.LogoutAll(models.RoleClient, user_id)
 }
 
 func (ad *adminService) UnBlockUser(user_id uint) error {
@@ -90,42 +260,28 @@ func (ad *adminService) ListAllUsers(limit, offset int) (models.ListUsers, error
 	return listUsers, nil
 }
 
-// func (ad *adminService) NewPaymentMethod(id string) error {
-
-// 	exists, err := ad.adminRepository.CheckIfPaymentMethodAlreadyExists(id)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	if exists {
-// 		return errors.New("payment method already exists")
-// 	}
-
-// 	err = ad.adminRepository.NewPaymentMethod(id)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	return nil
-
-// }
-
-// func (ad *adminService) ListPaymentMethods() ([]domain.PaymentMethod, error) {
-
-// 	categories, err := ad.adminRepository.ListPaymentMethods()
-// 	if err != nil {
-// 		return []domain.PaymentMethod{}, err
-// 	}
-// 	return categories, nil
-
-// }
+func (ad *adminService) NewPaymentMethod(method models.PaymentMethod) (models.PaymentMethod, error) {
+	// Check if the payment method already exists
+	exists, err := ad.adminRepository.CheckIfPaymentMethodAlreadyExists(method.PaymentName)
+	if err != nil {
+		return models.PaymentMethod{}, err
+	}
+	if exists {
+		return models.PaymentMethod{}, models.ErrAlreadyExists
+	}
+	// Payment method names are matched against the payment providers in upper case
+	method.PaymentName = strings.ToUpper(method.PaymentName)
+	return ad.adminRepository.NewPaymentMethod(method)
+}
 
-// func (ad *adminService) DeletePaymentMethod(id uint) error {
+func (ad *adminService) ListPaymentMethods() ([]models.PaymentMethod, error) {
+	return ad.adminRepository.ListPaymentMethods()
+}
 
-// 	err := ad.adminRepository.DeletePaymentMethod(id)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
+func (ad *adminService) UpdatePaymentMethod(id uint, enable bool) (models.PaymentMethod, error) {
+	return ad.adminRepository.UpdatePaymentMethod(id, enable)
+}
 
-// }
+func (ad *adminService) DeletePaymentMethod(id uint) error {
+	return ad.adminRepository.DeletePaymentMethod(id)
+}
@@ -12,21 +12,27 @@ type CartService interface {
 	UpdateQuantityLess(user_id, cart_id uint, quantity uint) (models.CartDetails, error)
 	UpdateQuantity(user_id, cart_id uint, quantity uint) (models.CartDetails, error)
 	RemoveFromCart(user_id, cart_id uint) error
-	CheckOut(user_id uint, cart_ids []uint) (models.CheckOut, error)
+	CheckOut(user_id uint, cart_ids []uint, coupon string) (models.CheckOut, error)
 }
 
 type cartService struct {
 	repo           repository.CartRepository
 	userRepository repository.UserRepository
+	couponService  CouponService
+	loyaltyService LoyaltyService
 }
 
 func NewCartService(
 	repo repository.CartRepository,
 	userRepository repository.UserRepository,
+	couponService CouponService,
+	loyaltyService LoyaltyService,
 ) CartService {
 	return &cartService{
 		repo:           repo,
 		userRepository: userRepository,
+		couponService:  couponService,
+		loyaltyService: loyaltyService,
 	}
 }
 
@@ -37,6 +43,25 @@ func (i *cartService) AddToCart(user_id uint, cart_item models.UpdateCartItem) (
 		return models.CartDetails{}, err
 	}
 
+	stock, err := i.repo.GetAvailableStock(cart_item.ProductID, cart_item.Size)
+	if err != nil {
+		return models.CartDetails{}, err
+	}
+
+	quantity := cart_item.Quantity
+	if cart_id != 0 {
+		cartItems, err := i.repo.GetCart(user_id, []uint{cart_id})
+		if err != nil {
+			return models.CartDetails{}, err
+		}
+		for _, v := range cartItems {
+			quantity += v.Quantity
+		}
+	}
+	if quantity > stock {
+		return models.CartDetails{}, models.ErrOutOfStock
+	}
+
 	if cart_id != 0 {
 		result, err := i.repo.UpdateQuantityAdd(user_id, cart_id, cart_item.Quantity)
 		if err != nil {
@@ -52,7 +77,16 @@ func (i *cartService) AddToCart(user_id uint, cart_item models.UpdateCartItem) (
 	}
 }
 
-func (i *cartService) CheckOut(user_id uint, cart_ids []uint) (models.CheckOut, error) {
+func (i *cartService) CheckOut(user_id uint, cart_ids []uint, coupon string) (models.CheckOut, error) {
+
+	// Only customers with a verified email can check out
+	user, err := i.userRepository.GetUserDetails(user_id)
+	if err != nil {
+		return models.CheckOut{}, err
+	}
+	if !user.EmailVerified {
+		return models.CheckOut{}, models.ErrEmailNotVerified
+	}
 
 	cartItems, err := i.repo.GetCart(user_id, cart_ids)
 	if err != nil {
@@ -62,6 +96,9 @@ func (i *cartService) CheckOut(user_id uint, cart_ids []uint) (models.CheckOut,
 	var discountedPrice, totalPrice uint64
 
 	for _, v := range cartItems {
+		if v.Quantity > v.Stock {
+			return models.CheckOut{}, models.ErrOutOfStock
+		}
 		totalPrice += v.ItemPrice
 		discountedPrice += v.ItemDiscountPrice
 	}
@@ -71,6 +108,27 @@ func (i *cartService) CheckOut(user_id uint, cart_ids []uint) (models.CheckOut,
 	checkout.CartItems = cartItems
 	checkout.TotalPrice = totalPrice
 	checkout.TotalDiscountedPrice = discountedPrice
+	checkout.FinalPrice = discountedPrice
+
+	if coupon != "" {
+		applied, discount, err := i.couponService.ApplyCoupon(user_id, coupon, discountedPrice)
+		if err != nil {
+			return models.CheckOut{}, err
+		}
+		checkout.CouponID = applied.ID
+		checkout.Coupon = applied.Coupon
+		checkout.CouponDiscount = discount
+		checkout.FinalPrice = discountedPrice - discount
+	}
+
+	// Members of a tier get its discount on top of the coupon
+	tier, err := i.loyaltyService.GetTier(user_id)
+	if err != nil {
+		return models.CheckOut{}, err
+	}
+	checkout.Tier = tier.Name
+	checkout.TierDiscount = checkout.FinalPrice * tier.DiscountPercent / 100
+	checkout.FinalPrice -= checkout.TierDiscount
 
 	return checkout, nil
 }
@@ -97,6 +155,21 @@ func (i *cartService) RemoveFromCart(user_id, cart_id uint) error {
 
 func (i *cartService) UpdateQuantityAdd(user_id, cart_id uint, quantity uint) (models.CartDetails, error) {
 
+	cartItems, err := i.repo.GetCart(user_id, []uint{cart_id})
+	if err != nil {
+		return models.CartDetails{}, err
+	}
+	if len(cartItems) == 0 {
+		return models.CartDetails{}, models.ErrEntityNotFound
+	}
+	stock, err := i.repo.GetAvailableStock(cartItems[0].ProductID, cartItems[0].Size)
+	if err != nil {
+		return models.CartDetails{}, err
+	}
+	if cartItems[0].Quantity+quantity > stock {
+		return models.CartDetails{}, models.ErrOutOfStock
+	}
+
 	result, err := i.repo.UpdateQuantityAdd(user_id, cart_id, quantity)
 	if err != nil {
 		return models.CartDetails{}, err
@@ -124,6 +197,17 @@ func (i *cartService) UpdateQuantityLess(user_id, cart_id uint, quantity uint) (
 
 func (i *cartService) UpdateQuantity(user_id, cart_id uint, quantity uint) (models.CartDetails, error) {
 
+	cartItems, err := i.repo.GetCart(user_id, []uint{cart_id})
+	if err != nil {
+		return models.CartDetails{}, err
+	}
+	if len(cartItems) == 0 {
+		return models.CartDetails{}, models.ErrEntityNotFound
+	}
+	if quantity > cartItems[0].Stock {
+		return models.CartDetails{}, models.ErrOutOfStock
+	}
+
 	result, err := i.repo.UpdateQuantity(user_id, cart_id, quantity)
 	if err != nil {
 		return models.CartDetails{}, err
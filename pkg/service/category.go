@@ -0,0 +1,151 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"strings"
+)
+
+// categorySlugTries is how many numbered slugs are tried before giving up on a unique one.
+const categorySlugTries = 20
+
+type CategoryService interface {
+	AddCategory(category models.Category) (models.Category, error)
+	UpdateCategory(category_id uint, category models.UpdateCategory) (models.Category, error)
+	DeleteCategory(category_id uint) error
+	GetCategory(category_id uint) (models.Category, error)
+	GetCategoryTree(include_hidden bool) ([]models.CategoryTree, error)
+}
+
+type categoryService struct {
+	repository repository.CategoryRepository
+}
+
+func NewCategoryService(repo repository.CategoryRepository) CategoryService {
+	return &categoryService{
+		repository: repo,
+	}
+}
+
+func (c *categoryService) AddCategory(category models.Category) (models.Category, error) {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return models.Category{}, models.ErrBadRequest
+	}
+	// Check the parent exists
+	if category.ParentID != nil {
+		if _, err := c.repository.GetCategory(*category.ParentID); err != nil {
+			return models.Category{}, err
+		}
+	}
+	slug, err := c.categorySlug(category.Slug, category.Name, 0)
+	if err != nil {
+		return models.Category{}, err
+	}
+	category.Slug = slug
+	return c.repository.AddCategory(category)
+}
+
+func (c *categoryService) UpdateCategory(category_id uint, category models.UpdateCategory) (models.Category, error) {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return models.Category{}, models.ErrBadRequest
+	}
+	// A category can not be moved below itself
+	if category.ParentID != nil {
+		if *category.ParentID == category_id {
+			return models.Category{}, models.ErrCategoryCycle
+		}
+		if _, err := c.repository.GetCategory(*category.ParentID); err != nil {
+			return models.Category{}, err
+		}
+		below, err := c.repository.IsCategoryBelow(*category.ParentID, category_id)
+		if err != nil {
+			return models.Category{}, err
+		}
+		if below {
+			return models.Category{}, models.ErrCategoryCycle
+		}
+	}
+	slug, err := c.categorySlug(category.Slug, category.Name, category_id)
+	if err != nil {
+		return models.Category{}, err
+	}
+	category.Slug = slug
+	return c.repository.UpdateCategory(category_id, category)
+}
+
+func (c *categoryService) DeleteCategory(category_id uint) error {
+	return c.repository.DeleteCategory(category_id)
+}
+
+func (c *categoryService) GetCategory(category_id uint) (models.Category, error) {
+	return c.repository.GetCategory(category_id)
+}
+
+func (c *categoryService) GetCategoryTree(include_hidden bool) ([]models.CategoryTree, error) {
+	categories, err := c.repository.ListCategories(include_hidden)
+	if err != nil {
+		return nil, err
+	}
+	return categoryTree(categories), nil
+}
+
+// categorySlug returns the slug of a category. A given slug must be free, one made from
+// the name is numbered until it is.
+func (c *categoryService) categorySlug(slug, name string, category_id uint) (string, error) {
+	if slug = models.Slugify(slug); slug != "" {
+		taken, err := c.repository.CheckCategorySlug(slug, category_id)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", models.ErrConflict
+		}
+		return slug, nil
+	}
+	slug = models.Slugify(name)
+	if slug == "" {
+		slug = "danh-muc"
+	}
+	candidate := slug
+	for i := 2; i <= categorySlugTries+1; i++ {
+		taken, err := c.repository.CheckCategorySlug(candidate, category_id)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+	return "", models.ErrConflict
+}
+
+// categoryTree nests the categories below their parent, keeping their order. The
+// categories whose parent is not in the list are left out with their subcategories.
+func categoryTree(categories []models.Category) []models.CategoryTree {
+	children := make(map[uint][]models.Category)
+	for _, category := range categories {
+		var parent_id uint
+		if category.ParentID != nil {
+			parent_id = *category.ParentID
+		}
+		children[parent_id] = append(children[parent_id], category)
+	}
+	var build func(parent_id uint) []models.CategoryTree
+	build = func(parent_id uint) []models.CategoryTree {
+		nodes := []models.CategoryTree{}
+		for _, category := range children[parent_id] {
+			node := models.CategoryTree{Category: category, Children: build(category.ID)}
+			// Count the products of the subcategories too
+			for _, child := range node.Children {
+				node.ProductCount += child.ProductCount
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(0)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"time"
+)
+
+type CouponService interface {
+	AddCoupon(coupon models.Coupon) (models.Coupon, error)
+	UpdateCoupon(coupon_id uint, coupon models.Coupon) (models.Coupon, error)
+	MakeCouponInvalid(coupon_id uint) error
+	ReActivateCoupon(coupon_id uint) error
+	GetCoupon(coupon_id uint) (models.Coupon, error)
+	ListAllCoupons(limit, offset int) (models.ListCoupons, error)
+	ListAvailableCoupons() ([]models.Coupon, error)
+	ApplyCoupon(user_id uint, code string, total uint64) (models.Coupon, uint64, error)
+}
+
+type couponService struct {
+	repository repository.CouponRepository
+}
+
+func NewCouponService(repo repository.CouponRepository) CouponService {
+	return &couponService{
+		repository: repo,
+	}
+}
+
+func (c *couponService) AddCoupon(coupon models.Coupon) (models.Coupon, error) {
+	// Check the coupon settings
+	if err := checkCoupon(coupon); err != nil {
+		return models.Coupon{}, err
+	}
+	// Check if the coupon code is already used
+	if _, err := c.repository.GetCouponByCode(coupon.Coupon); err == nil {
+		return models.Coupon{}, models.ErrAlreadyExists
+	} else if err != models.ErrEntityNotFound {
+		return models.Coupon{}, err
+	}
+	// Add the coupon
+	return c.repository.AddCoupon(coupon)
+}
+
+func (c *couponService) UpdateCoupon(coupon_id uint, coupon models.Coupon) (models.Coupon, error) {
+	// Check the coupon settings
+	if err := checkCoupon(coupon); err != nil {
+		return models.Coupon{}, err
+	}
+	// Check if the coupon code is used by another coupon
+	existing, err := c.repository.GetCouponByCode(coupon.Coupon)
+	if err == nil && existing.ID != coupon_id {
+		return models.Coupon{}, models.ErrAlreadyExists
+	} else if err != nil && err != models.ErrEntityNotFound {
+		return models.Coupon{}, err
+	}
+	// Update the coupon
+	return c.repository.UpdateCoupon(coupon_id, coupon)
+}
+
+func (c *couponService) MakeCouponInvalid(coupon_id uint) error {
+	return c.repository.UpdateCouponValidity(coupon_id, false)
+}
+
+func (c *couponService) ReActivateCoupon(coupon_id uint) error {
+	return c.repository.UpdateCouponValidity(coupon_id, true)
+}
+
+func (c *couponService) GetCoupon(coupon_id uint) (models.Coupon, error) {
+	return c.repository.GetCouponByID(coupon_id)
+}
+
+func (c *couponService) ListAllCoupons(limit, offset int) (models.ListCoupons, error) {
+	return c.repository.ListAllCoupons(limit, offset)
+}
+
+func (c *couponService) ListAvailableCoupons() ([]models.Coupon, error) {
+	return c.repository.ListAvailableCoupons()
+}
+
+func (c *couponService) ApplyCoupon(user_id uint, code string, total uint64) (models.Coupon, uint64, error) {
+	// Get the coupon
+	coupon, err := c.repository.GetCouponByCode(code)
+	if err != nil {
+		if err == models.ErrEntityNotFound {
+			return models.Coupon{}, 0, models.ErrInvalidCoupon
+		}
+		return models.Coupon{}, 0, err
+	}
+	// Check if the coupon can be used now, a zero expiry means no expiry
+	now := time.Now()
+	if !coupon.Valid || now.Before(coupon.StartAt) || (!coupon.ExpireAt.IsZero() && !now.Before(coupon.ExpireAt)) {
+		return models.Coupon{}, 0, models.ErrInvalidCoupon
+	}
+	// Check the minimum order value
+	if total < coupon.MinOrderValue {
+		return models.Coupon{}, 0, models.ErrInvalidCoupon
+	}
+	// Check the global and per-user usage limits
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return models.Coupon{}, 0, models.ErrInvalidCoupon
+	}
+	if coupon.UsageLimitPerUser > 0 {
+		count, err := c.repository.CountUserCouponUsage(coupon.ID, user_id)
+		if err != nil {
+			return models.Coupon{}, 0, err
+		}
+		if count >= int64(coupon.UsageLimitPerUser) {
+			return models.Coupon{}, 0, models.ErrInvalidCoupon
+		}
+	}
+	// Calculate the discount
+	var discount uint64
+	switch coupon.Type {
+	case models.CouponTypeFixed:
+		discount = coupon.DiscountAmount
+	default:
+		discount = total * uint64(coupon.DiscountRate) / 100
+		if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+			discount = coupon.MaxDiscount
+		}
+	}
+	if discount > total {
+		discount = total
+	}
+	// Return the coupon and the discount
+	return coupon, discount, nil
+}
+
+// checkCoupon validates the settings that depend on the coupon type.
+func checkCoupon(coupon models.Coupon) error {
+	if coupon.Type == models.CouponTypeFixed && coupon.DiscountAmount == 0 {
+		return models.ErrBadRequest
+	}
+	if coupon.Type == models.CouponTypePercentage && coupon.DiscountRate == 0 {
+		return models.ErrBadRequest
+	}
+	if !coupon.ExpireAt.IsZero() && !coupon.ExpireAt.After(coupon.StartAt) {
+		return models.ErrBadRequest
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginPolicy decides how long logins are refused after repeated failures.
+type loginPolicy struct {
+	// freeFailures is how many failures are allowed before logins are delayed.
+	freeFailures uint
+	// lockoutFailures is how many failures lock the logins for lockout.
+	lockoutFailures uint
+	// baseDelay is the first delay, it doubles with every further failure up to maxDelay.
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	lockout   time.Duration
+	// window is how long a failure is remembered after the last one.
+	window time.Duration
+}
+
+var (
+	accountLoginPolicy = loginPolicy{
+		freeFailures:    3,
+		lockoutFailures: 10,
+		baseDelay:       time.Second * 2,
+		maxDelay:        time.Minute * 5,
+		lockout:         time.Minute * 30,
+		window:          time.Hour,
+	}
+	// An address can be shared by many customers, so it gets more room.
+	ipLoginPolicy = loginPolicy{
+		freeFailures:    10,
+		lockoutFailures: 50,
+		baseDelay:       time.Second,
+		maxDelay:        time.Minute * 5,
+		lockout:         time.Hour,
+		window:          time.Hour,
+	}
+)
+
+// delay returns how long logins are refused after the given number of failures.
+func (p loginPolicy) delay(failures uint) time.Duration {
+	if failures >= p.lockoutFailures {
+		return p.lockout
+	}
+	if failures <= p.freeFailures {
+		return 0
+	}
+	shift := failures - p.freeFailures - 1
+	if shift >= 16 || p.baseDelay<<shift > p.maxDelay {
+		return p.maxDelay
+	}
+	return p.baseDelay << shift
+}
+
+// dummyPasswordHash is compared when the account does not exist, so the
+// response time does not tell whether it does.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("ahava-dummy-password"), 10)
+
+type LoginAttemptService interface {
+	CheckLogin(role, account, ip string) error
+	LoginFailed(role, account, ip string) error
+	LoginSucceeded(role, account string) error
+	ListLockouts(role, scope string, limit, offset int) (models.ListLoginLockouts, error)
+	Unlock(lockout_id uint) error
+}
+
+type loginAttemptService struct {
+	repository repository.LoginAttemptRepository
+}
+
+func NewLoginAttemptService(repo repository.LoginAttemptRepository) LoginAttemptService {
+	return &loginAttemptService{
+		repository: repo,
+	}
+}
+
+func (l *loginAttemptService) CheckLogin(role, account, ip string) error {
+	locked, err := l.repository.IsLoginLocked(role, loginAccount(account), ip, time.Now())
+	if err != nil {
+		return err
+	}
+	if locked {
+		return models.ErrTooManyRequests
+	}
+	return nil
+}
+
+func (l *loginAttemptService) LoginFailed(role, account, ip string) error {
+	// Count the failure for the account and for the address
+	if err := l.recordFailure(role, models.LoginScopeAccount, loginAccount(account), accountLoginPolicy); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return l.recordFailure(role, models.LoginScopeIP, ip, ipLoginPolicy)
+}
+
+func (l *loginAttemptService) LoginSucceeded(role, account string) error {
+	// The address keeps its failures, one good account must not hide guessing on others
+	return l.repository.ResetLoginFailures(role, models.LoginScopeAccount, loginAccount(account))
+}
+
+func (l *loginAttemptService) ListLockouts(role, scope string, limit, offset int) (models.ListLoginLockouts, error) {
+	if role != "" && role != models.RoleAdmin && role != models.RoleClient {
+		return models.ListLoginLockouts{}, models.ErrBadRequest
+	}
+	if scope != "" && scope != models.LoginScopeAccount && scope != models.LoginScopeIP {
+		return models.ListLoginLockouts{}, models.ErrBadRequest
+	}
+	return l.repository.ListLockouts(role, scope, time.Now(), limit, offset)
+}
+
+func (l *loginAttemptService) Unlock(lockout_id uint) error {
+	return l.repository.Unlock(lockout_id)
+}
+
+func (l *loginAttemptService) recordFailure(role, scope, identifier string, policy loginPolicy) error {
+	now := time.Now()
+	attempt, err := l.repository.RecordLoginFailure(role, scope, identifier, now, now.Add(-policy.window))
+	if err != nil {
+		return err
+	}
+	delay := policy.delay(attempt.Failures)
+	if delay == 0 {
+		return nil
+	}
+	return l.repository.LockLogin(attempt.ID, now.Add(delay))
+}
+
+// loginAccount returns the form an account is tracked under, so changing the
+// case of an email does not reset its failures.
+func loginAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"log"
+	"time"
+)
+
+// loyaltyTiers are the membership tiers, from the highest. A customer is in the first
+// tier whose spend they reach over the last 12 months.
+var loyaltyTiers = []models.LoyaltyTier{
+	{Name: models.LoyaltyTierPlatinum, MinSpend: 40000000, DiscountPercent: 8},
+	{Name: models.LoyaltyTierGold, MinSpend: 15000000, DiscountPercent: 5},
+	{Name: models.LoyaltyTierSilver, MinSpend: 5000000, DiscountPercent: 3},
+	{Name: models.LoyaltyTierMember, MinSpend: 0, DiscountPercent: 0},
+}
+
+// loyaltyExpiryNotice is how early the points about to expire are shown to the customer.
+const loyaltyExpiryNotice = 30 * 24 * time.Hour
+
+type LoyaltyService interface {
+	GetLoyalty(user_id uint, limit, offset int) (models.Loyalty, error)
+	GetTier(user_id uint) (models.LoyaltyTier, error)
+	RedeemPoints(user_id uint, points uint64) (models.LoyaltyEntry, error)
+	ExpirePoints() (int, error)
+}
+
+type loyaltyService struct {
+	repository repository.LoyaltyRepository
+}
+
+func NewLoyaltyService(repo repository.LoyaltyRepository) LoyaltyService {
+	return &loyaltyService{
+		repository: repo,
+	}
+}
+
+func (l *loyaltyService) GetLoyalty(user_id uint, limit, offset int) (models.Loyalty, error) {
+	spend, err := l.yearSpend(user_id)
+	if err != nil {
+		return models.Loyalty{}, err
+	}
+	points, err := l.repository.GetLoyaltyPoints(user_id, limit, offset)
+	if err != nil {
+		return models.Loyalty{}, err
+	}
+	expiring, err := l.repository.GetExpiringPoints(user_id, time.Now().Add(loyaltyExpiryNotice))
+	if err != nil {
+		return models.Loyalty{}, err
+	}
+	// Find the tier and the one above it
+	loyalty := models.Loyalty{
+		YearSpend:      spend,
+		PointsValue:    points.Points * models.LoyaltyPointValue,
+		ExpiringPoints: expiring,
+		LoyaltyPoints:  points,
+	}
+	for i, tier := range loyaltyTiers {
+		if spend >= tier.MinSpend {
+			loyalty.Tier = tier
+			if i > 0 {
+				loyalty.NextTier = &loyaltyTiers[i-1]
+			}
+			break
+		}
+	}
+	return loyalty, nil
+}
+
+func (l *loyaltyService) GetTier(user_id uint) (models.LoyaltyTier, error) {
+	spend, err := l.yearSpend(user_id)
+	if err != nil {
+		return models.LoyaltyTier{}, err
+	}
+	return loyaltyTier(spend), nil
+}
+
+func (l *loyaltyService) RedeemPoints(user_id uint, points uint64) (models.LoyaltyEntry, error) {
+	if points == 0 {
+		return models.LoyaltyEntry{}, models.ErrBadRequest
+	}
+	return l.repository.RedeemPoints(user_id, points, time.Now())
+}
+
+func (l *loyaltyService) ExpirePoints() (int, error) {
+	return l.repository.ExpirePoints(time.Now())
+}
+
+func (l *loyaltyService) yearSpend(user_id uint) (uint64, error) {
+	return l.repository.GetYearSpend(user_id, time.Now().AddDate(-1, 0, 0))
+}
+
+// loyaltyTier returns the tier reached by the spend.
+func loyaltyTier(spend uint64) models.LoyaltyTier {
+	for _, tier := range loyaltyTiers {
+		if spend >= tier.MinSpend {
+			return tier
+		}
+	}
+	return loyaltyTiers[len(loyaltyTiers)-1]
+}
+
+// ExpireLoyaltyPoints expires the points due every interval, it never returns.
+func ExpireLoyaltyPoints(l LoyaltyService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		count, err := l.ExpirePoints()
+		if err != nil {
+			log.Println("expire loyalty points:", err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("expired the loyalty points of %d customers", count)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier sends emails and text messages to customers.
+type Notifier interface {
+	Send(notification models.Notification) error
+}
+
+// channelNotifier sends each notification with the sender of its channel.
+type channelNotifier struct {
+	senders map[string]Notifier
+}
+
+// NewNotifier sends emails by SMTP and text messages by Twilio when they are configured.
+// Channels that are not configured are written to the log, or to NOTIFY_LOG_FILE, for
+// local development.
+func NewNotifier(cfg config.Config) Notifier {
+	fallback := &logNotifier{path: cfg.NOTIFY_LOG_FILE}
+	n := &channelNotifier{
+		senders: map[string]Notifier{
+			models.NotifyChannelEmail: fallback,
+			models.NotifyChannelSMS:   fallback,
+		},
+	}
+	if cfg.SMTP_HOST != "" {
+		n.senders[models.NotifyChannelEmail] = newSMTPNotifier(cfg)
+	}
+	if cfg.TWILIO_ACCOUNT_SID != "" {
+		n.senders[models.NotifyChannelSMS] = newTwilioNotifier(cfg)
+	}
+	return n
+}
+
+func (n *channelNotifier) Send(notification models.Notification) error {
+	sender, ok := n.senders[notification.Channel]
+	if !ok {
+		return models.ErrBadRequest
+	}
+	return sender.Send(notification)
+}
+
+// logNotifier writes notifications instead of sending them.
+type logNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (l *logNotifier) Send(notification models.Notification) error {
+	line := fmt.Sprintf("[%s] to %s: %s\n%s\n", notification.Channel, notification.To, notification.Subject, notification.Body)
+	if l.path == "" {
+		log.Print(line)
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s %s", time.Now().Format(time.RFC3339), line)
+	return err
+}
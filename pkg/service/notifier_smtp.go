@@ -0,0 +1,54 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	"ahava/pkg/utils/models"
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+)
+
+// smtpNotifier sends emails through an SMTP server with STARTTLS.
+type smtpNotifier struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+func newSMTPNotifier(cfg config.Config) *smtpNotifier {
+	port := cfg.SMTP_PORT
+	if port == "" {
+		port = "587"
+	}
+	from := cfg.SMTP_FROM
+	if from == "" {
+		from = cfg.SMTP_USERNAME
+	}
+	s := &smtpNotifier{
+		addr: net.JoinHostPort(cfg.SMTP_HOST, port),
+		host: cfg.SMTP_HOST,
+		from: from,
+	}
+	if cfg.SMTP_USERNAME != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD, cfg.SMTP_HOST)
+	}
+	return s
+}
+
+func (s *smtpNotifier) Send(notification models.Notification) error {
+	if notification.Channel != models.NotifyChannelEmail {
+		return models.ErrBadRequest
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.from)
+	fmt.Fprintf(&message, "To: %s\r\n", notification.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Subject))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(notification.Body)
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{notification.To}, message.Bytes())
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	"ahava/pkg/utils/models"
+
+	"github.com/twilio/twilio-go"
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// twilioNotifier sends text messages with the Twilio messaging API. Phone numbers are
+// expected in the +84 form.
+type twilioNotifier struct {
+	client *twilio.RestClient
+	from   string
+}
+
+func newTwilioNotifier(cfg config.Config) *twilioNotifier {
+	return &twilioNotifier{
+		client: twilio.NewRestClientWithParams(twilio.ClientParams{
+			Username: cfg.TWILIO_ACCOUNT_SID,
+			Password: cfg.TWILIO_AUTH_TOKEN,
+		}),
+		from: cfg.TWILIO_FROM_NUMBER,
+	}
+}
+
+func (t *twilioNotifier) Send(notification models.Notification) error {
+	if notification.Channel != models.NotifyChannelSMS {
+		return models.ErrBadRequest
+	}
+	params := &twilioApi.CreateMessageParams{}
+	params.SetTo(notification.To)
+	params.SetFrom(t.from)
+	params.SetBody(notification.Body)
+	_, err := t.client.Api.CreateMessage(params)
+	return err
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+)
+
+type OfferService interface {
+	AddOffer(offer models.Offer) (models.Offer, error)
+	UpdateOffer(offer_id uint, offer models.Offer) (models.Offer, error)
+	DeleteOffer(offer_id uint) error
+	GetOffer(offer_id uint) (models.Offer, error)
+	ListAllOffers(limit, offset int) (models.ListOffers, error)
+	ListActiveOffers() ([]models.Offer, error)
+}
+
+type offerService struct {
+	repository        repository.OfferRepository
+	productRepository repository.ProductRepository
+}
+
+func NewOfferService(
+	repo repository.OfferRepository,
+	productRepo repository.ProductRepository,
+) OfferService {
+	return &offerService{
+		repository:        repo,
+		productRepository: productRepo,
+	}
+}
+
+func (o *offerService) AddOffer(offer models.Offer) (models.Offer, error) {
+	// Check the offer target and window
+	offer, err := o.checkOffer(offer)
+	if err != nil {
+		return models.Offer{}, err
+	}
+	// Add the offer
+	return o.repository.AddOffer(offer)
+}
+
+func (o *offerService) UpdateOffer(offer_id uint, offer models.Offer) (models.Offer, error) {
+	// Check the offer target and window
+	offer, err := o.checkOffer(offer)
+	if err != nil {
+		return models.Offer{}, err
+	}
+	// Update the offer
+	return o.repository.UpdateOffer(offer_id, offer)
+}
+
+func (o *offerService) DeleteOffer(offer_id uint) error {
+	return o.repository.DeleteOffer(offer_id)
+}
+
+func (o *offerService) GetOffer(offer_id uint) (models.Offer, error) {
+	return o.repository.GetOffer(offer_id)
+}
+
+func (o *offerService) ListAllOffers(limit, offset int) (models.ListOffers, error) {
+	return o.repository.ListAllOffers(limit, offset)
+}
+
+func (o *offerService) ListActiveOffers() ([]models.Offer, error) {
+	return o.repository.ListActiveOffers()
+}
+
+// checkOffer validates the offer window and makes sure the offer targets an existing
+// product, size or category. A category given by slug or name is resolved to its id.
+// Fields not used by the scope are cleared.
+func (o *offerService) checkOffer(offer models.Offer) (models.Offer, error) {
+	if !offer.ExpireAt.After(offer.StartAt) {
+		return models.Offer{}, models.ErrBadRequest
+	}
+	switch offer.Scope {
+	case models.OfferScopeCategory:
+		if offer.CategoryID == nil && offer.Category == "" {
+			return models.Offer{}, models.ErrBadRequest
+		}
+		category, err := o.repository.GetOfferCategory(offer)
+		if err != nil {
+			return models.Offer{}, err
+		}
+		offer.CategoryID = &category.ID
+		offer.Category = category.Name
+		offer.ProductID = 0
+		offer.Size = ""
+	case models.OfferScopeProduct:
+		if _, err := o.productRepository.GetProductDetails(offer.ProductID); err != nil {
+			return models.Offer{}, err
+		}
+		offer.CategoryID = nil
+		offer.Category = ""
+		offer.Size = ""
+	case models.OfferScopeSize:
+		prices, err := o.productRepository.GetProductPrice(offer.ProductID)
+		if err != nil {
+			return models.Offer{}, err
+		}
+		found := false
+		for _, price := range prices {
+			if price.Size == offer.Size {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return models.Offer{}, models.ErrEntityNotFound
+		}
+		offer.CategoryID = nil
+		offer.Category = ""
+	}
+	return offer, nil
+}
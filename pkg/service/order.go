@@ -7,53 +7,115 @@ import (
 
 type OrderService interface {
 	PlaceOrder(order models.PlaceOrder) (models.Order, error)
-	GetOrderDetails(user_id, order_id uint) (models.Order, error)
+	GetOrderDetails(user_id, order_id uint) (models.OrderDetails, error)
+	GetOrder(order_id uint) (models.OrderDetails, error)
 	ListAllOrders(limit, offset int) (models.ListOrders, error)
 	UpdateOrder(order_id uint, updateOrder models.Order) (models.Order, error)
+	UpdateOrderStatus(order_id, admin_id uint, status models.UpdateOrderStatus) (models.Order, error)
+	GetOrderStatusHistory(order_id uint) ([]models.OrderStatusHistory, error)
+
+	CancelOrder(user_id, order_id uint) (models.Order, error)
+	RequestReturn(user_id, order_id uint, reason string) (models.ReturnRequest, error)
+	GetReturnRequests(user_id, order_id uint) ([]models.ReturnRequest, error)
+	ListReturnRequests(status string, limit, offset int) (models.ListReturnRequests, error)
+	ApproveReturnRequest(return_id, admin_id uint, note string) (models.ReturnRequest, error)
+	RejectReturnRequest(return_id, admin_id uint, note string) (models.ReturnRequest, error)
+}
+
+// orderStatusTransitions lists the statuses an order may move to from each status.
+// CANCELED and RETURNED are final.
+var orderStatusTransitions = map[string][]string{
+	models.OrderStatusUnconfirmed: {models.OrderStatusPreparing, models.OrderStatusCanceled},
+	models.OrderStatusPreparing:   {models.OrderStatusShipping, models.OrderStatusCanceled},
+	models.OrderStatusShipping:    {models.OrderStatusDelivered, models.OrderStatusReturned},
+	models.OrderStatusDelivered:   {models.OrderStatusReturned},
+}
+
+func canTransitionOrderStatus(from, to string) bool {
+	for _, status := range orderStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
 }
 
 type orderService struct {
-	repository  repository.OrderRepository
-	cartService CartService
+	repository     repository.OrderRepository
+	cartService    CartService
+	paymentService PaymentService
 }
 
-func NewOrderService(repo repository.OrderRepository, cartService CartService) OrderService {
+func NewOrderService(repo repository.OrderRepository, cartService CartService, paymentService PaymentService) OrderService {
 	return &orderService{
-		repository:  repo,
-		cartService: cartService,
+		repository:     repo,
+		cartService:    cartService,
+		paymentService: paymentService,
 	}
 }
 
 func (or *orderService) PlaceOrder(placeOrder models.PlaceOrder) (models.Order, error) {
 
-	checkout, err := or.cartService.CheckOut(placeOrder.UserID, placeOrder.CartIDs)
+	payment_method, err := or.paymentService.CheckPaymentMethod(placeOrder.PaymentMethod)
 	if err != nil {
 		return models.Order{}, err
 	}
+	placeOrder.PaymentMethod = payment_method
 
-	order, err := or.repository.PlaceOrder(placeOrder, checkout.TotalDiscountedPrice)
+	checkout, err := or.cartService.CheckOut(placeOrder.UserID, placeOrder.CartIDs, placeOrder.Coupon)
 	if err != nil {
 		return models.Order{}, err
 	}
 
-	for _, item := range checkout.CartItems {
-		err := or.repository.PlaceOrderItem(order.ID, item)
-		if err != nil {
-			return models.Order{}, err
-		}
+	if len(checkout.CartItems) == 0 {
+		return models.Order{}, models.ErrBadRequest
+	}
+	if len(placeOrder.CartIDs) > 0 && len(checkout.CartItems) != len(placeOrder.CartIDs) {
+		return models.Order{}, models.ErrEntityNotFound
+	}
+
+	order, err := or.repository.PlaceOrder(placeOrder, checkout)
+	if err != nil {
+		return models.Order{}, err
 	}
 
 	return order, nil
 }
 
-func (or *orderService) GetOrderDetails(user_id, order_id uint) (models.Order, error) {
+func (or *orderService) GetOrderDetails(user_id, order_id uint) (models.OrderDetails, error) {
+	// Get the order of the user
+	order, err := or.repository.GetOrderDetails(user_id, order_id)
+	if err != nil {
+		return models.OrderDetails{}, err
+	}
+	// Get the items and payments of the order
+	return or.getOrderDetails(order)
+}
 
-	result, err := or.repository.GetOrderDetails(user_id, order_id)
+func (or *orderService) GetOrder(order_id uint) (models.OrderDetails, error) {
+	// Get the order
+	order, err := or.repository.GetOrder(order_id)
 	if err != nil {
-		return models.Order{}, err
+		return models.OrderDetails{}, err
 	}
+	// Get the items and payments of the order
+	return or.getOrderDetails(order)
+}
 
-	return result, nil
+func (or *orderService) getOrderDetails(order models.Order) (models.OrderDetails, error) {
+	items, err := or.repository.GetOrderItems(order.ID)
+	if err != nil {
+		return models.OrderDetails{}, err
+	}
+	payments, err := or.repository.GetOrderPayments(order.ID)
+	if err != nil {
+		return models.OrderDetails{}, err
+	}
+	return models.OrderDetails{
+		Order:    order,
+		Details:  items,
+		Payments: payments,
+	}, nil
 }
 
 func (or *orderService) UpdateOrder(order_id uint, updateOrder models.Order) (models.Order, error) {
@@ -72,14 +134,181 @@ func (or *orderService) ListAllOrders(limit, offset int) (models.ListOrders, err
 	if err != nil {
 		return models.ListOrders{}, err
 	}
-	// Get all items of the order
+	// Get the items of all the orders at once
+	order_ids := make([]uint, 0, len(orders.Orders))
+	for _, order := range orders.Orders {
+		order_ids = append(order_ids, order.ID)
+	}
+	items, err := or.repository.GetOrdersItems(order_ids)
+	if err != nil {
+		return models.ListOrders{}, err
+	}
 	for idx, order := range orders.Orders {
-		items, err := or.repository.GetOrderItems(order.ID)
-		if err != nil {
-			return models.ListOrders{}, err
-		}
-		orders.Orders[idx].Details = items
+		orders.Orders[idx].Details = items[order.ID]
 	}
 	// Return the orders
 	return orders, nil
 }
+
+func (or *orderService) UpdateOrderStatus(order_id, admin_id uint, status models.UpdateOrderStatus) (models.Order, error) {
+	// Get the current order
+	order, err := or.repository.GetOrder(order_id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Check if the order can move to the requested status
+	if !canTransitionOrderStatus(order.OrderStatus, status.OrderStatus) {
+		return models.Order{}, models.ErrInvalidStatusTransition
+	}
+	// Update the status and record who changed it
+	result, err := or.repository.UpdateOrderStatus(order_id, models.OrderStatusHistory{
+		FromStatus:    order.OrderStatus,
+		ToStatus:      status.OrderStatus,
+		ChangedBy:     admin_id,
+		ChangedByRole: models.ChangedByAdmin,
+		Note:          status.Note,
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Return the updated order
+	return result, nil
+}
+
+func (or *orderService) GetOrderStatusHistory(order_id uint) ([]models.OrderStatusHistory, error) {
+	// Check if the order exists
+	if _, err := or.repository.GetOrder(order_id); err != nil {
+		return nil, err
+	}
+	// Get the status history of the order
+	history, err := or.repository.GetOrderStatusHistory(order_id)
+	if err != nil {
+		return nil, err
+	}
+	// Return the status history
+	return history, nil
+}
+
+// getUserOrder returns the order only if it belongs to the user.
+func (or *orderService) getUserOrder(user_id, order_id uint) (models.Order, error) {
+	order, err := or.repository.GetOrder(order_id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.UserID != user_id {
+		return models.Order{}, models.ErrEntityNotFound
+	}
+	return order, nil
+}
+
+func (or *orderService) CancelOrder(user_id, order_id uint) (models.Order, error) {
+	// Get the order of the user
+	order, err := or.getUserOrder(user_id, order_id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Customers can only cancel orders that have not been shipped
+	if order.OrderStatus != models.OrderStatusUnconfirmed && order.OrderStatus != models.OrderStatusPreparing {
+		return models.Order{}, models.ErrInvalidStatusTransition
+	}
+	// Cancel the order
+	result, err := or.repository.UpdateOrderStatus(order_id, models.OrderStatusHistory{
+		FromStatus:    order.OrderStatus,
+		ToStatus:      models.OrderStatusCanceled,
+		ChangedBy:     user_id,
+		ChangedByRole: models.ChangedByUser,
+		Note:          "Canceled by customer",
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Return the canceled order
+	return result, nil
+}
+
+func (or *orderService) RequestReturn(user_id, order_id uint, reason string) (models.ReturnRequest, error) {
+	// Create the return request, the repository checks the order under its lock
+	result, err := or.repository.CreateReturnRequest(user_id, order_id, reason)
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the return request
+	return result, nil
+}
+
+func (or *orderService) GetReturnRequests(user_id, order_id uint) ([]models.ReturnRequest, error) {
+	// Check if the order belongs to the user
+	if _, err := or.getUserOrder(user_id, order_id); err != nil {
+		return nil, err
+	}
+	// Get the return requests of the order
+	requests, err := or.repository.GetOrderReturnRequests(order_id)
+	if err != nil {
+		return nil, err
+	}
+	// Return the return requests
+	return requests, nil
+}
+
+func (or *orderService) ListReturnRequests(status string, limit, offset int) (models.ListReturnRequests, error) {
+	// Get all return requests with limit and offset
+	requests, err := or.repository.ListReturnRequests(status, limit, offset)
+	if err != nil {
+		return models.ListReturnRequests{}, err
+	}
+	// Return the return requests
+	return requests, nil
+}
+
+func (or *orderService) ApproveReturnRequest(return_id, admin_id uint, note string) (models.ReturnRequest, error) {
+	// Get the return request
+	request, err := or.repository.GetReturnRequest(return_id)
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	if request.Status != models.ReturnStatusPending {
+		return models.ReturnRequest{}, models.ErrConflict
+	}
+	// Check if the order can still be returned
+	order, err := or.repository.GetOrder(request.OrderID)
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	if !canTransitionOrderStatus(order.OrderStatus, models.OrderStatusReturned) {
+		return models.ReturnRequest{}, models.ErrInvalidStatusTransition
+	}
+	// Approve the request and mark the order as returned
+	result, err := or.repository.ApproveReturnRequest(return_id, models.ReturnRequest{
+		OrderID:    request.OrderID,
+		AdminNote:  note,
+		ReviewedBy: admin_id,
+	}, models.OrderStatusHistory{
+		FromStatus:    order.OrderStatus,
+		ToStatus:      models.OrderStatusReturned,
+		ChangedBy:     admin_id,
+		ChangedByRole: models.ChangedByAdmin,
+		Note:          "Return request approved",
+	})
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the approved request
+	return result, nil
+}
+
+func (or *orderService) RejectReturnRequest(return_id, admin_id uint, note string) (models.ReturnRequest, error) {
+	// Check if the return request exists
+	if _, err := or.repository.GetReturnRequest(return_id); err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Reject the return request
+	result, err := or.repository.RejectReturnRequest(return_id, models.ReturnRequest{
+		AdminNote:  note,
+		ReviewedBy: admin_id,
+	})
+	if err != nil {
+		return models.ReturnRequest{}, err
+	}
+	// Return the rejected request
+	return result, nil
+}
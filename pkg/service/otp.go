@@ -0,0 +1,165 @@
+package service
+
+import (
+	domain "ahava/pkg/domain"
+	helper "ahava/pkg/helper"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	// otpTTL is how long a code can be used.
+	otpTTL = time.Minute * 5
+	// otpMaxAttempts is how many wrong codes are accepted before the code is dropped.
+	otpMaxAttempts = 5
+	// otpResendInterval is how long to wait before asking for another code.
+	otpResendInterval = time.Minute
+	// otpMaxPerHour is how many codes can be sent for the same purpose in an hour.
+	otpMaxPerHour = 5
+)
+
+type OtpService interface {
+	SendOTP(purpose string, contact models.OtpContact) error
+	VerifyOTP(purpose string, contact models.OtpContact, code string) (domain.User, error)
+	LoginWithOTP(model models.VerifyOTP, device models.DeviceInfo) (models.TokenUsers, error)
+}
+
+type otpService struct {
+	repository   repository.OtpRepository
+	notifier     Notifier
+	helper       helper.Helper
+	tokenService TokenService
+}
+
+func NewOtpService(repo repository.OtpRepository, notifier Notifier, h helper.Helper, tokenService TokenService) OtpService {
+	return &otpService{
+		repository:   repo,
+		notifier:     notifier,
+		helper:       h,
+		tokenService: tokenService,
+	}
+}
+
+func (o *otpService) SendOTP(purpose string, contact models.OtpContact) error {
+	// Find the user of the phone or email
+	user, channel, target, err := o.findUser(contact)
+	if err != nil {
+		// Do not tell whether an account exists
+		if err == models.ErrEntityNotFound {
+			return nil
+		}
+		return err
+	}
+	if user.IsBlocked {
+		return nil
+	}
+	// Limit how often codes are sent
+	if err := checkOtpLimits(o.repository, user.ID, purpose); err != nil {
+		return err
+	}
+	// Save the code and send it
+	code, err := o.helper.GenerateOTP()
+	if err != nil {
+		return err
+	}
+	if err := o.repository.CreateOtp(user.ID, purpose, channel, target, o.helper.HashToken(code), time.Now().Add(otpTTL)); err != nil {
+		return err
+	}
+	return o.notifier.Send(models.Notification{
+		Channel: channel,
+		To:      target,
+		Subject: "Mã xác thực Ahava",
+		Body:    fmt.Sprintf("Mã xác thực Ahava của bạn là %s. Mã có hiệu lực trong %d phút, vui lòng không chia sẻ mã này với bất kỳ ai.", code, int(otpTTL.Minutes())),
+	})
+}
+
+func (o *otpService) VerifyOTP(purpose string, contact models.OtpContact, code string) (domain.User, error) {
+	// Find the user of the phone or email
+	user, _, _, err := o.findUser(contact)
+	if err != nil {
+		if err == models.ErrEntityNotFound {
+			return domain.User{}, models.ErrValidateOTP
+		}
+		return domain.User{}, err
+	}
+	if user.IsBlocked {
+		return domain.User{}, models.ErrForbidden
+	}
+	// Check the code
+	if err := o.repository.VerifyOtp(user.ID, purpose, o.helper.HashToken(code), otpMaxAttempts); err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (o *otpService) LoginWithOTP(model models.VerifyOTP, device models.DeviceInfo) (models.TokenUsers, error) {
+	// Check the login code
+	user, err := o.VerifyOTP(models.OtpPurposeLogin, model.OtpContact, model.Otp)
+	if err != nil {
+		return models.TokenUsers{}, err
+	}
+	// Start a login session for the user
+	tokens, err := o.tokenService.IssueTokens(models.TokenSubject{
+		ID:    user.ID,
+		Email: user.Email,
+		Role:  models.RoleClient,
+	}, device)
+	if err != nil {
+		return models.TokenUsers{}, err
+	}
+	return models.TokenUsers{
+		Users: models.UserDetailsResponse{
+			ID:            user.ID,
+			Username:      user.Username,
+			Name:          user.Name,
+			Email:         user.Email,
+			Phone:         user.Phone,
+			Gender:        user.Gender,
+			BirthDate:     user.BirthDate,
+			EmailVerified: user.EmailVerified,
+		},
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// findUser returns the user of the phone or the email with the channel and the address
+// to send codes to. Phones are matched in the +84, 84 and local 0 forms.
+func (o *otpService) findUser(contact models.OtpContact) (domain.User, string, string, error) {
+	if contact.Phone != "" {
+		phone, err := o.helper.NormalizePhone(contact.Phone)
+		if err != nil {
+			return domain.User{}, "", "", err
+		}
+		user, err := o.repository.FindUserByMobileNumber([]string{phone, "0" + phone[3:], phone[1:]})
+		return user, models.NotifyChannelSMS, phone, err
+	}
+	address, err := mail.ParseAddress(contact.Email)
+	if err != nil || address.Address != strings.TrimSpace(contact.Email) {
+		return domain.User{}, "", "", models.ErrBadRequest
+	}
+	user, err := o.repository.FindUserByEmail(address.Address)
+	return user, models.NotifyChannelEmail, user.Email, err
+}
+
+// checkOtpLimits returns models.ErrTooManyRequests when a code for the purpose was sent
+// to the user less than otpResendInterval ago or otpMaxPerHour times in the last hour.
+func checkOtpLimits(repo repository.OtpRepository, user_id uint, purpose string) error {
+	now := time.Now()
+	recent, err := repo.CountOtps(user_id, purpose, now.Add(-otpResendInterval))
+	if err != nil {
+		return err
+	}
+	hourly, err := repo.CountOtps(user_id, purpose, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if recent > 0 || hourly >= otpMaxPerHour {
+		return models.ErrTooManyRequests
+	}
+	return nil
+}
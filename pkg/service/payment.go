@@ -1,73 +1,163 @@
 package service
 
 import (
+	"ahava/pkg/config"
 	repository "ahava/pkg/repository"
 	"ahava/pkg/utils/models"
-	"fmt"
-	"math/rand"
+	"strings"
 )
 
 type PaymentService interface {
-	CreateSePayQR(user_id, order_id uint, amount uint64) (models.CreateQR, error)
-	Webhook(transaction models.Transaction) error
+	CreatePaymentIntent(user_id, order_id uint) (models.PaymentIntent, error)
+	HandleCallback(provider string, request models.WebhookRequest) error
+	QueryPaymentStatus(order_id uint) (models.PaymentStatus, error)
+	CheckPaymentMethod(payment_name string) (string, error)
+	ListPaymentMethods() ([]models.PaymentMethod, error)
+	Provider(payment_name string) (PaymentProvider, error)
 }
 
 type paymentUsecase struct {
 	repository      repository.PaymentRepository
 	orderRepository repository.OrderRepository
+	providers       map[string]PaymentProvider
 }
 
-func NewPaymentService(repo repository.PaymentRepository, orderRepository repository.OrderRepository) PaymentService {
-	return &paymentUsecase{
+func NewPaymentService(repo repository.PaymentRepository, orderRepository repository.OrderRepository, cfg config.Config) PaymentService {
+	// Register the payment providers, the gateway only when it is configured
+	providers := []PaymentProvider{
+		&sePayProvider{repository: repo, cfg: cfg},
+		&codProvider{},
+		&walletProvider{},
+	}
+	if cfg.PAYMENT_GATEWAY_URL != "" {
+		if cfg.PAYMENT_GATEWAY_NAME == "" {
+			cfg.PAYMENT_GATEWAY_NAME = "GATEWAY"
+		}
+		providers = append(providers, &gatewayProvider{repository: repo, cfg: cfg, client: newGatewayClient()})
+	}
+	p := &paymentUsecase{
 		repository:      repo,
 		orderRepository: orderRepository,
+		providers:       make(map[string]PaymentProvider),
 	}
+	for _, provider := range providers {
+		p.providers[provider.Name()] = provider
+	}
+	return p
 }
 
-func (p *paymentUsecase) CreateSePayQR(user_id, order_id uint, amount uint64) (models.CreateQR, error) {
-	// Generate a random description
-	description := fmt.Sprintf("AHV%07d", rand.Intn(10000000))
-	// Generate the QR code
-	result := fmt.Sprintf("https://qr.sepay.vn/img?acc=%s&bank=%s&amount=%d&des=%s&template=compact", "18896441", "ACB", amount, description)
-	// Save the QR code
-	qr := models.CreateQR{
-		OrderID:       order_id,
-		AccountNumber: "18896441",
-		BankName:      "ACB",
-		Amount:        amount,
-		Description:   description,
-		Link:          result,
-	}
-	err := p.repository.CreateQR(qr, user_id)
+func (p *paymentUsecase) CreatePaymentIntent(user_id, order_id uint) (models.PaymentIntent, error) {
+	// Get the order of the user
+	order, err := p.orderRepository.GetOrderDetails(user_id, order_id)
+	if err != nil {
+		return models.PaymentIntent{}, err
+	}
+	// Check if the order still has to be paid
+	if order.OrderStatus == models.OrderStatusCanceled || order.OrderStatus == models.OrderStatusReturned {
+		return models.PaymentIntent{}, models.ErrConflict
+	}
+	if order.PaidAmount >= order.FinalPrice {
+		return models.PaymentIntent{}, models.ErrConflict
+	}
+	// Get the provider of the payment method chosen for the order
+	provider, err := p.orderProvider(order)
 	if err != nil {
-		return models.CreateQR{}, err
+		return models.PaymentIntent{}, err
 	}
-	// Return the QR code
-	return qr, nil
+	// The amount is what is left to pay on the order
+	return provider.CreateIntent(order, order.FinalPrice-order.PaidAmount)
 }
 
-func (p *paymentUsecase) Webhook(transaction models.Transaction) error {
-	// Save the transaction
-	transaction, err := p.repository.SaveTransaction(transaction)
+func (p *paymentUsecase) HandleCallback(provider_name string, request models.WebhookRequest) error {
+	// Save the raw payload for auditing
+	event_id, err := p.repository.SaveWebhookEvent(provider_name, request.ClientIP, request.Payload)
 	if err != nil {
 		return err
 	}
-	// Get the order details
-	order, err := p.orderRepository.GetOrderForWebhook(transaction.OrderID)
+	// Handle the callback and record its outcome
+	var result models.CallbackResult
+	provider, err := p.Provider(provider_name)
 	if err != nil {
-		return err
+		result.Status = models.WebhookEventRejected
+	} else {
+		result, err = provider.HandleCallback(request)
+	}
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	if updateErr := p.repository.UpdateWebhookEvent(event_id, result.ReferenceCode, result.Status, message); updateErr != nil && err == nil {
+		return updateErr
+	}
+	return err
+}
+
+func (p *paymentUsecase) QueryPaymentStatus(order_id uint) (models.PaymentStatus, error) {
+	// Get the order
+	order, err := p.orderRepository.GetOrder(order_id)
+	if err != nil {
+		return models.PaymentStatus{}, err
+	}
+	// Ask the provider of the order
+	provider, err := p.orderProvider(order)
+	if err != nil {
+		return models.PaymentStatus{}, err
 	}
-	// Check if the order has been paid: if the final price is greater than or equal to the transfer amount
-	if order.FinalPrice >= transaction.TransferAmount {
-		_, err = p.orderRepository.UpdateOrder(transaction.OrderID, models.Order{PaymentStatus: "PAID"})
-		if err != nil {
-			return err
+	return provider.QueryStatus(order)
+}
+
+func (p *paymentUsecase) CheckPaymentMethod(payment_name string) (string, error) {
+	// The payment method must be enabled and have a provider
+	method, err := p.repository.GetPaymentMethod(payment_name)
+	if err != nil {
+		if err == models.ErrEntityNotFound {
+			return "", models.ErrBadRequest
 		}
-	} else {
-		_, err = p.orderRepository.UpdateOrder(transaction.OrderID, models.Order{PaymentStatus: "INCOMPLETE"})
-		if err != nil {
-			return err
+		return "", err
+	}
+	if !method.Enable {
+		return "", models.ErrBadRequest
+	}
+	provider, err := p.Provider(method.PaymentName)
+	if err != nil {
+		return "", err
+	}
+	// The wallet is used next to a payment method, not as one
+	if provider.Name() == models.PaymentMethodWallet {
+		return "", models.ErrBadRequest
+	}
+	return provider.Name(), nil
+}
+
+func (p *paymentUsecase) ListPaymentMethods() ([]models.PaymentMethod, error) {
+	// Get the enabled payment methods
+	methods, err := p.repository.ListEnabledPaymentMethods()
+	if err != nil {
+		return nil, err
+	}
+	// Only the methods with a provider can be used
+	available := []models.PaymentMethod{}
+	for _, method := range methods {
+		if _, ok := p.providers[strings.ToUpper(method.PaymentName)]; ok && !strings.EqualFold(method.PaymentName, models.PaymentMethodWallet) {
+			available = append(available, method)
 		}
 	}
-	return nil
+	return available, nil
+}
+
+func (p *paymentUsecase) Provider(payment_name string) (PaymentProvider, error) {
+	provider, ok := p.providers[strings.ToUpper(payment_name)]
+	if !ok {
+		return nil, models.ErrBadRequest
+	}
+	return provider, nil
+}
+
+// orderProvider returns the provider of the payment method of the order. Orders placed
+// before payment methods were recorded were paid by SePay transfer.
+func (p *paymentUsecase) orderProvider(order models.Order) (PaymentProvider, error) {
+	if order.PaymentMethod == "" {
+		return p.Provider(models.PaymentMethodSePay)
+	}
+	return p.Provider(order.PaymentMethod)
 }
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gatewayProvider is a redirect payment gateway in the style of VNPay or MoMo.
+//
+// Every request and callback carries its parameters as a query string signed with
+// signature = hex(HMAC-SHA256(secret, params)), where params are all the other
+// parameters URL encoded and sorted by key:
+//
+//	GET  {url}/pay     merchant, order_id, order_ref, amount, return_url, expire_at
+//	GET  {url}/query   merchant, order_id
+//	POST {url}/refund  merchant, transaction_no, amount
+//
+// The customer is redirected to /pay. The gateway then calls the callback, and
+// redirects the customer to return_url, with merchant, order_ref, amount,
+// transaction_no, response_code and pay_date, where response_code "00" means paid.
+// /query and /refund answer JSON with a response_code and the fields of
+// gatewayQueryResponse and gatewayRefundResponse.
+type gatewayProvider struct {
+	repository repository.PaymentRepository
+	cfg        config.Config
+	client     *http.Client
+}
+
+type gatewayQueryResponse struct {
+	ResponseCode string `json:"response_code"`
+	Status       string `json:"status"`
+	PaidAmount   uint64 `json:"paid_amount"`
+}
+
+type gatewayRefundResponse struct {
+	ResponseCode string `json:"response_code"`
+	RefundNo     string `json:"refund_no"`
+}
+
+// gatewaySuccess is the response code of a successful gateway operation.
+const gatewaySuccess = "00"
+
+func (g *gatewayProvider) Name() string {
+	return strings.ToUpper(g.cfg.PAYMENT_GATEWAY_NAME)
+}
+
+func (g *gatewayProvider) CreateIntent(order models.Order, amount uint64) (models.PaymentIntent, error) {
+	// Get or create the pending payment code
+	intent, err := pendingPayment(g.repository, g.Name(), order, amount)
+	if err != nil {
+		return models.PaymentIntent{}, err
+	}
+	// Build the signed redirect URL
+	params := url.Values{}
+	params.Set("merchant", g.cfg.PAYMENT_GATEWAY_MERCHANT)
+	params.Set("order_id", strconv.FormatUint(uint64(order.ID), 10))
+	params.Set("order_ref", intent.Description)
+	params.Set("amount", strconv.FormatUint(intent.Amount, 10))
+	params.Set("return_url", g.cfg.PAYMENT_GATEWAY_RETURN_URL)
+	params.Set("expire_at", strconv.FormatInt(intent.ExpireAt.Unix(), 10))
+	intent.Link = g.cfg.PAYMENT_GATEWAY_URL + "/pay?" + g.sign(params).Encode()
+	return intent, nil
+}
+
+func (g *gatewayProvider) HandleCallback(request models.WebhookRequest) (models.CallbackResult, error) {
+	// Parse the callback parameters
+	params, err := url.ParseQuery(string(request.Payload))
+	if err != nil {
+		return models.CallbackResult{Status: models.WebhookEventRejected}, models.ErrBadRequest
+	}
+	result := models.CallbackResult{ReferenceCode: params.Get("transaction_no"), Status: models.WebhookEventRejected}
+	// Check that the callback comes from the gateway
+	if !g.verify(params) || params.Get("merchant") != g.cfg.PAYMENT_GATEWAY_MERCHANT {
+		return result, models.ErrUnauthorized
+	}
+	amount, err := strconv.ParseUint(params.Get("amount"), 10, 64)
+	if err != nil || result.ReferenceCode == "" || params.Get("order_ref") == "" {
+		return result, models.ErrBadRequest
+	}
+	// Failed payments are only kept in the audit table
+	if params.Get("response_code") != gatewaySuccess {
+		result.Status = models.WebhookEventIgnored
+		return result, nil
+	}
+	// Record the payment
+	return recordTransfer(g.repository, models.Transaction{
+		Gateway:         g.Name(),
+		TransactionDate: params.Get("pay_date"),
+		AccountNumber:   params.Get("merchant"),
+		Code:            params.Get("order_ref"),
+		TransferType:    "in",
+		TransferAmount:  amount,
+		ReferenceCode:   result.ReferenceCode,
+	})
+}
+
+func (g *gatewayProvider) Refund(payment models.Transaction, amount uint64) (models.RefundResult, error) {
+	// Ask the gateway to refund the payment
+	params := url.Values{}
+	params.Set("merchant", g.cfg.PAYMENT_GATEWAY_MERCHANT)
+	params.Set("transaction_no", payment.ReferenceCode)
+	params.Set("amount", strconv.FormatUint(amount, 10))
+	var res gatewayRefundResponse
+	if err := g.call(http.MethodPost, "/refund", params, &res); err != nil {
+		return models.RefundResult{Status: models.RefundStatusFailed}, err
+	}
+	if res.ResponseCode != gatewaySuccess {
+		return models.RefundResult{Status: models.RefundStatusFailed}, fmt.Errorf("gateway refund rejected: %s", res.ResponseCode)
+	}
+	return models.RefundResult{Reference: res.RefundNo, Status: models.RefundStatusCompleted}, nil
+}
+
+func (g *gatewayProvider) QueryStatus(order models.Order) (models.PaymentStatus, error) {
+	// Ask the gateway for the payment status of the order
+	params := url.Values{}
+	params.Set("merchant", g.cfg.PAYMENT_GATEWAY_MERCHANT)
+	params.Set("order_id", strconv.FormatUint(uint64(order.ID), 10))
+	var res gatewayQueryResponse
+	if err := g.call(http.MethodGet, "/query", params, &res); err != nil {
+		return models.PaymentStatus{}, err
+	}
+	if res.ResponseCode != gatewaySuccess {
+		return models.PaymentStatus{}, models.ErrEntityNotFound
+	}
+	return models.PaymentStatus{
+		PaymentMethod: g.Name(),
+		Status:        res.Status,
+		PaidAmount:    res.PaidAmount,
+	}, nil
+}
+
+// call sends a signed request to the gateway and decodes its JSON response.
+func (g *gatewayProvider) call(method, path string, params url.Values, res interface{}) error {
+	endpoint := g.cfg.PAYMENT_GATEWAY_URL + path
+	body := g.sign(params).Encode()
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequest(method, endpoint+"?"+body, nil)
+	} else {
+		req, err = http.NewRequest(method, endpoint, strings.NewReader(body))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment gateway returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// sign adds the signature of params to them.
+func (g *gatewayProvider) sign(params url.Values) url.Values {
+	params.Del("signature")
+	mac := hmac.New(sha256.New, []byte(g.cfg.PAYMENT_GATEWAY_SECRET))
+	mac.Write([]byte(params.Encode()))
+	params.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return params
+}
+
+// verify checks the signature of the parameters of a callback.
+func (g *gatewayProvider) verify(params url.Values) bool {
+	if g.cfg.PAYMENT_GATEWAY_SECRET == "" {
+		return false
+	}
+	signature, err := hex.DecodeString(params.Get("signature"))
+	if err != nil {
+		return false
+	}
+	unsigned := url.Values{}
+	for key, values := range params {
+		if key != "signature" {
+			unsigned[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(g.cfg.PAYMENT_GATEWAY_SECRET))
+	mac.Write([]byte(unsigned.Encode()))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// newGatewayClient is the HTTP client used to talk to payment gateways.
+func newGatewayClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
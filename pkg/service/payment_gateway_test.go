@@ -0,0 +1,457 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testGatewayMerchant = "AHAVA01"
+	testGatewaySecret   = "gateway-secret"
+)
+
+// fakePaymentRepository keeps the pending payments and transfers in memory. The other
+// methods of the repository are not used by the providers.
+type fakePaymentRepository struct {
+	repository.PaymentRepository
+	pending      []models.PaymentIntent
+	transactions []models.Transaction
+}
+
+func (f *fakePaymentRepository) CreatePendingPayment(user_id uint, provider string, intent models.PaymentIntent) error {
+	f.pending = append(f.pending, intent)
+	return nil
+}
+
+func (f *fakePaymentRepository) GetPendingPayment(order_id uint, provider string, amount uint64) (models.PaymentIntent, error) {
+	for _, intent := range f.pending {
+		if intent.OrderID == order_id && intent.PaymentMethod == provider && intent.Amount == amount {
+			return intent, nil
+		}
+	}
+	return models.PaymentIntent{}, models.ErrEntityNotFound
+}
+
+func (f *fakePaymentRepository) ExpirePendingPayments(order_id uint) error {
+	return nil
+}
+
+func (f *fakePaymentRepository) CheckPaymentCode(code string) (bool, error) {
+	for _, intent := range f.pending {
+		if intent.Description == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakePaymentRepository) CheckReferenceCode(reference_code string) (bool, error) {
+	for _, transaction := range f.transactions {
+		if transaction.ReferenceCode == reference_code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakePaymentRepository) SaveTransaction(transaction models.Transaction) (models.Transaction, error) {
+	f.transactions = append(f.transactions, transaction)
+	return transaction, nil
+}
+
+// signGatewayParams signs the parameters the way the gateway does.
+func signGatewayParams(secret string, params url.Values) url.Values {
+	params.Del("signature")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(params.Encode()))
+	params.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return params
+}
+
+// checkGatewaySignature checks the signature of a request sent to the gateway. It runs
+// in the handler of the gateway, so it does not stop the test.
+func checkGatewaySignature(t *testing.T, params url.Values) {
+	t.Helper()
+	signature := params.Get("signature")
+	if signature == "" {
+		t.Error("request to the gateway is not signed")
+		return
+	}
+	signed := signGatewayParams(testGatewaySecret, cloneParams(params))
+	if signed.Get("signature") != signature {
+		t.Errorf("request to the gateway has signature %s, want %s", signature, signed.Get("signature"))
+	}
+}
+
+func cloneParams(params url.Values) url.Values {
+	clone := url.Values{}
+	for key, values := range params {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// newTestGateway starts a gateway answering with handler and returns a provider using it.
+func newTestGateway(t *testing.T, handler http.HandlerFunc) (*gatewayProvider, *fakePaymentRepository) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	repo := &fakePaymentRepository{}
+	return &gatewayProvider{
+		repository: repo,
+		cfg: config.Config{
+			PAYMENT_GATEWAY_NAME:       "vnpay",
+			PAYMENT_GATEWAY_URL:        server.URL,
+			PAYMENT_GATEWAY_MERCHANT:   testGatewayMerchant,
+			PAYMENT_GATEWAY_SECRET:     testGatewaySecret,
+			PAYMENT_GATEWAY_RETURN_URL: "https://ahava.test/payment/return",
+		},
+		client: server.Client(),
+	}, repo
+}
+
+// payHandler plays the customer paying on the gateway: it checks the signed redirect
+// and answers with the signed callback the gateway would send.
+func payHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pay" {
+			http.NotFound(w, r)
+			return
+		}
+		params := r.URL.Query()
+		checkGatewaySignature(t, params)
+		callback := url.Values{}
+		callback.Set("merchant", params.Get("merchant"))
+		callback.Set("order_ref", params.Get("order_ref"))
+		callback.Set("amount", params.Get("amount"))
+		callback.Set("transaction_no", "GW123456")
+		callback.Set("response_code", gatewaySuccess)
+		callback.Set("pay_date", "20261018103000")
+		io.WriteString(w, signGatewayParams(testGatewaySecret, callback).Encode())
+	}
+}
+
+// paidCallback returns the signed callback of a successful payment.
+func paidCallback() url.Values {
+	params := url.Values{}
+	params.Set("merchant", testGatewayMerchant)
+	params.Set("order_ref", "AHV0000001")
+	params.Set("amount", "250000")
+	params.Set("transaction_no", "GW123456")
+	params.Set("response_code", gatewaySuccess)
+	params.Set("pay_date", "20261018103000")
+	return signGatewayParams(testGatewaySecret, params)
+}
+
+func TestGatewayPaymentIsRecorded(t *testing.T) {
+	gateway, repo := newTestGateway(t, payHandler(t))
+	order := models.Order{ID: 7, UserID: 3, FinalPrice: 250000}
+
+	intent, err := gateway.CreateIntent(order, 250000)
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+	if intent.PaymentMethod != "VNPAY" || intent.Amount != 250000 || intent.Description == "" {
+		t.Fatalf("unexpected intent %+v", intent)
+	}
+	// The customer pays on the gateway, which sends back the callback
+	res, err := gateway.client.Get(intent.Link)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	payload, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("pay returned %s: %s", res.Status, payload)
+	}
+
+	result, err := gateway.HandleCallback(models.WebhookRequest{Payload: payload})
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if result.Status != models.WebhookEventProcessed || result.ReferenceCode != "GW123456" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(repo.transactions) != 1 {
+		t.Fatalf("recorded %d transfers, want 1", len(repo.transactions))
+	}
+	transaction := repo.transactions[0]
+	if transaction.Gateway != "VNPAY" || transaction.Code != intent.Description || transaction.TransferAmount != 250000 {
+		t.Fatalf("unexpected transfer %+v", transaction)
+	}
+
+	// The gateway retries its callbacks
+	result, err = gateway.HandleCallback(models.WebhookRequest{Payload: payload})
+	if err != nil {
+		t.Fatalf("HandleCallback retry: %v", err)
+	}
+	if result.Status != models.WebhookEventDuplicate || len(repo.transactions) != 1 {
+		t.Fatalf("retried callback gave %+v with %d transfers", result, len(repo.transactions))
+	}
+}
+
+func TestGatewayCallbackIsRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  func() string
+		noSecret bool
+	}{
+		{
+			name: "tampered amount",
+			payload: func() string {
+				params := paidCallback()
+				params.Set("amount", "2500000")
+				return params.Encode()
+			},
+		},
+		{
+			name: "unsigned",
+			payload: func() string {
+				params := paidCallback()
+				params.Del("signature")
+				return params.Encode()
+			},
+		},
+		{
+			name: "signature not in hex",
+			payload: func() string {
+				params := paidCallback()
+				params.Set("signature", "not-hex")
+				return params.Encode()
+			},
+		},
+		{
+			name: "signed with another secret",
+			payload: func() string {
+				return signGatewayParams("another-secret", paidCallback()).Encode()
+			},
+		},
+		{
+			name: "another merchant",
+			payload: func() string {
+				params := paidCallback()
+				params.Set("merchant", "OTHER")
+				return signGatewayParams(testGatewaySecret, params).Encode()
+			},
+		},
+		{
+			name: "no secret configured",
+			payload: func() string {
+				return paidCallback().Encode()
+			},
+			noSecret: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, repo := newTestGateway(t, http.NotFound)
+			if tt.noSecret {
+				gateway.cfg.PAYMENT_GATEWAY_SECRET = ""
+			}
+			result, err := gateway.HandleCallback(models.WebhookRequest{Payload: []byte(tt.payload())})
+			if err != models.ErrUnauthorized {
+				t.Fatalf("got error %v, want %v", err, models.ErrUnauthorized)
+			}
+			if result.Status != models.WebhookEventRejected || len(repo.transactions) != 0 {
+				t.Fatalf("rejected callback gave %+v with %d transfers", result, len(repo.transactions))
+			}
+		})
+	}
+}
+
+func TestGatewayCallbackOfFailedPayment(t *testing.T) {
+	gateway, repo := newTestGateway(t, http.NotFound)
+	params := paidCallback()
+	params.Set("response_code", "24")
+	result, err := gateway.HandleCallback(models.WebhookRequest{
+		Payload: []byte(signGatewayParams(testGatewaySecret, params).Encode()),
+	})
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if result.Status != models.WebhookEventIgnored || len(repo.transactions) != 0 {
+		t.Fatalf("failed payment gave %+v with %d transfers", result, len(repo.transactions))
+	}
+}
+
+func TestGatewayRefund(t *testing.T) {
+	responseCode := gatewaySuccess
+	gateway, _ := newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/refund" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse refund: %v", err)
+		}
+		checkGatewaySignature(t, r.PostForm)
+		if r.PostForm.Get("merchant") != testGatewayMerchant ||
+			r.PostForm.Get("transaction_no") != "GW123456" ||
+			r.PostForm.Get("amount") != "100000" {
+			t.Errorf("unexpected refund request %v", r.PostForm)
+		}
+		json.NewEncoder(w).Encode(gatewayRefundResponse{ResponseCode: responseCode, RefundNo: "RF42"})
+	})
+	payment := models.Transaction{ReferenceCode: "GW123456", TransferAmount: 250000}
+
+	result, err := gateway.Refund(payment, 100000)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if result.Status != models.RefundStatusCompleted || result.Reference != "RF42" {
+		t.Fatalf("unexpected refund result %+v", result)
+	}
+
+	// The gateway declines the refund
+	responseCode = "94"
+	result, err = gateway.Refund(payment, 100000)
+	if err == nil || !strings.Contains(err.Error(), "94") {
+		t.Fatalf("declined Refund gave error %v, want the response code", err)
+	}
+	if result.Status != models.RefundStatusFailed {
+		t.Fatalf("declined refund has status %s, want %s", result.Status, models.RefundStatusFailed)
+	}
+}
+
+func TestGatewayQueryStatus(t *testing.T) {
+	gateway, _ := newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/query" {
+			http.NotFound(w, r)
+			return
+		}
+		params := r.URL.Query()
+		checkGatewaySignature(t, params)
+		if params.Get("order_id") != "7" {
+			json.NewEncoder(w).Encode(gatewayQueryResponse{ResponseCode: "91"})
+			return
+		}
+		json.NewEncoder(w).Encode(gatewayQueryResponse{
+			ResponseCode: gatewaySuccess,
+			Status:       models.PaymentStatusPaid,
+			PaidAmount:   250000,
+		})
+	})
+
+	status, err := gateway.QueryStatus(models.Order{ID: 7})
+	if err != nil {
+		t.Fatalf("QueryStatus: %v", err)
+	}
+	if status.PaymentMethod != "VNPAY" || status.Status != models.PaymentStatusPaid || status.PaidAmount != 250000 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// The gateway does not know the order
+	if _, err := gateway.QueryStatus(models.Order{ID: 8}); err != models.ErrEntityNotFound {
+		t.Fatalf("unknown order gave error %v, want %v", err, models.ErrEntityNotFound)
+	}
+}
+
+func TestGatewayBadResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "redirect to a login page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusFound)
+			},
+		},
+		{
+			name: "malformed JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "<html>not json</html>")
+			},
+		},
+		{
+			name: "truncated JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, `{"response_code": "00", "refund_no": `)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, _ := newTestGateway(t, tt.handler)
+
+			result, err := gateway.Refund(models.Transaction{ReferenceCode: "GW123456"}, 100000)
+			if err == nil {
+				t.Fatal("Refund succeeded on a bad response")
+			}
+			if result.Status != models.RefundStatusFailed {
+				t.Fatalf("refund has status %s, want %s", result.Status, models.RefundStatusFailed)
+			}
+
+			if _, err := gateway.QueryStatus(models.Order{ID: 7}); err == nil {
+				t.Fatal("QueryStatus succeeded on a bad response")
+			}
+		})
+	}
+}
+
+func TestSePayVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"gateway":"Vietcombank","referenceCode":"FT26291","transferAmount":250000}`)
+	mac := hmac.New(sha256.New, []byte("sepay-secret"))
+	mac.Write(payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		secret        string
+		authorization string
+		signature     string
+		payload       []byte
+		want          bool
+	}{
+		{name: "valid API key", apiKey: "sepay-key", authorization: "Apikey sepay-key", want: true},
+		{name: "invalid API key", apiKey: "sepay-key", authorization: "Apikey other-key"},
+		{name: "missing API key", apiKey: "sepay-key"},
+		{name: "API key without scheme", apiKey: "sepay-key", authorization: "sepay-key", want: true},
+		{name: "valid HMAC", secret: "sepay-secret", signature: signature, want: true},
+		{name: "invalid HMAC", secret: "sepay-secret", signature: strings.Repeat("0", len(signature))},
+		{name: "HMAC not in hex", secret: "sepay-secret", signature: "zz"},
+		{name: "HMAC of another payload", secret: "sepay-secret", signature: signature, payload: []byte(`{"transferAmount":1}`)},
+		{name: "valid API key and HMAC", apiKey: "sepay-key", secret: "sepay-secret", authorization: "Apikey sepay-key", signature: signature, want: true},
+		{name: "valid API key and invalid HMAC", apiKey: "sepay-key", secret: "sepay-secret", authorization: "Apikey sepay-key", signature: "00"},
+		{name: "invalid API key and valid HMAC", apiKey: "sepay-key", secret: "sepay-secret", authorization: "Apikey other-key", signature: signature},
+		{name: "nothing configured", authorization: "Apikey sepay-key", signature: signature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &sePayProvider{cfg: config.Config{
+				SEPAY_WEBHOOK_API_KEY: tt.apiKey,
+				SEPAY_WEBHOOK_SECRET:  tt.secret,
+			}}
+			body := payload
+			if tt.payload != nil {
+				body = tt.payload
+			}
+			got := provider.verifyWebhook(models.WebhookRequest{
+				Authorization: tt.authorization,
+				Signature:     tt.signature,
+				Payload:       body,
+			})
+			if got != tt.want {
+				t.Fatalf("verifyWebhook = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PaymentProvider is a way of paying an order. Providers are registered under the
+// name of the PaymentMethod rows that enable them.
+type PaymentProvider interface {
+	Name() string
+	// CreateIntent returns what the customer needs to pay amount on the order.
+	CreateIntent(order models.Order, amount uint64) (models.PaymentIntent, error)
+	// HandleCallback verifies a notification from the provider and records the payment.
+	HandleCallback(request models.WebhookRequest) (models.CallbackResult, error)
+	// Refund gives back amount of a payment received through the provider.
+	Refund(payment models.Transaction, amount uint64) (models.RefundResult, error)
+	// QueryStatus returns the payment status of the order as known by the provider.
+	QueryStatus(order models.Order) (models.PaymentStatus, error)
+}
+
+// intentExpiry is how long a payment code is offered before a new one is issued.
+const intentExpiry = 15 * time.Minute
+
+// pendingPayment returns the unexpired payment code of the order for the amount, or
+// creates a new one and expires the codes issued for other amounts.
+func pendingPayment(repo repository.PaymentRepository, provider string, order models.Order, amount uint64) (models.PaymentIntent, error) {
+	// Reuse the pending payment for the same amount
+	intent, err := repo.GetPendingPayment(order.ID, provider, amount)
+	if err == nil {
+		return intent, nil
+	}
+	if err != models.ErrEntityNotFound {
+		return models.PaymentIntent{}, err
+	}
+	// Expire the payments issued for another amount
+	if err := repo.ExpirePendingPayments(order.ID); err != nil {
+		return models.PaymentIntent{}, err
+	}
+	// Generate a random code that is not used by another payment
+	var code string
+	for {
+		code = fmt.Sprintf("AHV%07d", rand.Intn(10000000))
+		exists, err := repo.CheckPaymentCode(code)
+		if err != nil {
+			return models.PaymentIntent{}, err
+		}
+		if !exists {
+			break
+		}
+	}
+	// Save the pending payment
+	intent = models.PaymentIntent{
+		OrderID:       order.ID,
+		PaymentMethod: provider,
+		Amount:        amount,
+		Description:   code,
+		ExpireAt:      time.Now().Add(intentExpiry),
+	}
+	if err := repo.CreatePendingPayment(order.UserID, provider, intent); err != nil {
+		return models.PaymentIntent{}, err
+	}
+	return intent, nil
+}
+
+// recordTransfer adds a transfer to the ledger of its order. Providers retry their
+// notifications, so a transfer already recorded is acknowledged as a duplicate.
+func recordTransfer(repo repository.PaymentRepository, transaction models.Transaction) (models.CallbackResult, error) {
+	result := models.CallbackResult{ReferenceCode: transaction.ReferenceCode}
+	exists, err := repo.CheckReferenceCode(transaction.ReferenceCode)
+	if err != nil {
+		result.Status = models.WebhookEventFailed
+		return result, err
+	}
+	if exists {
+		result.Status = models.WebhookEventDuplicate
+		return result, nil
+	}
+	// Record the transfer, the order payment status is updated with it
+	if _, err := repo.SaveTransaction(transaction); err != nil {
+		if err == models.ErrAlreadyExists {
+			result.Status = models.WebhookEventDuplicate
+			return result, nil
+		}
+		result.Status = models.WebhookEventFailed
+		return result, err
+	}
+	result.Status = models.WebhookEventProcessed
+	return result, nil
+}
+
+// sePayProvider takes bank transfers through SePay QR codes. SePay notifies every
+// transfer into the account through a webhook.
+type sePayProvider struct {
+	repository repository.PaymentRepository
+	cfg        config.Config
+}
+
+func (s *sePayProvider) Name() string {
+	return models.PaymentMethodSePay
+}
+
+func (s *sePayProvider) CreateIntent(order models.Order, amount uint64) (models.PaymentIntent, error) {
+	// Get or create the pending payment code
+	intent, err := pendingPayment(s.repository, s.Name(), order, amount)
+	if err != nil {
+		return models.PaymentIntent{}, err
+	}
+	// Fill in the bank account and the link of the QR code image
+	intent.AccountNumber = s.cfg.SEPAY_ACCOUNT_NUMBER
+	intent.BankName = s.cfg.SEPAY_BANK_NAME
+	intent.Link = fmt.Sprintf("https://qr.sepay.vn/img?acc=%s&bank=%s&amount=%d&des=%s&template=compact",
+		url.QueryEscape(intent.AccountNumber), url.QueryEscape(intent.BankName), intent.Amount, intent.Description)
+	return intent, nil
+}
+
+func (s *sePayProvider) HandleCallback(request models.WebhookRequest) (models.CallbackResult, error) {
+	// Check that the request comes from SePay
+	if !s.verifyWebhook(request) {
+		return models.CallbackResult{Status: models.WebhookEventRejected}, models.ErrUnauthorized
+	}
+	// Parse the payload
+	var transaction models.Transaction
+	if err := json.Unmarshal(request.Payload, &transaction); err != nil {
+		return models.CallbackResult{Status: models.WebhookEventRejected}, models.ErrBadRequest
+	}
+	result := models.CallbackResult{ReferenceCode: transaction.ReferenceCode, Status: models.WebhookEventRejected}
+	if transaction.ReferenceCode == "" || transaction.Code == "" {
+		return result, models.ErrBadRequest
+	}
+	// Only transfers into our own account are accepted
+	if transaction.AccountNumber != s.cfg.SEPAY_ACCOUNT_NUMBER {
+		return result, models.ErrForbidden
+	}
+	if transaction.TransferType != "in" {
+		result.Status = models.WebhookEventIgnored
+		return result, nil
+	}
+	// Record the transfer
+	return recordTransfer(s.repository, transaction)
+}
+
+// verifyWebhook checks the API key SePay sends as "Authorization: Apikey <key>" and,
+// when a secret is configured, the hex HMAC-SHA256 of the body. Without any configured
+// credential every request is rejected.
+func (s *sePayProvider) verifyWebhook(request models.WebhookRequest) bool {
+	if s.cfg.SEPAY_WEBHOOK_API_KEY == "" && s.cfg.SEPAY_WEBHOOK_SECRET == "" {
+		return false
+	}
+	if s.cfg.SEPAY_WEBHOOK_API_KEY != "" {
+		key := strings.TrimSpace(strings.TrimPrefix(request.Authorization, "Apikey "))
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.SEPAY_WEBHOOK_API_KEY)) != 1 {
+			return false
+		}
+	}
+	if s.cfg.SEPAY_WEBHOOK_SECRET != "" {
+		signature, err := hex.DecodeString(request.Signature)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(s.cfg.SEPAY_WEBHOOK_SECRET))
+		mac.Write(request.Payload)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Refund of a bank transfer is made by hand from the bank account, so it stays pending
+// until finance confirms it.
+func (s *sePayProvider) Refund(payment models.Transaction, amount uint64) (models.RefundResult, error) {
+	return models.RefundResult{Status: models.RefundStatusPending}, nil
+}
+
+func (s *sePayProvider) QueryStatus(order models.Order) (models.PaymentStatus, error) {
+	// Every transfer is pushed by the webhook, so the ledger is up to date
+	return models.PaymentStatus{
+		PaymentMethod: s.Name(),
+		Status:        order.PaymentStatus,
+		PaidAmount:    order.PaidAmount,
+	}, nil
+}
+
+// codProvider is cash on delivery: nothing is paid online.
+type codProvider struct{}
+
+func (c *codProvider) Name() string {
+	return models.PaymentMethodCOD
+}
+
+func (c *codProvider) CreateIntent(order models.Order, amount uint64) (models.PaymentIntent, error) {
+	return models.PaymentIntent{
+		OrderID:       order.ID,
+		PaymentMethod: c.Name(),
+		Amount:        amount,
+	}, nil
+}
+
+func (c *codProvider) HandleCallback(request models.WebhookRequest) (models.CallbackResult, error) {
+	return models.CallbackResult{Status: models.WebhookEventRejected}, models.ErrBadRequest
+}
+
+// Refund of cash is made by hand, so it stays pending until finance confirms it.
+func (c *codProvider) Refund(payment models.Transaction, amount uint64) (models.RefundResult, error) {
+	return models.RefundResult{Status: models.RefundStatusPending}, nil
+}
+
+func (c *codProvider) QueryStatus(order models.Order) (models.PaymentStatus, error) {
+	return models.PaymentStatus{
+		PaymentMethod: c.Name(),
+		Status:        order.PaymentStatus,
+		PaidAmount:    order.PaidAmount,
+	}, nil
+}
+
+// walletProvider pays with the store credit of the customer. It cannot be chosen as
+// the payment method of an order, the wallet is used next to it at checkout.
+type walletProvider struct{}
+
+func (w *walletProvider) Name() string {
+	return models.PaymentMethodWallet
+}
+
+func (w *walletProvider) CreateIntent(order models.Order, amount uint64) (models.PaymentIntent, error) {
+	return models.PaymentIntent{}, models.ErrBadRequest
+}
+
+func (w *walletProvider) HandleCallback(request models.WebhookRequest) (models.CallbackResult, error) {
+	return models.CallbackResult{Status: models.WebhookEventRejected}, models.ErrBadRequest
+}
+
+// The wallet is credited when the refund is marked completed.
+func (w *walletProvider) Refund(payment models.Transaction, amount uint64) (models.RefundResult, error) {
+	return models.RefundResult{Status: models.RefundStatusCompleted}, nil
+}
+
+func (w *walletProvider) QueryStatus(order models.Order) (models.PaymentStatus, error) {
+	return models.PaymentStatus{
+		PaymentMethod: w.Name(),
+		Status:        order.PaymentStatus,
+		PaidAmount:    order.PaidAmount,
+	}, nil
+}
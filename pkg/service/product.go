@@ -4,6 +4,10 @@ import (
 	helper "ahava/pkg/helper"
 	repository "ahava/pkg/repository"
 	"ahava/pkg/utils/models"
+	"log"
+	"strings"
+	"time"
+	"unicode"
 )
 
 type ProductService interface {
@@ -14,25 +18,43 @@ type ProductService interface {
 	ListAllProducts(limit, offest int) (models.ListProducts, error)
 	ListCategoryProducts(category string) ([]models.Product, error)
 	ListFeaturedProducts() ([]models.Product, error)
-	SearchProducts(key string) ([]models.Product, error)
+	SearchProducts(user_id uint, key string, limit, offset int) (models.SearchProducts, error)
+	GetSearchHistory(user_id uint, limit int) ([]models.SearchHistory, error)
+	DeleteSearchHistory(user_id, history_id uint) error
+	ClearSearchHistory(user_id uint) error
+	ListTrendingSearches(limit int) ([]models.TrendingSearch, error)
+	SuggestSearch(key string, limit int) (models.SearchSuggestions, error)
+	QueryProducts(query models.ProductQuery, limit, offset int) (models.CatalogProducts, error)
+	AdjustStock(product_id, price_id, admin_id uint, adjust models.AdjustStock) (models.Price, error)
+	ListStockMovements(product_id uint, limit, offset int) (models.ListStockMovements, error)
 }
 
+// trendingSearchWindow is how far back the searches count for the trending ones.
+const trendingSearchWindow = 7 * 24 * time.Hour
+
 type productService struct {
-	repository repository.ProductRepository
-	helper     helper.Helper
+	repository       repository.ProductRepository
+	searchRepository repository.SearchRepository
+	helper           helper.Helper
 }
 
 func NewProductService(
 	repo repository.ProductRepository,
+	searchRepo repository.SearchRepository,
 	h helper.Helper,
 ) ProductService {
 	return &productService{
-		repository: repo,
-		helper:     h,
+		repository:       repo,
+		searchRepository: searchRepo,
+		helper:           h,
 	}
 }
 
 func (i *productService) AddProduct(p models.Product) (models.Product, error) {
+	// Every product belongs to a category
+	if p.CategoryID == nil && strings.TrimSpace(p.Category) == "" {
+		return models.Product{}, models.ErrBadRequest
+	}
 	// Add product
 	product, err := i.repository.AddProduct(p)
 	if err != nil {
@@ -49,6 +71,7 @@ func (i *productService) AddProduct(p models.Product) (models.Product, error) {
 	}
 	// Assign the price to the product
 	product.Price = prices
+	setStockStatus(&product)
 	// Return the product
 	return product, nil
 }
@@ -105,6 +128,7 @@ func (i *productService) UpdateProduct(product_id uint, p models.Product) (model
 	}
 	// Assign the updated prices to the product
 	product.Price = prices
+	setStockStatus(&product)
 	// Return the updated product
 	return product, nil
 }
@@ -131,6 +155,7 @@ func (i *productService) GetProductDetails(product_id uint) (models.Product, err
 	}
 
 	product.Price = price
+	setStockStatus(&product)
 
 	return product, nil
 }
@@ -142,6 +167,10 @@ func (i *productService) ListCategoryProducts(category string) ([]models.Product
 		return nil, err
 	}
 
+	if err := i.attachPrices(productRefs(products)); err != nil {
+		return nil, err
+	}
+
 	return products, nil
 }
 
@@ -152,12 +181,8 @@ func (i *productService) ListFeaturedProducts() ([]models.Product, error) {
 		return []models.Product{}, err
 	}
 
-	for idx := range products {
-		price, err := i.repository.GetProductPrice(products[idx].ID)
-		if err != nil {
-			return []models.Product{}, err
-		}
-		products[idx].Price = price
+	if err := i.attachPrices(productRefs(products)); err != nil {
+		return []models.Product{}, err
 	}
 
 	return products, nil
@@ -170,31 +195,192 @@ func (i *productService) ListAllProducts(limit, offset int) (models.ListProducts
 		return models.ListProducts{}, err
 	}
 
-	for idx := range products.Products {
-		price, err := i.repository.GetProductPrice(products.Products[idx].ID)
-		if err != nil {
-			return models.ListProducts{}, err
-		}
-		products.Products[idx].Price = price
+	if err := i.attachPrices(productRefs(products.Products)); err != nil {
+		return models.ListProducts{}, err
 	}
 
 	return products, nil
 }
 
-func (i *productService) SearchProducts(key string) ([]models.Product, error) {
+func (i *productService) SearchProducts(user_id uint, key string, limit, offset int) (models.SearchProducts, error) {
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return models.SearchProducts{}, models.ErrBadRequest
+	}
 
-	products, err := i.repository.SearchProducts(key)
+	results, err := i.repository.SearchProducts(key, limit, offset)
 	if err != nil {
-		return []models.Product{}, err
+		return models.SearchProducts{}, err
 	}
 
-	for idx := range products {
-		price, err := i.repository.GetProductPrice(products[idx].ID)
-		if err != nil {
-			return []models.Product{}, err
+	// Record the search once, not for every page of it
+	if offset == 0 {
+		if err := i.searchRepository.AddSearchHistory(models.SearchHistory{
+			UserID:        user_id,
+			SearchKey:     key,
+			NormalizedKey: normalizeSearchKey(key),
+			ResultCount:   results.Total,
+		}); err != nil {
+			log.Printf("could not record the search %q: %v", key, err)
 		}
-		products[idx].Price = price
 	}
 
-	return products, nil
+	refs := make([]*models.Product, 0, len(results.Products))
+	for idx := range results.Products {
+		refs = append(refs, &results.Products[idx].Product)
+	}
+	if err := i.attachPrices(refs); err != nil {
+		return models.SearchProducts{}, err
+	}
+
+	return results, nil
+}
+
+func (i *productService) GetSearchHistory(user_id uint, limit int) ([]models.SearchHistory, error) {
+	return i.searchRepository.GetSearchHistory(user_id, limit)
+}
+
+func (i *productService) DeleteSearchHistory(user_id, history_id uint) error {
+	return i.searchRepository.DeleteSearchHistory(user_id, history_id)
+}
+
+func (i *productService) ClearSearchHistory(user_id uint) error {
+	return i.searchRepository.ClearSearchHistory(user_id)
+}
+
+func (i *productService) ListTrendingSearches(limit int) ([]models.TrendingSearch, error) {
+	return i.searchRepository.ListTrendingSearches(time.Now().Add(-trendingSearchWindow), limit)
+}
+
+func (i *productService) SuggestSearch(key string, limit int) (models.SearchSuggestions, error) {
+
+	suggestions := models.SearchSuggestions{
+		Products:   []models.ProductSuggestion{},
+		Categories: []models.CategorySuggestion{},
+	}
+	query := prefixQuery(key)
+	if query == "" {
+		return suggestions, nil
+	}
+
+	products, err := i.searchRepository.SuggestProducts(query, limit)
+	if err != nil {
+		return models.SearchSuggestions{}, err
+	}
+	categories, err := i.searchRepository.SuggestCategories(query, limit)
+	if err != nil {
+		return models.SearchSuggestions{}, err
+	}
+	suggestions.Products = products
+	suggestions.Categories = categories
+
+	return suggestions, nil
+}
+
+// normalizeSearchKey returns the form searches are grouped under, so the case and
+// spacing of a key do not split it.
+func normalizeSearchKey(key string) string {
+	return strings.ToLower(strings.Join(strings.Fields(key), " "))
+}
+
+// prefixQuery turns what the customer typed into a tsquery matching the words starting
+// with every typed word, "sua ru" gives 'sua':* & 'ru':*. Only letters and digits are
+// kept, so the query is always valid.
+func prefixQuery(key string) string {
+	var terms []string
+	for _, word := range strings.Fields(key) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if word != "" {
+			terms = append(terms, "'"+word+"':*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+func (i *productService) QueryProducts(query models.ProductQuery, limit, offset int) (models.CatalogProducts, error) {
+
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return models.CatalogProducts{}, models.ErrBadRequest
+	}
+
+	catalog, err := i.repository.QueryProducts(query, limit, offset)
+	if err != nil {
+		return models.CatalogProducts{}, err
+	}
+
+	if err := i.attachPrices(productRefs(catalog.Products)); err != nil {
+		return models.CatalogProducts{}, err
+	}
+
+	return catalog, nil
+}
+
+func (i *productService) AdjustStock(product_id, price_id, admin_id uint, adjust models.AdjustStock) (models.Price, error) {
+	// Adjust the stock of the size and record the reason
+	price, err := i.repository.AdjustStock(models.StockMovement{
+		PriceID:   price_id,
+		ProductID: product_id,
+		Change:    adjust.Change,
+		Type:      models.StockMovementAdjustment,
+		AdminID:   admin_id,
+		Note:      adjust.Note,
+	})
+	if err != nil {
+		return models.Price{}, err
+	}
+	price.OutOfStock = price.Stock == 0
+	// Return the updated price
+	return price, nil
+}
+
+func (i *productService) ListStockMovements(product_id uint, limit, offset int) (models.ListStockMovements, error) {
+	// Get the stock movements of the product
+	movements, err := i.repository.ListStockMovements(product_id, limit, offset)
+	if err != nil {
+		return models.ListStockMovements{}, err
+	}
+	// Return the stock movements
+	return movements, nil
+}
+
+// attachPrices loads the prices of the products in one query and sets their stock status.
+func (i *productService) attachPrices(products []*models.Product) error {
+	product_ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		product_ids = append(product_ids, product.ID)
+	}
+	prices, err := i.repository.GetProductPrices(product_ids)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		product.Price = prices[product.ID]
+		setStockStatus(product)
+	}
+	return nil
+}
+
+func productRefs(products []models.Product) []*models.Product {
+	refs := make([]*models.Product, 0, len(products))
+	for idx := range products {
+		refs = append(refs, &products[idx])
+	}
+	return refs
+}
+
+// setStockStatus marks the sizes without stock, and the product once no size is left.
+func setStockStatus(product *models.Product) {
+	product.OutOfStock = true
+	for idx := range product.Price {
+		product.Price[idx].OutOfStock = product.Price[idx].Stock == 0
+		if !product.Price[idx].OutOfStock {
+			product.OutOfStock = false
+		}
+	}
 }
@@ -0,0 +1,200 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// listingDriver is a database/sql driver answering every query with rows rows, or one
+// row for counts and inserts, so the listings can be run without a database.
+type listingDriver struct {
+	rows int
+}
+
+func (d *listingDriver) Open(name string) (driver.Conn, error) {
+	return &listingConn{driver: d}, nil
+}
+
+func (d *listingDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *listingDriver) Driver() driver.Driver {
+	return d
+}
+
+type listingConn struct {
+	driver *listingDriver
+}
+
+func (c *listingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *listingConn) Close() error {
+	return nil
+}
+
+func (c *listingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *listingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c *listingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = strings.ToLower(query)
+	switch {
+	case strings.Contains(query, "count("):
+		return &listingRows{columns: []string{"count"}, values: [][]driver.Value{{int64(100)}}}, nil
+	case strings.HasPrefix(query, "insert"):
+		return &listingRows{columns: []string{"id"}, values: [][]driver.Value{{int64(1)}}}, nil
+	}
+	// Every row refers to its own product and order, so each gets its own prices and items
+	rows := &listingRows{columns: []string{"id", "product_id", "order_id", "name", "size", "stock", "is_featured"}}
+	for i := 1; i <= c.driver.rows; i++ {
+		rows.values = append(rows.values, []driver.Value{int64(i), int64(i), int64(i), "Sản phẩm", "M", int64(5), true})
+	}
+	return rows, nil
+}
+
+type listingRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *listingRows) Columns() []string {
+	return r.columns
+}
+
+func (r *listingRows) Close() error {
+	return nil
+}
+
+func (r *listingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newListingDB opens a GORM database on listingDriver and counts the SQL statements it runs.
+func newListingDB(t testing.TB) (*gorm.DB, *listingDriver, *int) {
+	t.Helper()
+	fake := &listingDriver{}
+	sqlDB := sql.OpenDB(fake)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	statements := 0
+	count := func(db *gorm.DB) {
+		if db.Statement.SQL.Len() > 0 {
+			statements++
+		}
+	}
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Query().After("gorm:query").Register("test:count_query", count),
+		callbacks.Row().After("gorm:row").Register("test:count_row", count),
+		callbacks.Raw().After("gorm:raw").Register("test:count_raw", count),
+		callbacks.Create().After("gorm:create").Register("test:count_create", count),
+		callbacks.Update().After("gorm:update").Register("test:count_update", count),
+		callbacks.Delete().After("gorm:delete").Register("test:count_delete", count),
+	} {
+		if err != nil {
+			t.Fatalf("register callback: %v", err)
+		}
+	}
+	return db, fake, &statements
+}
+
+// TestListingQueryCount checks that the listings load the prices and the items of a
+// page in a fixed number of queries, whatever the size of the page.
+func TestListingQueryCount(t *testing.T) {
+	db, fake, statements := newListingDB(t)
+	productService := NewProductService(repository.NewProductRepository(db), repository.NewSearchRepository(db), nil)
+	orderService := &orderService{repository: repository.NewOrderRepository(db)}
+
+	listings := []struct {
+		name string
+		list func(limit int) (int, error)
+	}{
+		{
+			name: "ListAllProducts",
+			list: func(limit int) (int, error) {
+				products, err := productService.ListAllProducts(limit, 0)
+				for _, product := range products.Products {
+					if len(product.Price) == 0 {
+						t.Errorf("product %d has no prices", product.ID)
+					}
+				}
+				return len(products.Products), err
+			},
+		},
+		{
+			name: "SearchProducts",
+			list: func(limit int) (int, error) {
+				results, err := productService.SearchProducts(1, "áo thun", limit, 0)
+				for _, result := range results.Products {
+					if len(result.Price) == 0 {
+						t.Errorf("product %d has no prices", result.ID)
+					}
+				}
+				return len(results.Products), err
+			},
+		},
+		{
+			name: "ListAllOrders",
+			list: func(limit int) (int, error) {
+				orders, err := orderService.ListAllOrders(limit, 0)
+				for _, order := range orders.Orders {
+					if len(order.Details) == 0 {
+						t.Errorf("order %d has no items", order.ID)
+					}
+				}
+				return len(orders.Orders), err
+			},
+		},
+	}
+	for _, listing := range listings {
+		t.Run(listing.name, func(t *testing.T) {
+			queries := -1
+			for _, limit := range []int{1, 10, 50} {
+				fake.rows = limit
+				*statements = 0
+				count, err := listing.list(limit)
+				if err != nil {
+					t.Fatalf("page of %d: %v", limit, err)
+				}
+				if count != limit {
+					t.Fatalf("page of %d listed %d rows", limit, count)
+				}
+				if queries == -1 {
+					queries = *statements
+				} else if *statements != queries {
+					t.Fatalf("page of %d ran %d queries, the page of 1 ran %d", limit, *statements, queries)
+				}
+			}
+			t.Logf("%d queries per page", queries)
+		})
+	}
+}
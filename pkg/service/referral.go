@@ -0,0 +1,165 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	helper "ahava/pkg/helper"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"net/url"
+	"strings"
+)
+
+const (
+	// referralReward is what the referrer gets once the first order of the referred customer is delivered.
+	referralReward = 50000
+	// referralCodeTries is how many codes are generated before giving up on a unique one.
+	referralCodeTries = 5
+)
+
+type ReferralService interface {
+	GenerateReferralCode() (string, error)
+	AttributeReferral(code string, referee models.UserDetailsResponse, client_ip string) error
+	GetReferralDashboard(user_id uint, limit, offset int) (models.ReferralDashboard, error)
+	ListReferrals(status string, limit, offset int) (models.ListReferrals, error)
+}
+
+type referralService struct {
+	repository repository.ReferralRepository
+	helper     helper.Helper
+	cfg        config.Config
+}
+
+func NewReferralService(repo repository.ReferralRepository, h helper.Helper, cfg config.Config) ReferralService {
+	return &referralService{
+		repository: repo,
+		helper:     h,
+		cfg:        cfg,
+	}
+}
+
+func (r *referralService) GenerateReferralCode() (string, error) {
+	// Codes are short, so make sure nobody else has it
+	for i := 0; i < referralCodeTries; i++ {
+		code, err := r.helper.GenerateRefferalCode()
+		if err != nil {
+			return "", err
+		}
+		exists, err := r.repository.CheckReferralCode(code)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return code, nil
+		}
+	}
+	return "", models.ErrConflict
+}
+
+func (r *referralService) AttributeReferral(code string, referee models.UserDetailsResponse, client_ip string) error {
+	// Unknown codes are ignored, the link may be old
+	referrer, err := r.repository.FindUserByReferralCode(strings.TrimSpace(code))
+	if err != nil {
+		if err == models.ErrEntityNotFound {
+			return nil
+		}
+		return err
+	}
+	referral := models.Referral{
+		ReferrerID:   referrer.ID,
+		RefereeID:    referee.ID,
+		Status:       models.ReferralStatusPending,
+		RewardAmount: referralReward,
+	}
+	// Keep the referrals that look like the referrer signed up again, so admins see them,
+	// but never reward them
+	switch {
+	case referrer.ID == referee.ID:
+		referral.Note = "Tự giới thiệu chính mình"
+	case referrer.IsBlocked:
+		referral.Note = "Người giới thiệu đã bị chặn"
+	case sameEmail(referrer.Email, referee.Email):
+		referral.Note = "Trùng email với người giới thiệu"
+	case r.samePhone(referrer.Phone, referee.Phone):
+		referral.Note = "Trùng số điện thoại với người giới thiệu"
+	case client_ip != "":
+		used, err := r.repository.HasUsedClientIP(referrer.ID, client_ip)
+		if err != nil {
+			return err
+		}
+		if used {
+			referral.Note = "Trùng địa chỉ IP với người giới thiệu"
+		}
+	}
+	if referral.Note != "" {
+		referral.Status = models.ReferralStatusRejected
+		referral.RewardAmount = 0
+	}
+	return r.repository.CreateReferral(referral)
+}
+
+func (r *referralService) GetReferralDashboard(user_id uint, limit, offset int) (models.ReferralDashboard, error) {
+	code, err := r.repository.GetReferralCode(user_id)
+	if err != nil {
+		return models.ReferralDashboard{}, err
+	}
+	referrals, err := r.repository.ListReferrals(user_id, "", limit, offset)
+	if err != nil {
+		return models.ReferralDashboard{}, err
+	}
+	// The link opens the sign up page of the shop with the code filled in
+	var link string
+	if r.cfg.WEB_BASE_URL != "" {
+		link = strings.TrimRight(r.cfg.WEB_BASE_URL, "/") + "/signup?reference=" + url.QueryEscape(code)
+	}
+	return models.ReferralDashboard{
+		Code:          code,
+		Link:          link,
+		ListReferrals: referrals,
+	}, nil
+}
+
+func (r *referralService) ListReferrals(status string, limit, offset int) (models.ListReferrals, error) {
+	switch status {
+	case "", models.ReferralStatusPending, models.ReferralStatusRewarded, models.ReferralStatusRejected:
+		return r.repository.ListReferrals(0, status, limit, offset)
+	default:
+		return models.ListReferrals{}, models.ErrBadRequest
+	}
+}
+
+// samePhone reports whether two phones are the same number, whatever form they were saved in.
+func (r *referralService) samePhone(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a_phone, err := r.helper.NormalizePhone(a)
+	if err != nil {
+		return false
+	}
+	b_phone, err := r.helper.NormalizePhone(b)
+	if err != nil {
+		return false
+	}
+	return a_phone == b_phone
+}
+
+// sameEmail reports whether two emails reach the same mailbox. The +tag is ignored,
+// and so are the dots of Gmail addresses.
+func sameEmail(a, b string) bool {
+	return mailbox(a) == mailbox(b)
+}
+
+func mailbox(email string) string {
+	local, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !found {
+		return local
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
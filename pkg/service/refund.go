@@ -0,0 +1,251 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+)
+
+type RefundService interface {
+	CreateRefund(order_id, admin_id uint, refund models.CreateRefund) ([]models.Refund, error)
+	GetRefund(refund_id uint) (models.Refund, error)
+	ListRefunds(order_id uint, status string, limit, offset int) (models.ListRefunds, error)
+	RetryRefund(refund_id uint) (models.Refund, error)
+	CompleteRefund(refund_id uint, update models.UpdateRefund) (models.Refund, error)
+	FailRefund(refund_id uint, update models.UpdateRefund) (models.Refund, error)
+}
+
+type refundService struct {
+	repository      repository.RefundRepository
+	orderRepository repository.OrderRepository
+	paymentService  PaymentService
+}
+
+func NewRefundService(
+	repo repository.RefundRepository,
+	orderRepo repository.OrderRepository,
+	paymentService PaymentService,
+) RefundService {
+	return &refundService{
+		repository:      repo,
+		orderRepository: orderRepo,
+		paymentService:  paymentService,
+	}
+}
+
+func (r *refundService) CreateRefund(order_id, admin_id uint, refund models.CreateRefund) ([]models.Refund, error) {
+	// Get the order and the items to refund
+	order, err := r.orderRepository.GetOrder(order_id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := r.refundItems(order, refund)
+	if err != nil {
+		return nil, err
+	}
+	// The amount is the price paid for the items unless one is given
+	amount := refund.Amount
+	if amount == 0 {
+		for _, item := range items {
+			amount += item.Amount
+		}
+	}
+	// Take the amount off the payments that have not been refunded yet
+	refunds, err := r.allocateRefund(order, refund.TransactionID, amount, len(refund.Items) == 0 && refund.Amount == 0)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range refunds {
+		refunds[idx].Reason = refund.Reason
+		refunds[idx].CreatedBy = admin_id
+		if refund.ToWallet {
+			refunds[idx].Provider = models.PaymentMethodWallet
+		}
+	}
+	refunds[0].Items = items
+	// Save the refunds, the items of canceled orders are already back in stock
+	restock := !refund.SkipRestock && order.OrderStatus != models.OrderStatusCanceled
+	created, err := r.repository.CreateRefunds(refunds, restock)
+	if err != nil {
+		return nil, err
+	}
+	// Send the refunds to the payment providers
+	for idx, refund := range created {
+		result, err := r.processRefund(refund)
+		if err != nil {
+			return nil, err
+		}
+		created[idx] = result
+	}
+	// Return the refunds
+	return created, nil
+}
+
+// refundItems returns the items to refund with the price paid for them. Without items
+// and amount, everything not refunded yet is.
+func (r *refundService) refundItems(order models.Order, refund models.CreateRefund) ([]models.RefundItem, error) {
+	orderItems, err := r.orderRepository.GetOrderItems(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	refunded, err := r.repository.GetRefundedQuantities(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Refund everything left when no item or amount is given
+	requested := refund.Items
+	if len(requested) == 0 && refund.Amount == 0 {
+		for _, item := range orderItems {
+			if item.Quantity > refunded[item.ID] {
+				requested = append(requested, models.RefundItem{OrderItemID: item.ID, Quantity: item.Quantity - refunded[item.ID]})
+			}
+		}
+	}
+	// Check the quantities left of every item
+	var items []models.RefundItem
+	for _, request := range requested {
+		var orderItem *models.OrderItem
+		for idx := range orderItems {
+			if orderItems[idx].ID == request.OrderItemID {
+				orderItem = &orderItems[idx]
+				break
+			}
+		}
+		if orderItem == nil {
+			return nil, models.ErrEntityNotFound
+		}
+		if refunded[orderItem.ID]+request.Quantity > orderItem.Quantity {
+			return nil, models.ErrBadRequest
+		}
+		refunded[orderItem.ID] += request.Quantity
+		items = append(items, models.RefundItem{
+			OrderItemID: orderItem.ID,
+			ProductID:   orderItem.ProductID,
+			Size:        orderItem.Size,
+			Quantity:    request.Quantity,
+			Amount:      itemRefundAmount(order, *orderItem, request.Quantity),
+		})
+	}
+	return items, nil
+}
+
+// itemRefundAmount is the price paid for quantity of the item. The coupon and tier
+// discounts are shared between the items in proportion to their price.
+func itemRefundAmount(order models.Order, item models.OrderItem, quantity uint) uint64 {
+	amount := item.ItemDiscountedPrice * uint64(quantity) / uint64(item.Quantity)
+	if discount := order.CouponDiscount + order.TierDiscount; discount > 0 {
+		amount = amount * order.FinalPrice / (order.FinalPrice + discount)
+	}
+	return amount
+}
+
+// allocateRefund splits amount over the payments of the order, from the latest one,
+// or takes it from the given payment. A full refund gives back everything paid.
+func (r *refundService) allocateRefund(order models.Order, transaction_id uint, amount uint64, full bool) ([]models.Refund, error) {
+	payments, err := r.orderRepository.GetOrderPayments(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := r.repository.GetReservedAmounts(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Get what is left to refund of every payment, the latest first
+	var available []models.Refund
+	var total uint64
+	for idx := len(payments) - 1; idx >= 0; idx-- {
+		payment := payments[idx]
+		if transaction_id != 0 && payment.ID != transaction_id {
+			continue
+		}
+		if payment.TransferAmount <= reserved[payment.ID] {
+			continue
+		}
+		available = append(available, models.Refund{
+			OrderID:       order.ID,
+			TransactionID: payment.ID,
+			Provider:      payment.Provider,
+			Amount:        payment.TransferAmount - reserved[payment.ID],
+		})
+		total += payment.TransferAmount - reserved[payment.ID]
+	}
+	if full {
+		amount = total
+	}
+	// Nothing can be refunded beyond what was paid
+	if amount == 0 || amount > total {
+		return nil, models.ErrBadRequest
+	}
+	// Take the amount from the payments in turn
+	var refunds []models.Refund
+	for _, refund := range available {
+		if amount == 0 {
+			break
+		}
+		if refund.Amount > amount {
+			refund.Amount = amount
+		}
+		amount -= refund.Amount
+		refunds = append(refunds, refund)
+	}
+	return refunds, nil
+}
+
+// processRefund sends a pending refund to its provider, the one of its payment unless
+// it goes to the wallet, and records the outcome. Providers that refund by hand leave
+// the refund pending.
+func (r *refundService) processRefund(refund models.Refund) (models.Refund, error) {
+	update := models.Refund{Status: models.RefundStatusFailed}
+	payment, err := r.repository.GetTransaction(refund.TransactionID)
+	if err != nil {
+		return models.Refund{}, err
+	}
+	provider, err := r.paymentService.Provider(refund.Provider)
+	if err == nil {
+		var result models.RefundResult
+		result, err = provider.Refund(payment, refund.Amount)
+		update.Status = result.Status
+		update.Reference = result.Reference
+	}
+	if err != nil {
+		update.Status = models.RefundStatusFailed
+		update.Note = err.Error()
+	}
+	return r.repository.UpdateRefundStatus(refund.ID, models.RefundStatusPending, update)
+}
+
+func (r *refundService) GetRefund(refund_id uint) (models.Refund, error) {
+	return r.repository.GetRefund(refund_id)
+}
+
+func (r *refundService) ListRefunds(order_id uint, status string, limit, offset int) (models.ListRefunds, error) {
+	return r.repository.ListRefunds(order_id, status, limit, offset)
+}
+
+func (r *refundService) RetryRefund(refund_id uint) (models.Refund, error) {
+	// Put the failed refund back to pending, if the payment still covers it
+	refund, err := r.repository.UpdateRefundStatus(refund_id, models.RefundStatusFailed, models.Refund{
+		Status: models.RefundStatusPending,
+	})
+	if err != nil {
+		return models.Refund{}, err
+	}
+	// Send it to the provider again
+	return r.processRefund(refund)
+}
+
+func (r *refundService) CompleteRefund(refund_id uint, update models.UpdateRefund) (models.Refund, error) {
+	// Refunds made by hand are confirmed by finance
+	return r.repository.UpdateRefundStatus(refund_id, models.RefundStatusPending, models.Refund{
+		Status:    models.RefundStatusCompleted,
+		Reference: update.Reference,
+		Note:      update.Note,
+	})
+}
+
+func (r *refundService) FailRefund(refund_id uint, update models.UpdateRefund) (models.Refund, error) {
+	return r.repository.UpdateRefundStatus(refund_id, models.RefundStatusPending, models.Refund{
+		Status:    models.RefundStatusFailed,
+		Reference: update.Reference,
+		Note:      update.Note,
+	})
+}
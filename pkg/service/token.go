@@ -0,0 +1,87 @@
+package service
+
+import (
+	helper "ahava/pkg/helper"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// refreshTokenTTL is how long a login session lasts without being refreshed.
+const refreshTokenTTL = time.Hour * 24 * 30
+
+type TokenService interface {
+	IssueTokens(subject models.TokenSubject, device models.DeviceInfo) (models.TokenPair, error)
+	RefreshTokens(role, refresh_token string, device models.DeviceInfo) (models.TokenPair, error)
+	CheckSession(role string, subject_id uint, session_id string) (bool, error)
+	Logout(role string, subject_id uint, session_id string) error
+	LogoutAll(role string, subject_id uint) error
+}
+
+type tokenService struct {
+	repository repository.TokenRepository
+	helper     helper.Helper
+}
+
+func NewTokenService(repo repository.TokenRepository, h helper.Helper) TokenService {
+	return &tokenService{
+		repository: repo,
+		helper:     h,
+	}
+}
+
+func (t *tokenService) IssueTokens(subject models.TokenSubject, device models.DeviceInfo) (models.TokenPair, error) {
+	// Start a new login session
+	session_id := uuid.NewString()
+	refresh, err := t.helper.GenerateRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := t.repository.CreateRefreshToken(subject, session_id, t.helper.HashToken(refresh), device, time.Now().Add(refreshTokenTTL)); err != nil {
+		return models.TokenPair{}, err
+	}
+	// Generate the access token of the session
+	access, err := t.helper.GenerateAccessToken(subject, session_id)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+	}, nil
+}
+
+func (t *tokenService) RefreshTokens(role, refresh_token string, device models.DeviceInfo) (models.TokenPair, error) {
+	// Replace the refresh token, reusing one ends its session
+	next, err := t.helper.GenerateRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	subject, session_id, err := t.repository.RotateRefreshToken(role, t.helper.HashToken(refresh_token), t.helper.HashToken(next), device, time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	// Generate a new access token for the session
+	access, err := t.helper.GenerateAccessToken(subject, session_id)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: next,
+	}, nil
+}
+
+func (t *tokenService) CheckSession(role string, subject_id uint, session_id string) (bool, error) {
+	return t.repository.CheckSession(role, subject_id, session_id)
+}
+
+func (t *tokenService) Logout(role string, subject_id uint, session_id string) error {
+	return t.repository.RevokeSession(role, subject_id, session_id)
+}
+
+func (t *tokenService) LogoutAll(role string, subject_id uint) error {
+	return t.repository.RevokeAllSessions(role, subject_id)
+}
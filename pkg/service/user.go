@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"log"
 
 	"ahava/pkg/config"
 	helper "ahava/pkg/helper"
@@ -10,8 +11,11 @@ import (
 )
 
 type UserService interface {
-	Register(user models.UserDetails, ref string) (models.TokenUsers, error)
-	Login(user models.UserLogin) (models.TokenUsers, error)
+	Register(user models.UserDetails, ref string, device models.DeviceInfo) (models.TokenUsers, error)
+	Login(user models.UserLogin, device models.DeviceInfo) (models.TokenUsers, error)
+	RefreshTokens(refresh_token string, device models.DeviceInfo) (models.TokenPair, error)
+	Logout(user_id uint, session_id string) error
+	LogoutAll(user_id uint) error
 	AddAddress(user_id uint, address models.Address) (models.Address, error)
 	GetAddresses(user_id uint) ([]models.Address, error)
 	UpdateAddress(user_id, address_id uint, address models.Address) (models.Address, error)
@@ -20,44 +24,56 @@ type UserService interface {
 	GetUserDetails(user_id uint) (models.UserDetailsResponse, error)
 
 	ChangePassword(user_id uint, old string, password string, repassword string) error
-	// ForgotPasswordSend(phone string) error
-	// ForgotPasswordVerifyAndChange(model models.ForgotVerify) error
+	ForgotPasswordSend(contact models.OtpContact) error
+	ForgotPasswordVerifyAndChange(model models.ForgotVerify) error
 
 	EditProfile(user_id uint, profile models.EditProfile) (models.UserDetailsResponse, error)
 
-	// GetMyReferenceLink(id uint) (string, error)
+	GetReferralDashboard(user_id uint, limit, offset int) (models.ReferralDashboard, error)
 }
 
 type userService struct {
 	userRepo repository.UserRepository
 	cfg      config.Config
-	// otpRepository     repository.OtpRepository
 	// productRepository repository.ProductRepository
 	// orderRepository   repository.OrderRepository
-	helper helper.Helper
+	helper        helper.Helper
+	tokenService  TokenService
+	otpService    OtpService
+	verification  VerificationService
+	loginAttempts LoginAttemptService
+	referrals     ReferralService
 }
 
 func NewUserService(repo repository.UserRepository,
 	cfg config.Config,
-	// otp repository.OtpRepository,
 	// inv repository.ProductRepository,
 	// order repository.OrderRepository,
-	h helper.Helper) UserService {
+	h helper.Helper,
+	tokenService TokenService,
+	otpService OtpService,
+	verification VerificationService,
+	loginAttempts LoginAttemptService,
+	referrals ReferralService) UserService {
 
 	return &userService{
 		userRepo: repo,
 		cfg:      cfg,
-		// otpRepository:     otp,
 		// productRepository: inv,
 		// orderRepository:   order,
-		helper: h,
+		helper:        h,
+		tokenService:  tokenService,
+		otpService:    otpService,
+		verification:  verification,
+		loginAttempts: loginAttempts,
+		referrals:     referrals,
 	}
 }
 
 var InternalError = "Internal Server Error"
 var ErrorHashingPassword = "Error In Hashing Password"
 
-func (u *userService) Register(user models.UserDetails, ref string) (models.TokenUsers, error) {
+func (u *userService) Register(user models.UserDetails, ref string, device models.DeviceInfo) (models.TokenUsers, error) {
 
 	userExist := u.userRepo.CheckUserAvailability(user.Email, user.Phone)
 	if userExist {
@@ -66,11 +82,13 @@ func (u *userService) Register(user models.UserDetails, ref string) (models.Toke
 	if user.Password != user.ConfirmPassword {
 		return models.TokenUsers{}, models.ErrBadRequest
 	}
-
-	// referenceUser, err := u.userRepo.FindUserFromReference(ref)
-	// if err != nil {
-	// 	return models.TokenUsers{}, errors.New("cannot find reference user")
-	// }
+	if user.Phone != "" {
+		phone, err := u.helper.NormalizePhone(user.Phone)
+		if err != nil {
+			return models.TokenUsers{}, err
+		}
+		user.Phone = phone
+	}
 
 	// Hash password since details are validated
 
@@ -81,7 +99,7 @@ func (u *userService) Register(user models.UserDetails, ref string) (models.Toke
 
 	user.Password = hashedPassword
 
-	referral, err := u.helper.GenerateRefferalCode()
+	referral, err := u.referrals.GenerateReferralCode()
 	if err != nil {
 		return models.TokenUsers{}, err
 	}
@@ -100,62 +118,114 @@ func (u *userService) Register(user models.UserDetails, ref string) (models.Toke
 		return models.TokenUsers{}, err
 	}
 
-	// crete a JWT token string for the user
-	tokenString, err := u.helper.GenerateTokenClients(userData)
-	if err != nil {
-		return models.TokenUsers{}, err
+	// credit the referral to the customer who shared the link, signing up does not
+	// depend on it
+	if ref != "" {
+		if err := u.referrals.AttributeReferral(ref, userData, device.ClientIP); err != nil {
+			log.Printf("could not attribute the referral %q to user %d: %v", ref, userData.ID, err)
+		}
 	}
 
-	// //credit 20 rupees to the user which is the source of the reference code
-	// if err := u.userRepo.CreditReferencePointsToWallet(referenceUser); err != nil {
-	// 	return models.TokenUsers{}, errors.New("error in crediting gift")
-	// }
+	// send the email verification, the user can ask for it again if it fails
+	if err := u.verification.SendVerification(userData.ID); err != nil {
+		log.Printf("could not send the email verification to user %d: %v", userData.ID, err)
+	}
 
-	//create new wallet for user
-	// if _, err := u.orderRepository.CreateNewWallet(userData.Id); err != nil {
-	// 	return models.TokenUsers{}, errors.New("errror in creating new wallet")
-	// }
+	// start a login session for the user
+	tokens, err := u.tokenService.IssueTokens(models.TokenSubject{
+		ID:    userData.ID,
+		Email: userData.Email,
+		Role:  models.RoleClient,
+	}, device)
+	if err != nil {
+		return models.TokenUsers{}, err
+	}
 
 	return models.TokenUsers{
-		Users: userData,
-		Token: tokenString,
+		Users:        userData,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
-func (u *userService) Login(user models.UserLogin) (models.TokenUsers, error) {
+func (u *userService) Login(user models.UserLogin, device models.DeviceInfo) (models.TokenUsers, error) {
 
-	details, err := u.userRepo.FindUser(user)
-	if err != nil {
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	if account == "" {
+		return models.TokenUsers{}, models.ErrBadRequest
+	}
+	// Refuse the login while the account or the address is locked
+	if err := u.loginAttempts.CheckLogin(models.RoleClient, account, device.ClientIP); err != nil {
 		return models.TokenUsers{}, err
 	}
 
-	err = u.helper.CompareHashAndPassword(details.Password, user.Password)
-	if err != nil {
-		return models.TokenUsers{}, models.ErrInvalidPassword
+	details, err := u.userRepo.FindUser(user)
+	if err != nil && err != models.ErrEntityNotFound {
+		return models.TokenUsers{}, err
+	}
+	// Unknown accounts and wrong passwords get the same answer in the same time
+	found := err == nil
+	password_hash := details.Password
+	if !found {
+		password_hash = string(dummyPasswordHash)
+	}
+	if u.helper.CompareHashAndPassword(password_hash, user.Password) != nil || !found {
+		if err := u.loginAttempts.LoginFailed(models.RoleClient, account, device.ClientIP); err != nil {
+			return models.TokenUsers{}, err
+		}
+		return models.TokenUsers{}, models.ErrInvalidLogin
+	}
+	if err := u.loginAttempts.LoginSucceeded(models.RoleClient, account); err != nil {
+		return models.TokenUsers{}, err
+	}
+	// Only tell about the block to who knows the password
+	if details.IsBlocked {
+		return models.TokenUsers{}, models.ErrForbidden
 	}
 
 	userDetails := models.UserDetailsResponse{
-		ID:        details.ID,
-		Name:      details.Name,
-		Email:     details.Email,
-		Phone:     details.Phone,
-		Username:  details.Username,
-		Gender:    details.Gender,
-		BirthDate: details.BirthDate,
+		ID:            details.ID,
+		Name:          details.Name,
+		Email:         details.Email,
+		Phone:         details.Phone,
+		Username:      details.Username,
+		Gender:        details.Gender,
+		BirthDate:     details.BirthDate,
+		EmailVerified: details.EmailVerified,
 	}
 
-	tokenString, err := u.helper.GenerateTokenClients(userDetails)
+	tokens, err := u.tokenService.IssueTokens(models.TokenSubject{
+		ID:    details.ID,
+		Email: details.Email,
+		Role:  models.RoleClient,
+	}, device)
 	if err != nil {
 		return models.TokenUsers{}, err
 	}
 
 	return models.TokenUsers{
-		Users: userDetails,
-		Token: tokenString,
+		Users:        userDetails,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 
 }
 
+func (u *userService) RefreshTokens(refresh_token string, device models.DeviceInfo) (models.TokenPair, error) {
+	return u.tokenService.RefreshTokens(models.RoleClient, refresh_token, device)
+}
+
+func (u *userService) Logout(user_id uint, session_id string) error {
+	return u.tokenService.Logout(models.RoleClient, user_id, session_id)
+}
+
+func (u *userService) LogoutAll(user_id uint) error {
+	return u.tokenService.LogoutAll(models.RoleClient, user_id)
+}
+
 func (i *userService) AddAddress(user_id uint, address models.Address) (models.Address, error) {
 
 	addAddress, err := i.userRepo.AddAddress(user_id, address)
@@ -236,50 +306,42 @@ func (u *userService) ChangePassword(id uint, old string, password string, repas
 
 }
 
-// func (u *userService) ForgotPasswordSend(phone string) error {
-
-// 	ok := u.otpRepository.FindUserByMobileNumber(phone)
-// 	if !ok {
-// 		return errors.New("the user does not exist")
-// 	}
-
-// 	u.helper.TwilioSetup(u.cfg.ACCOUNTSID, u.cfg.AUTHTOKEN)
-// 	_, err := u.helper.TwilioSendOTP(phone, u.cfg.SERVICESID)
-// 	if err != nil {
-// 		return errors.New("error ocurred while generating OTP")
-// 	}
+func (u *userService) ForgotPasswordSend(contact models.OtpContact) error {
 
-// 	return nil
+	return u.otpService.SendOTP(models.OtpPurposePasswordReset, contact)
 
-// }
+}
 
-// func (u *USERUSECASE) ForgotPasswordVerifyAndChange(model models.ForgotVerify) error {
-// 	u.helper.TwilioSetup(u.cfg.ACCOUNTSID, u.cfg.AUTHTOKEN)
-// 	err := u.helper.TwilioVerifyOTP(u.cfg.SERVICESID, model.Otp, model.Phone)
-// 	if err != nil {
-// 		return errors.New("error while verifying")
-// 	}
+func (u *userService) ForgotPasswordVerifyAndChange(model models.ForgotVerify) error {
 
-// 	id, err := u.userRepo.FindIdFromPhone(model.Phone)
-// 	if err != nil {
-// 		return errors.New("cannot find user from mobile number")
-// 	}
+	user, err := u.otpService.VerifyOTP(models.OtpPurposePasswordReset, model.OtpContact, model.Otp)
+	if err != nil {
+		return err
+	}
 
-// 	newpassword, err := u.helper.PasswordHashing(model.NewPassword)
-// 	if err != nil {
-// 		return errors.New("error in hashing password")
-// 	}
+	newpassword, err := u.helper.PasswordHashing(model.NewPassword)
+	if err != nil {
+		return err
+	}
 
-// 	// if user is authenticated then change the password i the database
-// 	if err := u.userRepo.ChangePassword(id, string(newpassword)); err != nil {
-// 		return errors.New("could not change password")
-// 	}
+	if err := u.userRepo.ChangePassword(user.ID, newpassword); err != nil {
+		return err
+	}
 
-// 	return nil
-// }
+	// log out everywhere, the old password may have been stolen
+	return u.tokenService.LogoutAll(models.RoleClient, user.ID)
+}
 
 func (u *userService) EditProfile(user_id uint, profile models.EditProfile) (models.UserDetailsResponse, error) {
 
+	if profile.Phone != "" {
+		phone, err := u.helper.NormalizePhone(profile.Phone)
+		if err != nil {
+			return models.UserDetailsResponse{}, err
+		}
+		profile.Phone = phone
+	}
+
 	result, err := u.userRepo.EditProfile(user_id, profile)
 	if err != nil {
 		return models.UserDetailsResponse{}, err
@@ -289,17 +351,6 @@ func (u *userService) EditProfile(user_id uint, profile models.EditProfile) (mod
 
 }
 
-// func (u *USERUSECASE) GetMyReferenceLink(id uint) (string, error) {
-
-// 	baseURL := "ahava.com/users/signup"
-
-// 	referralCode, err := u.userRepo.GetReferralCodeFromID(id)
-// 	if err != nil {
-// 		return "", errors.New("error getting ref code")
-// 	}
-
-// 	referralLink := fmt.Sprintf("%s?ref=%s", baseURL, referralCode)
-
-// 	//returning the link
-// 	return referralLink, nil
-// }
+func (u *userService) GetReferralDashboard(user_id uint, limit, offset int) (models.ReferralDashboard, error) {
+	return u.referrals.GetReferralDashboard(user_id, limit, offset)
+}
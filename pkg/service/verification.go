@@ -0,0 +1,122 @@
+package service
+
+import (
+	"ahava/pkg/config"
+	helper "ahava/pkg/helper"
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verifyEmailTTL is how long the code and the link sent to verify an email can be used.
+const verifyEmailTTL = time.Hour * 24
+
+type VerificationService interface {
+	SendVerification(user_id uint) error
+	VerifyEmail(user_id uint, code string) error
+	VerifyEmailLink(token string) error
+}
+
+type verificationService struct {
+	userRepository repository.UserRepository
+	otpRepository  repository.OtpRepository
+	notifier       Notifier
+	helper         helper.Helper
+	cfg            config.Config
+}
+
+func NewVerificationService(
+	userRepo repository.UserRepository,
+	otpRepo repository.OtpRepository,
+	notifier Notifier,
+	h helper.Helper,
+	cfg config.Config,
+) VerificationService {
+	return &verificationService{
+		userRepository: userRepo,
+		otpRepository:  otpRepo,
+		notifier:       notifier,
+		helper:         h,
+		cfg:            cfg,
+	}
+}
+
+func (v *verificationService) SendVerification(user_id uint) error {
+	// Get the user
+	user, err := v.userRepository.GetUserDetails(user_id)
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		return models.ErrEntityNotFound
+	}
+	if user.EmailVerified {
+		return models.ErrConflict
+	}
+	// Limit how often emails are sent
+	if err := checkOtpLimits(v.otpRepository, user.ID, models.OtpPurposeVerifyEmail); err != nil {
+		return err
+	}
+	// Save the code, sending a new one drops the previous one
+	code, err := v.helper.GenerateOTP()
+	if err != nil {
+		return err
+	}
+	if err := v.otpRepository.CreateOtp(user.ID, models.OtpPurposeVerifyEmail, models.NotifyChannelEmail, user.Email, v.helper.HashToken(code), time.Now().Add(verifyEmailTTL)); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Chào %s,\n\nMã xác thực email Ahava của bạn là %s.\n", user.Name, code)
+	// Add a signed link when the API address is known
+	if v.cfg.API_BASE_URL != "" {
+		token, err := v.helper.GenerateVerificationToken(user.ID, user.Email, verifyEmailTTL)
+		if err != nil {
+			return err
+		}
+		link := strings.TrimRight(v.cfg.API_BASE_URL, "/") + "/api/verify-email?token=" + url.QueryEscape(token)
+		body += fmt.Sprintf("Hoặc nhấn vào liên kết sau để xác thực: %s\n", link)
+	}
+	body += fmt.Sprintf("\nMã và liên kết có hiệu lực trong %d giờ.\n", int(verifyEmailTTL.Hours()))
+	// Send the email
+	return v.notifier.Send(models.Notification{
+		Channel: models.NotifyChannelEmail,
+		To:      user.Email,
+		Subject: "Xác thực email tài khoản Ahava",
+		Body:    body,
+	})
+}
+
+func (v *verificationService) VerifyEmail(user_id uint, code string) error {
+	// Get the user
+	user, err := v.userRepository.GetUserDetails(user_id)
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		return models.ErrEntityNotFound
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	// Check the code
+	if err := v.otpRepository.VerifyOtp(user.ID, models.OtpPurposeVerifyEmail, v.helper.HashToken(code), otpMaxAttempts); err != nil {
+		return err
+	}
+	return v.userRepository.SetEmailVerified(user.ID, user.Email)
+}
+
+func (v *verificationService) VerifyEmailLink(token string) error {
+	// Check the signature and the expiry of the link
+	claims, err := v.helper.ValidateToken(token, models.RoleClient, models.TokenTypeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	// The link only verifies the email it was sent to
+	err = v.userRepository.SetEmailVerified(claims.ID, claims.Email)
+	if err == models.ErrEntityNotFound {
+		return models.ErrInvalidToken
+	}
+	return err
+}
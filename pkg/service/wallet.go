@@ -0,0 +1,35 @@
+package service
+
+import (
+	repository "ahava/pkg/repository"
+	"ahava/pkg/utils/models"
+	"strings"
+)
+
+type WalletService interface {
+	GetWallet(user_id uint, limit, offset int) (models.Wallet, error)
+	AdjustWallet(user_id, admin_id uint, adjustment models.WalletAdjustment) (models.WalletEntry, error)
+}
+
+type walletService struct {
+	repository repository.WalletRepository
+}
+
+func NewWalletService(repo repository.WalletRepository) WalletService {
+	return &walletService{
+		repository: repo,
+	}
+}
+
+func (w *walletService) GetWallet(user_id uint, limit, offset int) (models.Wallet, error) {
+	return w.repository.GetWallet(user_id, limit, offset)
+}
+
+func (w *walletService) AdjustWallet(user_id, admin_id uint, adjustment models.WalletAdjustment) (models.WalletEntry, error) {
+	// Every adjustment must say why it was made
+	adjustment.Reason = strings.TrimSpace(adjustment.Reason)
+	if adjustment.Amount == 0 || adjustment.Reason == "" {
+		return models.WalletEntry{}, models.ErrBadRequest
+	}
+	return w.repository.AdjustWallet(user_id, admin_id, adjustment)
+}
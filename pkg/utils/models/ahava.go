@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -12,21 +13,257 @@ type AdminLogin struct {
 	Password string `json:"password" validate:"min=8,max=20"`
 }
 
+const (
+	RoleAdmin  = "admin"
+	RoleClient = "client"
+)
+
+// Refresh tokens are opaque and stored server side, only access tokens and email
+// verification links are signed.
+const (
+	TokenTypeAccess      = "access"
+	TokenTypeVerifyEmail = "verify_email"
+)
+
+// Roles of the back-office staff
+const (
+	AdminRoleOwner         = "OWNER"
+	AdminRoleCatalogEditor = "CATALOG_EDITOR"
+	AdminRoleOrderOperator = "ORDER_OPERATOR"
+	AdminRoleContentWriter = "CONTENT_WRITER"
+	AdminRoleFinance       = "FINANCE"
+)
+
+// Permissions checked on the admin routes
+const (
+	PermissionManageStaff   = "MANAGE_STAFF"
+	PermissionManageUsers   = "MANAGE_USERS"
+	PermissionManageCatalog = "MANAGE_CATALOG"
+	PermissionViewOrders    = "VIEW_ORDERS"
+	PermissionManageOrders  = "MANAGE_ORDERS"
+	PermissionManageContent = "MANAGE_CONTENT"
+	PermissionManageFinance = "MANAGE_FINANCE"
+	PermissionUploadFiles   = "UPLOAD_FILES"
+)
+
+// RolePermissions lists what each staff role is allowed to do. Owners can do everything.
+var RolePermissions = map[string][]string{
+	AdminRoleOwner: {
+		PermissionManageStaff, PermissionManageUsers, PermissionManageCatalog, PermissionViewOrders,
+		PermissionManageOrders, PermissionManageContent, PermissionManageFinance, PermissionUploadFiles,
+	},
+	AdminRoleCatalogEditor: {PermissionManageCatalog, PermissionUploadFiles},
+	AdminRoleOrderOperator: {PermissionViewOrders, PermissionManageOrders},
+	AdminRoleContentWriter: {PermissionManageContent, PermissionUploadFiles},
+	AdminRoleFinance:       {PermissionViewOrders, PermissionManageFinance},
+}
+
+// HasPermission tells whether the staff role is allowed the permission.
+func HasPermission(role, permission string) bool {
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenSubject is who a token is issued to. Staff tokens also carry the staff role and
+// whether the password has to be changed before anything else.
+type TokenSubject struct {
+	ID                 uint
+	Email              string
+	Role               string
+	StaffRole          string
+	MustChangePassword bool
+}
+
+type DeviceInfo struct {
+	UserAgent string
+	ClientIP  string
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+const (
+	OtpPurposeLogin         = "LOGIN"
+	OtpPurposePasswordReset = "PASSWORD_RESET"
+	OtpPurposeVerifyEmail   = "VERIFY_EMAIL"
+)
+
+const (
+	NotifyChannelEmail = "EMAIL"
+	NotifyChannelSMS   = "SMS"
+)
+
+// Notification is a message sent to a customer by email or SMS.
+type Notification struct {
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// OtpContact is the phone or the email an OTP is sent to.
+type OtpContact struct {
+	Phone string `json:"phone" validate:"required_without=Email"`
+	Email string `json:"email" validate:"required_without=Phone"`
+}
+
+type VerifyEmail struct {
+	Otp string `json:"otp" validate:"required,len=6,numeric"`
+}
+
+type VerifyOTP struct {
+	OtpContact
+	Otp string `json:"otp" validate:"required,len=6,numeric"`
+}
+
+type ForgotVerify struct {
+	OtpContact
+	Otp             string `json:"otp" validate:"required,len=6,numeric"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=20"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=NewPassword"`
+}
+
 type AdminDetailsResponse struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name" `
-	Email string `json:"email" `
+	ID                 uint   `json:"id"`
+	Name               string `json:"name" `
+	Email              string `json:"email" `
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+type CreateStaff struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=20"`
+	Role     string `json:"role" validate:"required,oneof=OWNER CATALOG_EDITOR ORDER_OPERATOR CONTENT_WRITER FINANCE"`
+}
+
+type UpdateStaff struct {
+	Name string `json:"name"`
+	Role string `json:"role" validate:"omitempty,oneof=OWNER CATALOG_EDITOR ORDER_OPERATOR CONTENT_WRITER FINANCE"`
+}
+
+type ResetStaffPassword struct {
+	Password string `json:"password" validate:"required,min=8,max=20"`
+}
+
+type AdminChangePassword struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	Password    string `json:"password" validate:"required,min=8,max=20"`
+	RePassword  string `json:"re_password" validate:"required,eqfield=Password"`
+}
+
+type ListStaff struct {
+	Total  int64                  `json:"total"`
+	Limit  int                    `json:"limit"`
+	Offset int                    `json:"offset"`
+	Staff  []AdminDetailsResponse `json:"staff"`
+}
+
+// Login attempts are tracked per account and per client address.
+const (
+	LoginScopeAccount = "ACCOUNT"
+	LoginScopeIP      = "IP"
+)
+
+type LoginLockout struct {
+	ID            uint      `json:"id"`
+	Role          string    `json:"role"`
+	Scope         string    `json:"scope"`
+	Identifier    string    `json:"identifier"`
+	Failures      uint      `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+type ListLoginLockouts struct {
+	Total    int64          `json:"total"`
+	Limit    int            `json:"limit"`
+	Offset   int            `json:"offset"`
+	Lockouts []LoginLockout `json:"lockouts"`
 }
 
 type Category struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name" validate:"required"`
-	Description string `json:"description" validate:"required"`
+	ID       uint   `json:"id"`
+	ParentID *uint  `json:"parent_id"`
+	Name     string `json:"name" validate:"required"`
+	// Slug is made from the name when empty.
+	Slug            string `json:"slug"`
+	Description     string `json:"description"`
+	Image           string `json:"image"`
+	DisplayOrder    int    `json:"display_order"`
+	IsHidden        bool   `json:"is_hidden"`
+	MetaTitle       string `json:"meta_title"`
+	MetaDescription string `json:"meta_description"`
+	MetaKeywords    string `json:"meta_keywords"`
+	// ProductCount counts the products of the category, and in the tree those of
+	// the categories below it too.
+	ProductCount int64 `json:"product_count"`
 }
 
+// UpdateCategory replaces every field of a category.
 type UpdateCategory struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	ParentID        *uint  `json:"parent_id"`
+	Name            string `json:"name" validate:"required"`
+	Slug            string `json:"slug"`
+	Description     string `json:"description"`
+	Image           string `json:"image"`
+	DisplayOrder    int    `json:"display_order"`
+	IsHidden        bool   `json:"is_hidden"`
+	MetaTitle       string `json:"meta_title"`
+	MetaDescription string `json:"meta_description"`
+	MetaKeywords    string `json:"meta_keywords"`
+}
+
+type CategoryTree struct {
+	Category
+	Children []CategoryTree `json:"children"`
+}
+
+// vietnameseLetters folds the Vietnamese letters to their plain form.
+var vietnameseLetters = strings.NewReplacer(
+	"à", "a", "á", "a", "ả", "a", "ã", "a", "ạ", "a",
+	"ă", "a", "ằ", "a", "ắ", "a", "ẳ", "a", "ẵ", "a", "ặ", "a",
+	"â", "a", "ầ", "a", "ấ", "a", "ẩ", "a", "ẫ", "a", "ậ", "a",
+	"è", "e", "é", "e", "ẻ", "e", "ẽ", "e", "ẹ", "e",
+	"ê", "e", "ề", "e", "ế", "e", "ể", "e", "ễ", "e", "ệ", "e",
+	"ì", "i", "í", "i", "ỉ", "i", "ĩ", "i", "ị", "i",
+	"ò", "o", "ó", "o", "ỏ", "o", "õ", "o", "ọ", "o",
+	"ô", "o", "ồ", "o", "ố", "o", "ổ", "o", "ỗ", "o", "ộ", "o",
+	"ơ", "o", "ờ", "o", "ớ", "o", "ở", "o", "ỡ", "o", "ợ", "o",
+	"ù", "u", "ú", "u", "ủ", "u", "ũ", "u", "ụ", "u",
+	"ư", "u", "ừ", "u", "ứ", "u", "ử", "u", "ữ", "u", "ự", "u",
+	"ỳ", "y", "ý", "y", "ỷ", "y", "ỹ", "y", "ỵ", "y",
+	"đ", "d",
+)
+
+// Slugify turns a name into the lowercase, dash separated form used in links,
+// "Sữa rửa mặt" gives "sua-rua-mat".
+func Slugify(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range vietnameseLetters.Replace(strings.ToLower(name)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return slug.String()
 }
 
 type ListProducts struct {
@@ -37,21 +274,58 @@ type ListProducts struct {
 }
 
 type Price struct {
-	ID            uint   `json:"id"`
-	Size          string `json:"size"`
-	Image         string `json:"image"`
-	OriginalPrice uint64 `json:"original_price" gorm:"default:1"`
-	DiscountPrice uint64 `json:"discount_price"`
+	ID                uint   `json:"id"`
+	Size              string `json:"size"`
+	Image             string `json:"image"`
+	OriginalPrice     uint64 `json:"original_price" gorm:"default:1"`
+	DiscountPrice     uint64 `json:"discount_price"`
+	BaseDiscountPrice uint64 `json:"base_discount_price"`
+	Stock             uint   `json:"stock"`
+	OutOfStock        bool   `json:"out_of_stock" gorm:"-"`
+}
+
+const (
+	StockMovementInitial    = "INITIAL"
+	StockMovementAdjustment = "ADJUSTMENT"
+	StockMovementOrder      = "ORDER"
+	StockMovementCancel     = "CANCEL"
+	StockMovementReturn     = "RETURN"
+)
+
+type AdjustStock struct {
+	Change int    `json:"change" validate:"required"`
+	Note   string `json:"note" validate:"required"`
+}
+
+type StockMovement struct {
+	ID         uint      `json:"id"`
+	PriceID    uint      `json:"price_id"`
+	ProductID  uint      `json:"product_id"`
+	Size       string    `json:"size"`
+	Change     int       `json:"change"`
+	StockAfter uint      `json:"stock_after"`
+	Type       string    `json:"type"`
+	OrderID    uint      `json:"order_id"`
+	AdminID    uint      `json:"admin_id"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ListStockMovements struct {
+	Total     int64           `json:"total"`
+	Limit     int             `json:"limit"`
+	Offset    int             `json:"offset"`
+	Movements []StockMovement `json:"movements"`
 }
 
 type Product struct {
 	ID               uint           `json:"id"`
+	CategoryID       *uint          `json:"category_id"`
 	Category         string         `json:"category"`
 	Name             string         `json:"name"`
 	Code             string         `json:"code"`
 	DefaultImage     string         `json:"default_image"`
 	Images           pq.StringArray `json:"images"`
-	Stock            uint           `json:"stock"`
 	Type             string         `json:"type"`
 	Tag              string         `json:"tag"`
 	Price            []Price        `json:"price"`
@@ -59,6 +333,54 @@ type Product struct {
 	Description      string         `json:"description"`
 	HowToUse         string         `json:"how_to_use"`
 	IsFeatured       bool           `json:"is_featured"`
+	OutOfStock       bool           `json:"out_of_stock" gorm:"-"`
+}
+
+const (
+	ProductSortNewest      = "newest"
+	ProductSortPriceAsc    = "price_asc"
+	ProductSortPriceDesc   = "price_desc"
+	ProductSortBestSelling = "best_selling"
+	ProductSortFeatured    = "featured"
+)
+
+// ProductQuery filters the storefront catalog. The filters of different fields are
+// combined, the values given for one field match any of them.
+type ProductQuery struct {
+	Category string   `form:"category"`
+	Types    []string `form:"type"`
+	Tags     []string `form:"tag"`
+	Sizes    []string `form:"size"`
+	MinPrice *uint64  `form:"min_price"`
+	MaxPrice *uint64  `form:"max_price"`
+	InStock  bool     `form:"in_stock"`
+	Sort     string   `form:"sort" validate:"omitempty,oneof=newest price_asc price_desc best_selling featured"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceBucket struct {
+	Min uint64 `json:"min"`
+	// Max is excluded from the bucket, the last bucket has none.
+	Max   *uint64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+type ProductFacets struct {
+	Types  []FacetCount  `json:"types"`
+	Tags   []FacetCount  `json:"tags"`
+	Prices []PriceBucket `json:"prices"`
+}
+
+type CatalogProducts struct {
+	Total    int64         `json:"total"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+	Products []Product     `json:"products"`
+	Facets   ProductFacets `json:"facets"`
 }
 
 type WishlistProduct struct {
@@ -89,13 +411,14 @@ type UserSignInResponse struct {
 }
 
 type UserDetailsResponse struct {
-	ID        uint      `json:"id"`
-	Username  string    `json:"username"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone"`
-	Gender    string    `json:"gender"`
-	BirthDate time.Time `json:"birth_date"`
+	ID            uint      `json:"id"`
+	Username      string    `json:"username"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	Phone         string    `json:"phone"`
+	Gender        string    `json:"gender"`
+	BirthDate     time.Time `json:"birth_date"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 type UserLogin struct {
@@ -105,14 +428,15 @@ type UserLogin struct {
 }
 
 type TokenUsers struct {
-	Users UserDetailsResponse
-	Token string
+	Users        UserDetailsResponse
+	Token        string
+	RefreshToken string
 }
 
 type UserDetails struct {
 	Name            string    `json:"name"`
 	Username        string    `json:"username"`
-	Email           string    `json:"email" validate:"email"`
+	Email           string    `json:"email" validate:"required,email"`
 	Gender          string    `json:"gender"`
 	Phone           string    `json:"phone"`
 	Password        string    `json:"password"`
@@ -138,10 +462,166 @@ type ListUsers struct {
 	Users  []UserDetailsAtAdmin `json:"users"`
 }
 
+const (
+	ReferralStatusPending  = "PENDING"
+	ReferralStatusRewarded = "REWARDED"
+	ReferralStatusRejected = "REJECTED"
+)
+
+type Referral struct {
+	ID           uint       `json:"id"`
+	ReferrerID   uint       `json:"referrer_id"`
+	ReferrerName string     `json:"referrer_name"`
+	RefereeID    uint       `json:"referee_id"`
+	RefereeName  string     `json:"referee_name"`
+	Status       string     `json:"status"`
+	RewardAmount uint64     `json:"reward_amount"`
+	OrderID      *uint      `json:"order_id"`
+	Note         string     `json:"note"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RewardedAt   *time.Time `json:"rewarded_at"`
+}
+
+type ReferralStats struct {
+	Total       int64  `json:"total"`
+	Pending     int64  `json:"pending"`
+	Rewarded    int64  `json:"rewarded"`
+	Rejected    int64  `json:"rejected"`
+	TotalReward uint64 `json:"total_reward"`
+}
+
+type ListReferrals struct {
+	Stats     ReferralStats `json:"stats"`
+	Total     int64         `json:"total"`
+	Limit     int           `json:"limit"`
+	Offset    int           `json:"offset"`
+	Referrals []Referral    `json:"referrals"`
+}
+
+type ReferralDashboard struct {
+	Code string `json:"code"`
+	Link string `json:"link"`
+	ListReferrals
+}
+
+const (
+	WalletEntryRefund       = "REFUND"
+	WalletEntryReferral     = "REFERRAL"
+	WalletEntryOrderPayment = "ORDER_PAYMENT"
+	WalletEntryAdjustment   = "ADJUSTMENT"
+	WalletEntryLoyalty      = "LOYALTY"
+)
+
+type WalletEntry struct {
+	ID           uint      `json:"id"`
+	Type         string    `json:"type"`
+	Amount       int64     `json:"amount"`
+	BalanceAfter uint64    `json:"balance_after"`
+	OrderID      *uint     `json:"order_id"`
+	RefundID     *uint     `json:"refund_id"`
+	ReferralID   *uint     `json:"referral_id"`
+	AdminID      *uint     `json:"admin_id"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Wallet struct {
+	UserID  uint          `json:"user_id"`
+	Balance uint64        `json:"balance"`
+	Total   int64         `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	Entries []WalletEntry `json:"entries"`
+}
+
+type WalletAdjustment struct {
+	Amount int64  `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required"`
+}
+
+const (
+	LoyaltyEntryEarn   = "EARN"
+	LoyaltyEntryRedeem = "REDEEM"
+	LoyaltyEntryExpire = "EXPIRE"
+	LoyaltyEntryRevoke = "REVOKE"
+)
+
+const (
+	// LoyaltyEarnUnit is how much of the price of a delivered order earns one point.
+	LoyaltyEarnUnit = 1000
+	// LoyaltyPointValue is the store credit one point is redeemed for.
+	LoyaltyPointValue = 10
+	// LoyaltyPointsLifetime is how long earned points can be redeemed.
+	LoyaltyPointsLifetime = 365 * 24 * time.Hour
+)
+
+const (
+	LoyaltyTierMember   = "MEMBER"
+	LoyaltyTierSilver   = "SILVER"
+	LoyaltyTierGold     = "GOLD"
+	LoyaltyTierPlatinum = "PLATINUM"
+)
+
+type LoyaltyTier struct {
+	Name            string `json:"name"`
+	MinSpend        uint64 `json:"min_spend"`
+	DiscountPercent uint64 `json:"discount_percent"`
+}
+
+type LoyaltyEntry struct {
+	ID          uint       `json:"id"`
+	Type        string     `json:"type"`
+	Points      int64      `json:"points"`
+	PointsAfter uint64     `json:"points_after"`
+	Remaining   uint64     `json:"remaining"`
+	OrderID     *uint      `json:"order_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type LoyaltyPoints struct {
+	Points  uint64         `json:"points"`
+	Total   int64          `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Entries []LoyaltyEntry `json:"entries"`
+}
+
+type Loyalty struct {
+	Tier     LoyaltyTier  `json:"tier"`
+	NextTier *LoyaltyTier `json:"next_tier"`
+	// YearSpend is what the delivered orders of the last 12 months cost, it sets the tier.
+	YearSpend      uint64 `json:"year_spend"`
+	PointsValue    uint64 `json:"points_value"`
+	ExpiringPoints uint64 `json:"expiring_points"`
+	LoyaltyPoints
+}
+
+type RedeemPoints struct {
+	Points uint64 `json:"points" validate:"required,min=1"`
+}
+
 type Search struct {
 	Key string `json:"searchkey" validate:"required"`
 }
 
+type SearchResult struct {
+	Product
+	Rank float64 `json:"rank"`
+	// HighlightedName and Snippet mark the matched words with <mark></mark>.
+	HighlightedName string `json:"highlighted_name"`
+	Snippet         string `json:"snippet"`
+}
+
+type SearchProducts struct {
+	Key      string         `json:"key"`
+	Total    int64          `json:"total"`
+	Limit    int            `json:"limit"`
+	Offset   int            `json:"offset"`
+	Products []SearchResult `json:"products"`
+}
+
 type EditProfile struct {
 	Name      string    `json:"name"`
 	Phone     string    `json:"phone"`
@@ -160,6 +640,7 @@ type CartItem struct {
 	DiscountPrice     uint64 `json:"discount_price"`
 	ItemPrice         uint64 `json:"item_price"`
 	ItemDiscountPrice uint64 `json:"item_discount_price"`
+	Stock             uint   `json:"stock"`
 }
 
 type UpdateCartItem struct {
@@ -179,20 +660,81 @@ type CartDetails struct {
 }
 
 type SearchHistory struct {
-	ID        uint      `json:"id"`
-	UserID    uint      `json:"user_id"`
-	SearchKey string    `json:"search_key"`
-	CreateAt  time.Time `json:"created_at"`
+	ID            uint      `json:"id"`
+	UserID        uint      `json:"user_id"`
+	SearchKey     string    `json:"search_key"`
+	NormalizedKey string    `json:"-"`
+	ResultCount   int64     `json:"result_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type TrendingSearch struct {
+	SearchKey string `json:"search_key"`
+	Searches  int64  `json:"searches"`
+}
+
+type ProductSuggestion struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	Category     string `json:"category"`
+	DefaultImage string `json:"default_image"`
+}
+
+type CategorySuggestion struct {
+	ID       uint   `json:"id"`
+	ParentID *uint  `json:"parent_id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+}
+
+type SearchSuggestions struct {
+	Products   []ProductSuggestion  `json:"products"`
+	Categories []CategorySuggestion `json:"categories"`
 }
 
 type CartCheckout struct {
 	CartIDs []uint `json:"cart_ids"`
+	Coupon  string `json:"coupon"`
 }
 
 type CheckOut struct {
 	CartItems            []CartItem `json:"cart_items"`
 	TotalPrice           uint64     `json:"total_price"`
 	TotalDiscountedPrice uint64     `json:"total_discounted_price"`
+	CouponID             uint       `json:"-"`
+	Coupon               string     `json:"coupon"`
+	CouponDiscount       uint64     `json:"coupon_discount"`
+	Tier                 string     `json:"tier"`
+	TierDiscount         uint64     `json:"tier_discount"`
+	FinalPrice           uint64     `json:"final_price"`
+}
+
+const (
+	CouponTypePercentage = "PERCENTAGE"
+	CouponTypeFixed      = "FIXED"
+)
+
+type Coupon struct {
+	ID                uint      `json:"id"`
+	Coupon            string    `json:"coupon" validate:"required"`
+	Type              string    `json:"type" validate:"required,oneof=PERCENTAGE FIXED"`
+	DiscountRate      int       `json:"discount_rate" validate:"min=0,max=100"`
+	DiscountAmount    uint64    `json:"discount_amount"`
+	MaxDiscount       uint64    `json:"max_discount"`
+	MinOrderValue     uint64    `json:"min_order_value"`
+	StartAt           time.Time `json:"start_at"`
+	ExpireAt          time.Time `json:"expire_at"`
+	UsageLimit        uint      `json:"usage_limit"`
+	UsageLimitPerUser uint      `json:"usage_limit_per_user"`
+	UsedCount         uint      `json:"used_count"`
+	Valid             bool      `json:"valid"`
+}
+
+type ListCoupons struct {
+	Total   int64    `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+	Coupons []Coupon `json:"coupons"`
 }
 
 type Address struct {
@@ -232,20 +774,25 @@ type ListOrders struct {
 
 type OrderDetails struct {
 	Order
-	Details []OrderItem `json:"details"`
+	Details  []OrderItem   `json:"details"`
+	Payments []Transaction `json:"payments,omitempty"`
 }
 
 type Order struct {
-	ID            uint   `json:"id"`
-	UserID        uint   `json:"user_id"`
-	Name          string `json:"name"`
-	Phone         string `json:"phone"`
-	Address       string `json:"address"`
-	PaymentMethod string `json:"payment_method"`
-	FinalPrice    uint64 `json:"final_price"`
-	Coupon        string `json:"coupon"`
-	OrderStatus   string `json:"order_status"`
-	PaymentStatus string `json:"payment_status"`
+	ID             uint   `json:"id"`
+	UserID         uint   `json:"user_id"`
+	Name           string `json:"name"`
+	Phone          string `json:"phone"`
+	Address        string `json:"address"`
+	PaymentMethod  string `json:"payment_method"`
+	FinalPrice     uint64 `json:"final_price"`
+	Coupon         string `json:"coupon"`
+	CouponDiscount uint64 `json:"coupon_discount"`
+	TierDiscount   uint64 `json:"tier_discount"`
+	PaidAmount     uint64 `json:"paid_amount"`
+	RefundedAmount uint64 `json:"refunded_amount"`
+	OrderStatus    string `json:"order_status"`
+	PaymentStatus  string `json:"payment_status"`
 }
 
 type PlaceOrder struct {
@@ -256,9 +803,14 @@ type PlaceOrder struct {
 	PaymentMethod string `json:"payment_method"`
 	CartIDs       []uint `json:"cart_ids"`
 	Coupon        string `json:"coupon"`
+	// UseWallet pays WalletAmount of the order with store credit, or as much as the
+	// balance covers when WalletAmount is 0.
+	UseWallet    bool   `json:"use_wallet"`
+	WalletAmount uint64 `json:"wallet_amount"`
 }
 
 type OrderItem struct {
+	ID                  uint   `json:"id"`
 	OrderID             uint   `json:"order_id"`
 	ProductID           uint   `json:"product_id"`
 	Size                string `json:"size"`
@@ -269,35 +821,238 @@ type OrderItem struct {
 	ItemDiscountedPrice uint64 `json:"item_discount_price"`
 }
 
-type CreateQR struct {
-	OrderID       uint   `json:"order_id" validate:"required"`
-	AccountNumber string `json:"account_number"`
-	BankName      string `json:"bank_name"`
-	Amount        uint64 `json:"amount" validate:"required"`
-	Description   string `json:"description"`
-	Link          string `json:"link"`
+const (
+	OrderStatusUnconfirmed = "UNCONFIRMED"
+	OrderStatusPreparing   = "PREPARING"
+	OrderStatusShipping    = "SHIPPING"
+	OrderStatusDelivered   = "DELIVERED"
+	OrderStatusCanceled    = "CANCELED"
+	OrderStatusReturned    = "RETURNED"
+)
+
+const (
+	PaymentStatusNotPaid    = "NOT PAID"
+	PaymentStatusIncomplete = "INCOMPLETE"
+	PaymentStatusPaid       = "PAID"
+	PaymentStatusOverpaid   = "OVERPAID"
+	PaymentStatusRefunded   = "REFUNDED"
+)
+
+const (
+	ChangedByAdmin  = "ADMIN"
+	ChangedByUser   = "USER"
+	ChangedBySystem = "SYSTEM"
+)
+
+type UpdateOrderStatus struct {
+	OrderStatus string `json:"order_status" validate:"required,oneof=UNCONFIRMED PREPARING SHIPPING DELIVERED CANCELED RETURNED"`
+	Note        string `json:"note"`
+}
+
+type OrderStatusHistory struct {
+	ID            uint      `json:"id"`
+	OrderID       uint      `json:"order_id"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	ChangedBy     uint      `json:"changed_by"`
+	ChangedByRole string    `json:"changed_by_role"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const (
+	ReturnStatusPending  = "PENDING"
+	ReturnStatusApproved = "APPROVED"
+	ReturnStatusRejected = "REJECTED"
+)
+
+type RequestReturn struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type ReviewReturnRequest struct {
+	Note string `json:"note"`
+}
+
+type ReturnRequest struct {
+	ID         uint       `json:"id"`
+	OrderID    uint       `json:"order_id"`
+	UserID     uint       `json:"user_id"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	AdminNote  string     `json:"admin_note"`
+	ReviewedBy uint       `json:"reviewed_by"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ListReturnRequests struct {
+	Total          int64           `json:"total"`
+	Limit          int             `json:"limit"`
+	Offset         int             `json:"offset"`
+	ReturnRequests []ReturnRequest `json:"return_requests"`
+}
+
+const (
+	PaymentMethodSePay = "SEPAY"
+	PaymentMethodCOD   = "COD"
+	// PaymentMethodWallet pays with store credit, it is used next to another method.
+	PaymentMethodWallet = "WALLET"
+)
+
+type PaymentMethod struct {
+	ID          uint   `json:"id"`
+	PaymentName string `json:"payment_name" validate:"required"`
+	Enable      bool   `json:"enable"`
+}
+
+type UpdatePaymentMethod struct {
+	Enable bool `json:"enable"`
+}
+
+// PaymentIntent is what a customer needs to pay an order with its payment method:
+// a QR code for bank transfers, a redirect URL for payment gateways, or nothing for COD.
+type PaymentIntent struct {
+	OrderID       uint      `json:"order_id" validate:"required"`
+	PaymentMethod string    `json:"payment_method"`
+	AccountNumber string    `json:"account_number,omitempty"`
+	BankName      string    `json:"bank_name,omitempty"`
+	Amount        uint64    `json:"amount"`
+	Description   string    `json:"description,omitempty"`
+	Link          string    `json:"link,omitempty"`
+	ExpireAt      time.Time `json:"expire_at"`
+}
+
+type PaymentStatus struct {
+	PaymentMethod string `json:"payment_method"`
+	Status        string `json:"status"`
+	PaidAmount    uint64 `json:"paid_amount"`
+}
+
+type CallbackResult struct {
+	ReferenceCode string
+	Status        string
+}
+
+const (
+	RefundStatusPending   = "PENDING"
+	RefundStatusCompleted = "COMPLETED"
+	RefundStatusFailed    = "FAILED"
+)
+
+type RefundResult struct {
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+}
+
+type RefundItem struct {
+	OrderItemID uint   `json:"order_item_id" validate:"required"`
+	ProductID   uint   `json:"product_id"`
+	Size        string `json:"size"`
+	Quantity    uint   `json:"quantity" validate:"required,min=1"`
+	Amount      uint64 `json:"amount"`
+	Restocked   bool   `json:"restocked"`
+}
+
+// CreateRefund refunds the whole order when neither items nor amount are given.
+// Items are refunded at the price paid for them unless an amount is given.
+type CreateRefund struct {
+	TransactionID uint         `json:"transaction_id"`
+	Amount        uint64       `json:"amount"`
+	Reason        string       `json:"reason" validate:"required"`
+	Items         []RefundItem `json:"items" validate:"dive"`
+	SkipRestock   bool         `json:"skip_restock"`
+	// ToWallet gives the amount back as store credit instead of through the payment.
+	ToWallet bool `json:"to_wallet"`
+}
+
+type UpdateRefund struct {
+	Reference string `json:"reference"`
+	Note      string `json:"note"`
+}
+
+type Refund struct {
+	ID            uint         `json:"id"`
+	OrderID       uint         `json:"order_id"`
+	TransactionID uint         `json:"transaction_id"`
+	Provider      string       `json:"provider"`
+	Amount        uint64       `json:"amount"`
+	Reason        string       `json:"reason"`
+	Status        string       `json:"status"`
+	Reference     string       `json:"reference"`
+	Note          string       `json:"note"`
+	CreatedBy     uint         `json:"created_by"`
+	CompletedAt   *time.Time   `json:"completed_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Items         []RefundItem `json:"items" gorm:"-"`
+}
+
+type ListRefunds struct {
+	Total   int64    `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+	Refunds []Refund `json:"refunds"`
 }
 
 type Transaction struct {
-	ID              uint   `json:"id"`
-	UserID          uint   `json:"user_id"`
-	OrderID         uint   `json:"order_id"`
-	Gateway         string `json:"gateway"`
-	TransactionDate string `json:"transactionDate"`
-	AccountNumber   string `json:"accountNumber"`
-	Code            string `json:"code"`
-	Content         string `json:"content"`
-	TransferType    string `json:"transferType"`
-	TransferAmount  uint64 `json:"transferAmount"`
-	Accumulated     uint64 `json:"accumulated"`
-	ReferenceCode   string `json:"referenceCode"`
-	Description     string `json:"description"`
+	ID              uint      `json:"id"`
+	UserID          uint      `json:"user_id"`
+	OrderID         uint      `json:"order_id"`
+	Gateway         string    `json:"gateway"`
+	TransactionDate string    `json:"transactionDate"`
+	AccountNumber   string    `json:"accountNumber"`
+	Code            string    `json:"code"`
+	Content         string    `json:"content"`
+	TransferType    string    `json:"transferType"`
+	TransferAmount  uint64    `json:"transferAmount"`
+	Accumulated     uint64    `json:"accumulated"`
+	ReferenceCode   string    `json:"referenceCode"`
+	Description     string    `json:"description"`
+	Provider        string    `json:"provider"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
+const (
+	WebhookEventReceived  = "RECEIVED"
+	WebhookEventProcessed = "PROCESSED"
+	WebhookEventDuplicate = "DUPLICATE"
+	WebhookEventIgnored   = "IGNORED"
+	WebhookEventRejected  = "REJECTED"
+	WebhookEventFailed    = "FAILED"
+)
+
+type WebhookRequest struct {
+	Authorization string
+	Signature     string
+	ClientIP      string
+	Payload       []byte
+}
+
+const (
+	OfferScopeProduct  = "PRODUCT"
+	OfferScopeCategory = "CATEGORY"
+	OfferScopeSize     = "SIZE"
+)
+
 type Offer struct {
-	ProductID uint      `json:"product_id"`
-	OfferRate uint      `json:"offer_rate"`
-	ExpireAt  time.Time `json:"expire_at"`
+	ID         uint      `json:"id"`
+	Name       string    `json:"name" validate:"required"`
+	Scope      string    `json:"scope" validate:"required,oneof=PRODUCT CATEGORY SIZE"`
+	ProductID  uint      `json:"product_id"`
+	CategoryID *uint     `json:"category_id"`
+	Category   string    `json:"category"`
+	Size       string    `json:"size"`
+	OfferRate  uint      `json:"offer_rate" validate:"required,min=1,max=100"`
+	StartAt    time.Time `json:"start_at" validate:"required"`
+	ExpireAt   time.Time `json:"expire_at" validate:"required"`
+	Valid      bool      `json:"valid"`
+}
+
+type ListOffers struct {
+	Total  int64   `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+	Offers []Offer `json:"offers"`
 }
 
 type News struct {
@@ -323,16 +1078,27 @@ type ListNews struct {
 }
 
 var (
-	ErrEntityNotFound  = errors.New("entity not found")
-	ErrInternalServer  = errors.New("internal server error")
-	ErrBadRequest      = errors.New("bad request")
-	ErrUnauthorized    = errors.New("unauthorized")
-	ErrForbidden       = errors.New("forbidden")
-	ErrConflict        = errors.New("conflict")
-	ErrInvalidToken    = errors.New("invalid token")
-	ErrCreateToken     = errors.New("error in creating token")
-	ErrValidateOTP     = errors.New("failed to validate otp")
-	ErrAlreadyExists   = errors.New("entity already exists")
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrMalformedEntity = errors.New("malformed entiry")
+	ErrEntityNotFound   = errors.New("entity not found")
+	ErrInternalServer   = errors.New("internal server error")
+	ErrBadRequest       = errors.New("bad request")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrConflict         = errors.New("conflict")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrCreateToken      = errors.New("error in creating token")
+	ErrValidateOTP      = errors.New("failed to validate otp")
+	ErrTooManyRequests  = errors.New("too many requests")
+	ErrInvalidPhone     = errors.New("invalid phone number")
+	ErrEmailNotVerified = errors.New("email not verified")
+	ErrAlreadyExists    = errors.New("entity already exists")
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrInvalidLogin     = errors.New("invalid login credentials")
+	ErrMalformedEntity  = errors.New("malformed entiry")
+
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	ErrOutOfStock              = errors.New("product out of stock")
+	ErrInvalidCoupon           = errors.New("invalid coupon")
+	ErrInsufficientBalance     = errors.New("insufficient wallet balance")
+	ErrInsufficientPoints      = errors.New("insufficient loyalty points")
+	ErrCategoryCycle           = errors.New("category can not be moved below itself")
 )
@@ -18,7 +18,7 @@ func ClientErrorResponse(message string, data interface{}, err error) Response {
 	switch e := err.(type) {
 	case error:
 		switch {
-		case errors.Is(e, models.ErrUnauthorized):
+		case errors.Is(e, models.ErrUnauthorized), errors.Is(e, models.ErrInvalidToken), errors.Is(e, models.ErrInvalidLogin):
 			status_code = http.StatusUnauthorized
 		case errors.Is(e, models.ErrEntityNotFound):
 			status_code = http.StatusNotFound
@@ -26,8 +26,14 @@ func ClientErrorResponse(message string, data interface{}, err error) Response {
 			status_code = http.StatusBadRequest
 		case errors.Is(e, models.ErrConflict):
 			status_code = http.StatusConflict
-		case errors.Is(e, models.ErrForbidden):
+		case errors.Is(e, models.ErrForbidden), errors.Is(e, models.ErrEmailNotVerified):
 			status_code = http.StatusForbidden
+		case errors.Is(e, models.ErrInvalidStatusTransition):
+			status_code = http.StatusConflict
+		case errors.Is(e, models.ErrOutOfStock):
+			status_code = http.StatusConflict
+		case errors.Is(e, models.ErrTooManyRequests):
+			status_code = http.StatusTooManyRequests
 		default:
 			status_code = http.StatusBadRequest
 		}